@@ -3,7 +3,7 @@ import 'source-map-support/register';
 import * as cdk from 'aws-cdk-lib';
 import * as ec2 from 'aws-cdk-lib/aws-ec2';
 import { Vpc } from '../stacks/vpc';
-import { Orchestrator } from '../stacks/orchestrator';
+import { Orchestrator, RunnerMode } from '../stacks/orchestrator';
 import { RunnerTemplate } from '../stacks/runner-template';
 import { RunnerECR } from '../stacks/runner-ecr';
 import { Publisher } from '../stacks/publisher';
@@ -38,6 +38,15 @@ const dindContainer = {
   cpu: '500m',
   memory: '1Gi',
 };
+// jobs with the restricted label run without the privileged dind sidecar.
+const runnerMode = RunnerMode.DinD;
+const runnerProfiles = [
+  { label: 'restricted', mode: RunnerMode.ContainerHooks },
+];
+const workVolume = {
+  storageClass: 'gp2',
+  size: '10Gi',
+};
 
 /*
  * EC2 Runner Configuration
@@ -95,13 +104,19 @@ const publisher = new Publisher(app, `${application}-publisher`, {
 new Orchestrator(app, `${application}-orchestrator`, {
   application,
   githubToken: getEnvStr('GITHUB_TOKEN'),
+  githubAppID: getEnvStr('GITHUB_APP_ID'),
+  githubAppPrivateKey: getEnvStr('GITHUB_APP_PRIVATE_KEY'),
   jobsTopic: publisher.jobsTopic,
+  breakerTable: publisher.breakerTable,
   ubuntuLaunchTemplateID: template.ubuntuLaunchTemplate.launchTemplateId || '',
   cluster: {
     cluster,
     runnerNamespace,
     githubTokenSecret,
     githubTokenSecretKey,
+    runnerMode,
+    runnerProfiles,
+    workVolume,
   },
   ubuntuRunnerContainer,
   dindContainer,
@@ -3,6 +3,8 @@
 # Environment Variables:
 # * GH_HOST
 # * GH_TOKEN
+# * RUNNER_TOKEN
+# * RUNNER_REMOVE_TOKEN
 # * RUNNER_ENTERPRISE
 # * RUNNER_ORG
 # * RUNNER_REPO
@@ -10,11 +12,18 @@
 # * RUNNER_NAME
 # * RUNNER_LABELS
 # * RUNNER_GROUP
+# * ACTIONS_RUNNER_CONTAINER_HOOKS
 
 github_host=${GH_HOST:="github.com"}
 github_url="https://${github_host}"
 
 set_registration_token() {
+  # a registration token issued by the launcher, the runner doesn't need a GitHub token.
+  if [[ -n ${RUNNER_TOKEN} ]]; then
+    registration_token="${RUNNER_TOKEN}"
+    return
+  fi
+
   registration_token="$(curl -XPOST -fsSL \
     -H "Accept: application/vnd.github.v3+json" \
     -H "Authorization: token ${GH_TOKEN}" \
@@ -22,10 +31,24 @@ set_registration_token() {
     jq -r '.token')"
 }
 
+set_removal_token() {
+  # a removal token issued by the launcher, registration tokens can't remove runners.
+  if [[ -n ${RUNNER_REMOVE_TOKEN} ]]; then
+    removal_token="${RUNNER_REMOVE_TOKEN}"
+    return
+  fi
+
+  removal_token="$(curl -XPOST -fsSL \
+    -H "Accept: application/vnd.github.v3+json" \
+    -H "Authorization: token ${GH_TOKEN}" \
+    "${removal_endpoint}" |
+    jq -r '.token')"
+}
+
 deregister_runner() {
   echo "deregistering runner ${RUNNER_NAME}"
-  set_registration_token
-  ./config.sh remove --token "${registration_token}"
+  set_removal_token
+  ./config.sh remove --token "${removal_token}"
   exit
 }
 
@@ -47,6 +70,7 @@ else
 fi
 
 registration_endpoint="${github_api_url}/${registration_token_path}/actions/runners/registration-token"
+removal_endpoint="${github_api_url}/${registration_token_path}/actions/runners/remove-token"
 echo "requesting registration token, endpoint: ${registration_endpoint}"
 
 if [[ -n ${RUNNER_ORG} ]] && [[ -n ${RUNNER_REPO} ]]; then
@@ -78,9 +102,12 @@ echo "configuring runner, endpoint: ${configure_endpoint}"
 #trap deregister_runner SIGINT SIGQUIT SIGTERM INT TERM QUIT
 trap deregister_runner SIGTERM SIGINT SIGQUIT
 
-while (! docker ps >/dev/null 2>&1); do
-  echo "waiting for docker daemon..."
-  sleep 1
-done
+# job containers run as pods when the container hooks are enabled, there is no docker daemon.
+if [[ -z ${ACTIONS_RUNNER_CONTAINER_HOOKS} ]]; then
+  while (! docker ps >/dev/null 2>&1); do
+    echo "waiting for docker daemon..."
+    sleep 1
+  done
+fi
 
 "$@"
@@ -7,6 +7,7 @@ import (
 
 	"github.com/CameronXie/aws-github-actions-runner/messenger/internal/handler"
 	"github.com/CameronXie/aws-github-actions-runner/messenger/internal/messenger"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
@@ -24,10 +25,13 @@ func main() {
 	)
 	handleError(err)
 
-	lambda.Start(handler.SetupHandler(messenger.New(
-		sns.NewFromConfig(cfg),
-		os.Getenv(publisherTopicEnv),
-	)))
+	lambda.Start(handler.SetupHandler(
+		messenger.New(
+			sns.NewFromConfig(cfg),
+			os.Getenv(publisherTopicEnv),
+		),
+		metrics.New(os.Stdout, metrics.DefaultNamespace),
+	))
 }
 
 func handleError(err error) {
@@ -3,6 +3,7 @@ module github.com/CameronXie/aws-github-actions-runner/messenger
 go 1.17
 
 require (
+	github.com/CameronXie/aws-github-actions-runner/telemetry v0.0.0
 	github.com/aws/aws-lambda-go v1.28.0
 	github.com/aws/aws-sdk-go-v2 v1.13.0
 	github.com/aws/aws-sdk-go-v2/config v1.13.1
@@ -25,3 +26,5 @@ require (
 	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
 	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b // indirect
 )
+
+replace github.com/CameronXie/aws-github-actions-runner/telemetry => ../telemetry
@@ -4,13 +4,45 @@ import (
 	"context"
 
 	"github.com/CameronXie/aws-github-actions-runner/messenger/internal/messenger"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
 	"github.com/aws/aws-lambda-go/events"
 )
 
+const eventNameDimension = "EventName"
+
 type DynamoDBEventHandler = func(ctx context.Context, e events.DynamoDBEvent) error
 
-func SetupHandler(svc messenger.Service) DynamoDBEventHandler {
-	return func(ctx context.Context, _ events.DynamoDBEvent) error {
-		return svc.NotifyPublisher(ctx)
+func SetupHandler(svc messenger.Service, recorder metrics.Recorder) DynamoDBEventHandler {
+	return func(ctx context.Context, e events.DynamoDBEvent) error {
+		recordEvent(recorder, e)
+
+		err := svc.NotifyPublisher(ctx)
+		failures := 0.0
+		if err != nil {
+			failures = 1
+		}
+
+		recorder.Put(
+			metrics.Dimensions{},
+			metrics.Metric{Name: "PublisherNotifications", Value: 1, Unit: metrics.Count},
+			metrics.Metric{Name: "PublisherNotificationFailures", Value: failures, Unit: metrics.Count},
+		)
+
+		return err
+	}
+}
+
+// recordEvent counts the stream records by event name, the stream only contains the keys.
+func recordEvent(recorder metrics.Recorder, e events.DynamoDBEvent) {
+	counts := make(map[string]int)
+	for i := range e.Records {
+		counts[e.Records[i].EventName]++
+	}
+
+	for name, count := range counts {
+		recorder.Put(
+			metrics.Dimensions{eventNameDimension: name},
+			metrics.Metric{Name: "StreamRecords", Value: float64(count), Unit: metrics.Count},
+		)
 	}
 }
@@ -2,26 +2,100 @@ package handler
 
 import (
 	"context"
+	"errors"
 	"testing"
 
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestSetupHandler(t *testing.T) {
-	a := assert.New(t)
-	svc := new(mockedMessenger)
-	ctx := context.TODO()
+	cases := map[string]struct {
+		event    events.DynamoDBEvent
+		err      error
+		expected []recordedMetrics
+	}{
+		"empty event": {
+			expected: []recordedMetrics{
+				{
+					dimensions: metrics.Dimensions{},
+					metrics:    getNotificationMetrics(0),
+				},
+			},
+		},
+		"stream records": {
+			event: events.DynamoDBEvent{Records: []events.DynamoDBEventRecord{
+				{EventName: "INSERT"},
+				{EventName: "MODIFY"},
+				{EventName: "INSERT"},
+			}},
+			expected: []recordedMetrics{
+				{
+					dimensions: metrics.Dimensions{"EventName": "INSERT"},
+					metrics:    []metrics.Metric{{Name: "StreamRecords", Value: 2, Unit: metrics.Count}},
+				},
+				{
+					dimensions: metrics.Dimensions{"EventName": "MODIFY"},
+					metrics:    []metrics.Metric{{Name: "StreamRecords", Value: 1, Unit: metrics.Count}},
+				},
+				{
+					dimensions: metrics.Dimensions{},
+					metrics:    getNotificationMetrics(0),
+				},
+			},
+		},
+		"failed to notify publisher": {
+			err: errors.New("some error"),
+			expected: []recordedMetrics{
+				{
+					dimensions: metrics.Dimensions{},
+					metrics:    getNotificationMetrics(1),
+				},
+			},
+		},
+	}
 
-	a.Nil(SetupHandler(svc)(ctx, events.DynamoDBEvent{}))
-	a.Equal(ctx, svc.ctx)
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			svc := &mockedMessenger{err: tc.err}
+			recorder := new(mockedRecorder)
+			ctx := context.TODO()
+
+			a.Equal(tc.err, SetupHandler(svc, recorder)(ctx, tc.event))
+			a.Equal(ctx, svc.ctx)
+			a.ElementsMatch(tc.expected, recorder.puts)
+		})
+	}
+}
+
+func getNotificationMetrics(failures float64) []metrics.Metric {
+	return []metrics.Metric{
+		{Name: "PublisherNotifications", Value: 1, Unit: metrics.Count},
+		{Name: "PublisherNotificationFailures", Value: failures, Unit: metrics.Count},
+	}
 }
 
 type mockedMessenger struct {
 	ctx context.Context
+	err error
 }
 
 func (m *mockedMessenger) NotifyPublisher(ctx context.Context) error {
 	m.ctx = ctx
-	return nil
+	return m.err
+}
+
+type recordedMetrics struct {
+	dimensions metrics.Dimensions
+	metrics    []metrics.Metric
+}
+
+type mockedRecorder struct {
+	puts []recordedMetrics
+}
+
+func (m *mockedRecorder) Put(dimensions metrics.Dimensions, metrics ...metrics.Metric) {
+	m.puts = append(m.puts, recordedMetrics{dimensions: dimensions, metrics: metrics})
 }
@@ -4,17 +4,31 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
 	"text/template"
 
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/breaker"
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/handler"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	ec2runner "github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/ec2"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 )
 
 const (
+	serviceName                 = "ec2-launcher"
+	runnerOS                    = "ubuntu"
+	deadLetterQueueEnv          = "DEAD_LETTER_QUEUE_URL"
+	breakerTableEnv             = "BREAKER_TABLE"
+	breakerThresholdEnv         = "BREAKER_THRESHOLD"
 	runnerNamePrefix            = "ec2-runner"
 	githubTokenEnv              = "GITHUB_TOKEN"
 	runnerVersionEnv            = "GITHUB_RUNNER_VERSION"
@@ -28,6 +42,10 @@ func main() {
 	logger, _ := zap.NewProduction()
 	defer func() { _ = logger.Sync() }()
 
+	if _, err := tracing.SetupFromEnv(context.TODO(), serviceName); err != nil {
+		logger.Fatal(fmt.Sprintf("tracing error: %v", err.Error()))
+	}
+
 	cfg, err := config.LoadDefaultConfig(
 		context.TODO(),
 		config.WithDefaultRegion(os.Getenv("DEFAULT_REGION")),
@@ -37,15 +55,57 @@ func main() {
 		logger.Fatal(fmt.Sprintf("aws sdk error: %v", err.Error()))
 	}
 
-	lambda.Start(handler.SetupLauncherHandler(
-		ec2runner.NewLauncher(runnerNamePrefix, ec2.NewFromConfig(cfg), &ec2runner.LaunchConfig{
-			TemplateID:       os.Getenv(launchTemplateEnv),
-			TemplateVersion:  ubuntuLaunchTemplateVersion,
-			SubnetID:         os.Getenv(subnetEnv),
-			GitHubToken:      os.Getenv(githubTokenEnv),
-			RunnerVersion:    os.Getenv(runnerVersionEnv),
-			UserDataTemplate: template.Must(template.ParseFiles(userData)),
-		}),
+	backoff := handler.DefaultBackoffConfig
+	backoff.DeadLetterQueueURL = os.Getenv(deadLetterQueueEnv)
+
+	lambda.Start(handler.WithBackoff(
+		handler.SetupLauncherHandler(
+			metrics.NewLauncher(
+				withBreaker(runner.NewRetryLauncher(
+					ec2runner.NewLauncher(runnerNamePrefix, ec2.NewFromConfig(cfg), &ec2runner.LaunchConfig{
+						TemplateID:       os.Getenv(launchTemplateEnv),
+						TemplateVersion:  ubuntuLaunchTemplateVersion,
+						SubnetID:         os.Getenv(subnetEnv),
+						GitHubToken:      os.Getenv(githubTokenEnv),
+						RunnerVersion:    os.Getenv(runnerVersionEnv),
+						UserDataTemplate: template.Must(template.ParseFiles(userData)),
+					}),
+					ec2runner.ClassifyError,
+					runner.DefaultRetryConfig,
+				), cfg, ec2runner.RunnerType, logger),
+				telemetry.New(os.Stdout, telemetry.DefaultNamespace),
+				telemetry.Dimensions{metrics.RunnerTypeDimension: ec2runner.RunnerType, metrics.OSDimension: runnerOS},
+			),
+			logger,
+		),
+		sqs.NewFromConfig(cfg),
+		&backoff,
 		logger,
 	))
 }
+
+// withBreaker records launch outcomes in BREAKER_TABLE, the publisher stops publishing jobs to the
+// runner type after BREAKER_THRESHOLD consecutive failures.
+func withBreaker(l runner.Launcher, cfg aws.Config, runnerType string, logger *zap.Logger) runner.Launcher {
+	table := os.Getenv(breakerTableEnv)
+	if table == "" {
+		return l
+	}
+
+	threshold := breaker.DefaultThreshold
+	if v := os.Getenv(breakerThresholdEnv); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("breaker threshold error: %v", err.Error()))
+		}
+
+		threshold = t
+	}
+
+	return breaker.NewLauncher(
+		l,
+		breaker.NewDynamoDBStore(dynamodb.NewFromConfig(cfg), table, threshold),
+		runnerType,
+		logger,
+	)
+}
@@ -4,16 +4,32 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/breaker"
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/handler"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/github"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	eksrunner "github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/eks"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 )
 
 const (
+	serviceName              = "eks-launcher"
+	runnerOS                 = "ubuntu"
+	deadLetterQueueEnv       = "DEAD_LETTER_QUEUE_URL"
+	breakerTableEnv          = "BREAKER_TABLE"
+	breakerThresholdEnv      = "BREAKER_THRESHOLD"
 	runnerNamePrefix         = "eks-runner"
 	eksClusterEnv            = "EKS_CLUSTER"
 	eksNamespaceEnv          = "EKS_NAMESPACE"
@@ -25,12 +41,24 @@ const (
 	dindContainerImageEnv    = "DIND_CONTAINER_IMAGE"
 	dindContainerCPUEnv      = "DIND_CONTAINER_CPU"
 	dindContainerMemoryEnv   = "DIND_CONTAINER_MEMORY"
+	runnerModeEnv            = "RUNNER_MODE"
+	runnerProfilesEnv        = "RUNNER_PROFILES"
+	workVolumeClassEnv       = "WORK_VOLUME_STORAGE_CLASS"
+	workVolumeSizeEnv        = "WORK_VOLUME_SIZE"
+	githubTokenEnv           = "GITHUB_TOKEN"
+	githubAppIDEnv           = "GITHUB_APP_ID"
+	githubAppPrivateKeyEnv   = "GITHUB_APP_PRIVATE_KEY"
+	githubAPIURLEnv          = "GITHUB_API_URL"
 )
 
 func main() {
 	logger, _ := zap.NewProduction()
 	defer func() { _ = logger.Sync() }()
 
+	if _, err := tracing.SetupFromEnv(context.TODO(), serviceName); err != nil {
+		logger.Fatal(fmt.Sprintf("tracing error: %v", err.Error()))
+	}
+
 	cfg, err := config.LoadDefaultConfig(
 		context.TODO(),
 		config.WithDefaultRegion(os.Getenv("DEFAULT_REGION")),
@@ -48,22 +76,122 @@ func main() {
 		logger.Fatal(fmt.Sprintf("kube client error: %v", err.Error()))
 	}
 
-	lambda.Start(handler.SetupLauncherHandler(
-		eksrunner.NewLauncher(runnerNamePrefix, kubeClient, &eksrunner.LaunchConfig{
-			Namespace: os.Getenv(eksNamespaceEnv),
-			Runner: eksrunner.ContainerResource{
-				Image:  os.Getenv(runnerContainerImageEnv),
-				CPU:    os.Getenv(runnerContainerCPUEnv),
-				Memory: os.Getenv(runnerContainerMemoryEnv),
-			},
-			DinD: eksrunner.ContainerResource{
-				Image:  os.Getenv(dindContainerImageEnv),
-				CPU:    os.Getenv(dindContainerCPUEnv),
-				Memory: os.Getenv(dindContainerMemoryEnv),
-			},
-			GitHubSecret:    os.Getenv(githubTokenSecretEnv),
-			GitHubSecretKey: os.Getenv(githubTokenSecretKeyEnv),
-		}),
+	launchConfig := &eksrunner.LaunchConfig{
+		Namespace: os.Getenv(eksNamespaceEnv),
+		Mode:      os.Getenv(runnerModeEnv),
+		Profiles:  getRunnerProfiles(logger),
+		Runner: eksrunner.ContainerResource{
+			Image:  os.Getenv(runnerContainerImageEnv),
+			CPU:    os.Getenv(runnerContainerCPUEnv),
+			Memory: os.Getenv(runnerContainerMemoryEnv),
+		},
+		DinD: eksrunner.ContainerResource{
+			Image:  os.Getenv(dindContainerImageEnv),
+			CPU:    os.Getenv(dindContainerCPUEnv),
+			Memory: os.Getenv(dindContainerMemoryEnv),
+		},
+		WorkVolume: eksrunner.WorkVolumeConfig{
+			StorageClass: os.Getenv(workVolumeClassEnv),
+			Size:         os.Getenv(workVolumeSizeEnv),
+		},
+		GitHubSecret:       os.Getenv(githubTokenSecretEnv),
+		GitHubSecretKey:    os.Getenv(githubTokenSecretKeyEnv),
+		RegistrationTokens: getRegistrationTokens(logger),
+	}
+
+	if err := launchConfig.Validate(); err != nil {
+		logger.Fatal(fmt.Sprintf("launch config error: %v", err.Error()))
+	}
+
+	backoff := handler.DefaultBackoffConfig
+	backoff.DeadLetterQueueURL = os.Getenv(deadLetterQueueEnv)
+
+	lambda.Start(handler.WithBackoff(
+		handler.SetupLauncherHandler(
+			metrics.NewLauncher(
+				withBreaker(runner.NewRetryLauncher(
+					eksrunner.NewLauncher(runnerNamePrefix, kubeClient, launchConfig),
+					eksrunner.ClassifyError,
+					runner.DefaultRetryConfig,
+				), cfg, eksrunner.RunnerType, logger),
+				telemetry.New(os.Stdout, telemetry.DefaultNamespace),
+				telemetry.Dimensions{metrics.RunnerTypeDimension: eksrunner.RunnerType, metrics.OSDimension: runnerOS},
+			),
+			logger,
+		),
+		sqs.NewFromConfig(cfg),
+		&backoff,
 		logger,
 	))
 }
+
+// getRunnerProfiles reads RUNNER_PROFILES as comma separated label=mode pairs, e.g.
+// restricted=container-hooks runs the jobs with the restricted label with container hooks.
+func getRunnerProfiles(logger *zap.Logger) []eksrunner.Profile {
+	profiles := make([]eksrunner.Profile, 0)
+	v := os.Getenv(runnerProfilesEnv)
+	if v == "" {
+		return profiles
+	}
+
+	for _, p := range strings.Split(v, ",") {
+		kv := strings.SplitN(strings.TrimSpace(p), "=", 2)
+		if len(kv) != 2 || kv[0] == "" {
+			logger.Fatal(fmt.Sprintf("runner profiles error: invalid profile %q", p))
+		}
+
+		profiles = append(profiles, eksrunner.Profile{Label: kv[0], Mode: kv[1]})
+	}
+
+	return profiles
+}
+
+// getRegistrationTokens issues the runner tokens as the GitHub App when GITHUB_APP_ID is set, or
+// with GITHUB_TOKEN, otherwise runners use the shared GitHub token secret.
+func getRegistrationTokens(logger *zap.Logger) runner.RegistrationTokenProvider {
+	apiURL := os.Getenv(githubAPIURLEnv)
+	if apiURL == "" {
+		apiURL = github.DefaultAPIURL
+	}
+
+	if appID := os.Getenv(githubAppIDEnv); appID != "" {
+		key, err := github.ParsePrivateKey([]byte(os.Getenv(githubAppPrivateKeyEnv)))
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("github app private key error: %v", err.Error()))
+		}
+
+		return github.NewAppTokenProvider(nil, apiURL, appID, key)
+	}
+
+	if token := os.Getenv(githubTokenEnv); token != "" {
+		return github.NewTokenProvider(nil, apiURL, token)
+	}
+
+	return nil
+}
+
+// withBreaker records launch outcomes in BREAKER_TABLE, the publisher stops publishing jobs to the
+// runner type after BREAKER_THRESHOLD consecutive failures.
+func withBreaker(l runner.Launcher, cfg aws.Config, runnerType string, logger *zap.Logger) runner.Launcher {
+	table := os.Getenv(breakerTableEnv)
+	if table == "" {
+		return l
+	}
+
+	threshold := breaker.DefaultThreshold
+	if v := os.Getenv(breakerThresholdEnv); v != "" {
+		t, err := strconv.Atoi(v)
+		if err != nil {
+			logger.Fatal(fmt.Sprintf("breaker threshold error: %v", err.Error()))
+		}
+
+		threshold = t
+	}
+
+	return breaker.NewLauncher(
+		l,
+		breaker.NewDynamoDBStore(dynamodb.NewFromConfig(cfg), table, threshold),
+		runnerType,
+		logger,
+	)
+}
@@ -6,17 +6,31 @@ import (
 	"os"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/handler"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	ec2runner "github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/ec2"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 )
 
+const (
+	serviceName        = "ec2-terminator"
+	deadLetterQueueEnv = "DEAD_LETTER_QUEUE_URL"
+)
+
 func main() {
 	logger, _ := zap.NewProduction()
 	defer func() { _ = logger.Sync() }()
 
+	if _, err := tracing.SetupFromEnv(context.TODO(), serviceName); err != nil {
+		logger.Fatal(fmt.Sprintf("tracing error: %v", err.Error()))
+	}
+
 	cfg, err := config.LoadDefaultConfig(
 		context.TODO(),
 		config.WithDefaultRegion(os.Getenv("DEFAULT_REGION")),
@@ -26,8 +40,24 @@ func main() {
 		logger.Fatal(fmt.Sprintf("aws sdk error: %v", err.Error()))
 	}
 
-	lambda.Start(handler.SetupTerminatorHandler(
-		ec2runner.NewTerminator(ec2.NewFromConfig(cfg)),
+	backoff := handler.DefaultBackoffConfig
+	backoff.DeadLetterQueueURL = os.Getenv(deadLetterQueueEnv)
+
+	lambda.Start(handler.WithBackoff(
+		handler.SetupTerminatorHandler(
+			metrics.NewTerminator(
+				runner.NewRetryTerminator(
+					ec2runner.NewTerminator(ec2.NewFromConfig(cfg)),
+					ec2runner.ClassifyError,
+					runner.DefaultRetryConfig,
+				),
+				telemetry.New(os.Stdout, telemetry.DefaultNamespace),
+				telemetry.Dimensions{metrics.RunnerTypeDimension: ec2runner.RunnerType},
+			),
+			logger,
+		),
+		sqs.NewFromConfig(cfg),
+		&backoff,
 		logger,
 	))
 }
@@ -4,24 +4,40 @@ import (
 	"context"
 	"fmt"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/handler"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	eksrunner "github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/eks"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/lambda"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
 	"go.uber.org/zap"
 )
 
 const (
-	eksClusterEnv   = "EKS_CLUSTER"
-	eksNamespaceEnv = "EKS_NAMESPACE"
+	serviceName             = "eks-terminator"
+	deadLetterQueueEnv      = "DEAD_LETTER_QUEUE_URL"
+	eksClusterEnv           = "EKS_CLUSTER"
+	eksNamespaceEnv         = "EKS_NAMESPACE"
+	waitForDeletionEnv      = "WAIT_FOR_DELETION"
+	deletionPollIntervalEnv = "DELETION_POLL_INTERVAL"
+	deletionGracePeriodEnv  = "DELETION_GRACE_PERIOD"
 )
 
 func main() {
 	logger, _ := zap.NewProduction()
 	defer func() { _ = logger.Sync() }()
 
+	if _, err := tracing.SetupFromEnv(context.TODO(), serviceName); err != nil {
+		logger.Fatal(fmt.Sprintf("tracing error: %v", err.Error()))
+	}
+
 	cfg, err := config.LoadDefaultConfig(
 		context.TODO(),
 		config.WithDefaultRegion(os.Getenv("DEFAULT_REGION")),
@@ -39,11 +55,55 @@ func main() {
 		logger.Fatal(fmt.Sprintf("kube client error: %v", err.Error()))
 	}
 
-	lambda.Start(handler.SetupTerminatorHandler(
-		eksrunner.NewTerminator(kubeClient, &eksrunner.RunnerTerminationConfig{
-			Cluster:   os.Getenv(eksClusterEnv),
-			Namespace: os.Getenv(eksNamespaceEnv),
-		}),
+	wait, pollInterval, gracePeriod, cfgErr := getDeletionConfig()
+	if cfgErr != nil {
+		logger.Fatal(fmt.Sprintf("deletion config error: %v", cfgErr.Error()))
+	}
+
+	backoff := handler.DefaultBackoffConfig
+	backoff.DeadLetterQueueURL = os.Getenv(deadLetterQueueEnv)
+
+	lambda.Start(handler.WithBackoff(
+		handler.SetupTerminatorHandler(
+			metrics.NewTerminator(
+				runner.NewRetryTerminator(
+					eksrunner.NewTerminator(kubeClient, &eksrunner.RunnerTerminationConfig{
+						Cluster:         os.Getenv(eksClusterEnv),
+						Namespace:       os.Getenv(eksNamespaceEnv),
+						WaitForDeletion: wait,
+						PollInterval:    pollInterval,
+						GracePeriod:     gracePeriod,
+					}),
+					eksrunner.ClassifyError,
+					runner.DefaultRetryConfig,
+				),
+				telemetry.New(os.Stdout, telemetry.DefaultNamespace),
+				telemetry.Dimensions{metrics.RunnerTypeDimension: eksrunner.RunnerType},
+			),
+			logger,
+		),
+		sqs.NewFromConfig(cfg),
+		&backoff,
 		logger,
 	))
 }
+
+func getDeletionConfig() (wait bool, pollInterval, gracePeriod time.Duration, err error) {
+	if v := os.Getenv(waitForDeletionEnv); v != "" {
+		if wait, err = strconv.ParseBool(v); err != nil {
+			return
+		}
+	}
+
+	if v := os.Getenv(deletionPollIntervalEnv); v != "" {
+		if pollInterval, err = time.ParseDuration(v); err != nil {
+			return
+		}
+	}
+
+	if v := os.Getenv(deletionGracePeriodEnv); v != "" {
+		gracePeriod, err = time.ParseDuration(v)
+	}
+
+	return
+}
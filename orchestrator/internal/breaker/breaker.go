@@ -0,0 +1,177 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// State of a runner type breaker, the publisher stops publishing queued jobs to an open breaker and
+// half-opens it after a cooldown to probe the runner type with a single job.
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+
+	// DefaultThreshold is the number of consecutive launch failures which opens a breaker.
+	DefaultThreshold = 5
+)
+
+// Transition is a breaker state change caused by a launch outcome.
+type Transition struct {
+	From     State
+	To       State
+	Failures int
+}
+
+type Store interface {
+	// RecordSuccess closes the breaker, it returns nil transition when the breaker is already closed.
+	RecordSuccess(ctx context.Context, runnerType string) (*Transition, error)
+	// RecordFailure counts a consecutive launch failure, it returns nil transition when the breaker
+	// stays in the same state.
+	RecordFailure(ctx context.Context, runnerType string) (*Transition, error)
+}
+
+type UpdateItemAPIClient interface {
+	UpdateItem(
+		ctx context.Context,
+		params *dynamodb.UpdateItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+}
+
+type item struct {
+	State    State
+	Failures int
+}
+
+type dynamoDBStore struct {
+	client    UpdateItemAPIClient
+	table     string
+	threshold int
+	now       func() time.Time
+}
+
+func (s *dynamoDBStore) RecordSuccess(ctx context.Context, runnerType string) (*Transition, error) {
+	o, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 getKey(runnerType),
+		UpdateExpression:    aws.String("SET #s = :closed, #f = :zero"),
+		ConditionExpression: aws.String("#s <> :closed OR #f > :zero"),
+		ExpressionAttributeNames: map[string]string{
+			"#s": "State",
+			"#f": "Failures",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":closed": &types.AttributeValueMemberS{Value: string(Closed)},
+			":zero":   &types.AttributeValueMemberN{Value: "0"},
+		},
+		ReturnValues: types.ReturnValueUpdatedOld,
+	})
+
+	if isConditionalCheckFailed(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	old := new(item)
+	if err := attributevalue.UnmarshalMap(o.Attributes, old); err != nil {
+		return nil, err
+	}
+
+	if old.State == "" || old.State == Closed {
+		return nil, nil
+	}
+
+	return &Transition{From: old.State, To: Closed}, nil
+}
+
+func (s *dynamoDBStore) RecordFailure(ctx context.Context, runnerType string) (*Transition, error) {
+	o, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:        aws.String(s.table),
+		Key:              getKey(runnerType),
+		UpdateExpression: aws.String("ADD #f :one"),
+		ExpressionAttributeNames: map[string]string{
+			"#f": "Failures",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":one": &types.AttributeValueMemberN{Value: "1"},
+		},
+		ReturnValues: types.ReturnValueAllNew,
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	current := new(item)
+	if err := attributevalue.UnmarshalMap(o.Attributes, current); err != nil {
+		return nil, err
+	}
+
+	if current.State == "" {
+		current.State = Closed
+	}
+
+	// a failed probe reopens the breaker straight away.
+	if current.State == Open || (current.State == Closed && current.Failures < s.threshold) {
+		return nil, nil
+	}
+
+	_, err = s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 getKey(runnerType),
+		UpdateExpression:    aws.String("SET #s = :open, OpenedAt = :now"),
+		ConditionExpression: aws.String("attribute_not_exists(#s) OR #s <> :open"),
+		ExpressionAttributeNames: map[string]string{
+			"#s": "State",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":open": &types.AttributeValueMemberS{Value: string(Open)},
+			":now":  &types.AttributeValueMemberN{Value: strconv.FormatInt(s.now().Unix(), 10)},
+		},
+	})
+
+	// a concurrent launch failure has opened the breaker.
+	if isConditionalCheckFailed(err) {
+		return nil, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return &Transition{From: current.State, To: Open, Failures: current.Failures}, nil
+}
+
+func getKey(runnerType string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"RunnerType": &types.AttributeValueMemberS{Value: runnerType},
+	}
+}
+
+func isConditionalCheckFailed(err error) bool {
+	var e *types.ConditionalCheckFailedException
+	return errors.As(err, &e)
+}
+
+// NewDynamoDBStore keeps the breaker state of every runner type in one item keyed by RunnerType.
+func NewDynamoDBStore(client UpdateItemAPIClient, table string, threshold int) Store {
+	return &dynamoDBStore{
+		client:    client,
+		table:     table,
+		threshold: threshold,
+		now:       time.Now,
+	}
+}
@@ -0,0 +1,170 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamoDBStore_RecordSuccess(t *testing.T) {
+	cases := map[string]struct {
+		outputs    []*dynamodb.UpdateItemOutput
+		errs       []error
+		transition *Transition
+		err        error
+	}{
+		"close open breaker": {
+			outputs:    []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(HalfOpen, "5")}},
+			errs:       []error{nil},
+			transition: &Transition{From: HalfOpen, To: Closed},
+		},
+		"reset failures of closed breaker": {
+			outputs: []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(Closed, "2")}},
+			errs:    []error{nil},
+		},
+		"breaker already closed": {
+			outputs: []*dynamodb.UpdateItemOutput{nil},
+			errs:    []error{&types.ConditionalCheckFailedException{}},
+		},
+		"failed to update breaker": {
+			outputs: []*dynamodb.UpdateItemOutput{nil},
+			errs:    []error{errors.New("some error")},
+			err:     errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedUpdateItemClient{outputs: tc.outputs, errs: tc.errs}
+			transition, err := NewDynamoDBStore(client, "table", 5).RecordSuccess(context.TODO(), "ec2")
+
+			a.Equal(tc.transition, transition)
+			a.Equal(tc.err, err)
+			a.Len(client.inputs, 1)
+			a.Equal(aws.String("table"), client.inputs[0].TableName)
+			a.Equal(getKey("ec2"), client.inputs[0].Key)
+			a.Equal("SET #s = :closed, #f = :zero", aws.ToString(client.inputs[0].UpdateExpression))
+		})
+	}
+}
+
+func TestDynamoDBStore_RecordFailure(t *testing.T) {
+	now := time.Unix(1640995200, 0)
+	openInput := &dynamodb.UpdateItemInput{
+		TableName:           aws.String("table"),
+		Key:                 getKey("ec2"),
+		UpdateExpression:    aws.String("SET #s = :open, OpenedAt = :now"),
+		ConditionExpression: aws.String("attribute_not_exists(#s) OR #s <> :open"),
+		ExpressionAttributeNames: map[string]string{
+			"#s": "State",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":open": &types.AttributeValueMemberS{Value: string(Open)},
+			":now":  &types.AttributeValueMemberN{Value: "1640995200"},
+		},
+	}
+
+	cases := map[string]struct {
+		outputs       []*dynamodb.UpdateItemOutput
+		errs          []error
+		expectedInput *dynamodb.UpdateItemInput
+		transition    *Transition
+		err           error
+	}{
+		"failures below threshold": {
+			outputs: []*dynamodb.UpdateItemOutput{{Attributes: getAttributes("", "2")}},
+			errs:    []error{nil},
+		},
+		"open closed breaker when failures reach threshold": {
+			outputs:       []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(Closed, "3")}, {}},
+			errs:          []error{nil, nil},
+			expectedInput: openInput,
+			transition:    &Transition{From: Closed, To: Open, Failures: 3},
+		},
+		"reopen breaker when probe failed": {
+			outputs:       []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(HalfOpen, "4")}, {}},
+			errs:          []error{nil, nil},
+			expectedInput: openInput,
+			transition:    &Transition{From: HalfOpen, To: Open, Failures: 4},
+		},
+		"breaker already open": {
+			outputs: []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(Open, "7")}},
+			errs:    []error{nil},
+		},
+		"breaker opened by concurrent failure": {
+			outputs:       []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(Closed, "3")}, nil},
+			errs:          []error{nil, &types.ConditionalCheckFailedException{}},
+			expectedInput: openInput,
+		},
+		"failed to count failure": {
+			outputs: []*dynamodb.UpdateItemOutput{nil},
+			errs:    []error{errors.New("some error")},
+			err:     errors.New("some error"),
+		},
+		"failed to open breaker": {
+			outputs:       []*dynamodb.UpdateItemOutput{{Attributes: getAttributes(Closed, "3")}, nil},
+			errs:          []error{nil, errors.New("some error")},
+			expectedInput: openInput,
+			err:           errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedUpdateItemClient{outputs: tc.outputs, errs: tc.errs}
+			s := NewDynamoDBStore(client, "table", 3).(*dynamoDBStore)
+			s.now = func() time.Time { return now }
+
+			transition, err := s.RecordFailure(context.TODO(), "ec2")
+
+			a.Equal(tc.transition, transition)
+			a.Equal(tc.err, err)
+			a.Equal("ADD #f :one", aws.ToString(client.inputs[0].UpdateExpression))
+			a.Equal(types.ReturnValueAllNew, client.inputs[0].ReturnValues)
+
+			if tc.expectedInput == nil {
+				a.Len(client.inputs, 1)
+				return
+			}
+
+			a.Len(client.inputs, 2)
+			a.Equal(tc.expectedInput, client.inputs[1])
+		})
+	}
+}
+
+func getAttributes(state State, failures string) map[string]types.AttributeValue {
+	attrs := map[string]types.AttributeValue{
+		"Failures": &types.AttributeValueMemberN{Value: failures},
+	}
+
+	if state != "" {
+		attrs["State"] = &types.AttributeValueMemberS{Value: string(state)}
+	}
+
+	return attrs
+}
+
+type mockedUpdateItemClient struct {
+	inputs  []*dynamodb.UpdateItemInput
+	outputs []*dynamodb.UpdateItemOutput
+	errs    []error
+}
+
+func (m *mockedUpdateItemClient) UpdateItem(
+	_ context.Context,
+	params *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	i := len(m.inputs)
+	m.inputs = append(m.inputs, params)
+	return m.outputs[i], m.errs[i]
+}
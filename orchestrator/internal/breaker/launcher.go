@@ -0,0 +1,54 @@
+package breaker
+
+import (
+	"context"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"go.uber.org/zap"
+)
+
+type launcher struct {
+	launcher   runner.Launcher
+	store      Store
+	runnerType string
+	logger     *zap.Logger
+}
+
+func (l *launcher) Launch(ctx context.Context, input *runner.LaunchInput) error {
+	err := l.launcher.Launch(ctx, input)
+
+	record := l.store.RecordFailure
+	if err == nil || runner.IsAlreadyExistsError(err) {
+		record = l.store.RecordSuccess
+	}
+
+	// the breaker is advisory, failing to record the outcome must not fail the launch.
+	t, rErr := record(ctx, l.runnerType)
+	if rErr != nil {
+		l.logger.Warn("failed to record launch outcome",
+			zap.String("runner_type", l.runnerType),
+			zap.Error(rErr),
+		)
+	}
+
+	if t != nil {
+		l.logger.Info("circuit breaker state changed",
+			zap.String("runner_type", l.runnerType),
+			zap.String("from", string(t.From)),
+			zap.String("to", string(t.To)),
+			zap.Int("failures", t.Failures),
+		)
+	}
+
+	return err
+}
+
+// NewLauncher records consecutive launch failures of the runner type in the breaker store.
+func NewLauncher(l runner.Launcher, store Store, runnerType string, logger *zap.Logger) runner.Launcher {
+	return &launcher{
+		launcher:   l,
+		store:      store,
+		runnerType: runnerType,
+		logger:     logger,
+	}
+}
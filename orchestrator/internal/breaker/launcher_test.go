@@ -0,0 +1,109 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLauncher_Launch(t *testing.T) {
+	cases := map[string]struct {
+		launchErr      error
+		transition     *Transition
+		storeErr       error
+		expectedRecord string
+		expectedLogs   []map[string]interface{}
+	}{
+		"record successful launch": {
+			expectedRecord: "success",
+			expectedLogs:   []map[string]interface{}{},
+		},
+		"record existing runner as success": {
+			launchErr:      &runner.AlreadyExistsError{ID: 1, Type: "ec2"},
+			expectedRecord: "success",
+			expectedLogs:   []map[string]interface{}{},
+		},
+		"close breaker": {
+			transition:     &Transition{From: HalfOpen, To: Closed},
+			expectedRecord: "success",
+			expectedLogs: []map[string]interface{}{
+				{"msg": "circuit breaker state changed", "runner_type": "ec2", "from": "half_open", "to": "closed", "failures": int64(0)},
+			},
+		},
+		"record failed launch": {
+			launchErr:      errors.New("some error"),
+			expectedRecord: "failure",
+			expectedLogs:   []map[string]interface{}{},
+		},
+		"open breaker": {
+			launchErr:      errors.New("some error"),
+			transition:     &Transition{From: Closed, To: Open, Failures: 5},
+			expectedRecord: "failure",
+			expectedLogs: []map[string]interface{}{
+				{"msg": "circuit breaker state changed", "runner_type": "ec2", "from": "closed", "to": "open", "failures": int64(5)},
+			},
+		},
+		"failed to record launch outcome": {
+			storeErr:       errors.New("store error"),
+			expectedRecord: "success",
+			expectedLogs: []map[string]interface{}{
+				{"msg": "failed to record launch outcome", "runner_type": "ec2", "error": "store error"},
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			store := &mockedStore{transition: tc.transition, err: tc.storeErr}
+			core, logs := observer.New(zap.DebugLevel)
+
+			err := NewLauncher(&mockedLauncher{err: tc.launchErr}, store, "ec2", zap.New(core)).
+				Launch(context.TODO(), &runner.LaunchInput{ID: 1})
+
+			a.Equal(tc.launchErr, err)
+			a.Equal(tc.expectedRecord, store.recorded)
+			a.Equal("ec2", store.runnerType)
+
+			l := make([]map[string]interface{}, 0)
+			for _, i := range logs.All() {
+				entry := i.ContextMap()
+				entry["msg"] = i.Message
+				l = append(l, entry)
+			}
+			a.Equal(tc.expectedLogs, l)
+		})
+	}
+}
+
+type mockedLauncher struct {
+	err error
+}
+
+func (m *mockedLauncher) Launch(context.Context, *runner.LaunchInput) error {
+	return m.err
+}
+
+type mockedStore struct {
+	recorded   string
+	runnerType string
+	transition *Transition
+	err        error
+}
+
+func (m *mockedStore) RecordSuccess(_ context.Context, runnerType string) (*Transition, error) {
+	m.recorded = "success"
+	m.runnerType = runnerType
+	return m.transition, m.err
+}
+
+func (m *mockedStore) RecordFailure(_ context.Context, runnerType string) (*Transition, error) {
+	m.recorded = "failure"
+	m.runnerType = runnerType
+	return m.transition, m.err
+}
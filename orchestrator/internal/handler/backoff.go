@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.uber.org/zap"
+)
+
+const (
+	receiveCountAttribute = "ApproximateReceiveCount"
+	errorAttribute        = "Error"
+	// maxVisibilityTimeout is the SQS visibility timeout limit.
+	maxVisibilityTimeout = 12 * time.Hour
+)
+
+type SQSClient interface {
+	ChangeMessageVisibility(
+		ctx context.Context,
+		params *sqs.ChangeMessageVisibilityInput,
+		optFns ...func(*sqs.Options),
+	) (*sqs.ChangeMessageVisibilityOutput, error)
+	SendMessage(
+		ctx context.Context,
+		params *sqs.SendMessageInput,
+		optFns ...func(*sqs.Options),
+	) (*sqs.SendMessageOutput, error)
+}
+
+type BackoffConfig struct {
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// DeadLetterQueueURL receives messages which failed with a runner.PermanentError.
+	DeadLetterQueueURL string
+}
+
+var DefaultBackoffConfig = BackoffConfig{
+	BaseDelay: 10 * time.Second,
+	MaxDelay:  15 * time.Minute,
+}
+
+// WithBackoff delays the redelivery of a failed message exponentially by its receive count,
+// instead of the queue's fixed visibility timeout. Messages failed with a runner.PermanentError
+// are sent to the dead letter queue and removed from the source queue.
+func WithBackoff(h SQSEventHandler, client SQSClient, config *BackoffConfig, logger *zap.Logger) SQSEventHandler {
+	return func(ctx context.Context, event events.SQSEvent) error {
+		err := h(ctx, event)
+		if err == nil || len(event.Records) != 1 {
+			return err
+		}
+
+		record := event.Records[0]
+		if runner.IsPermanentError(err) && config.DeadLetterQueueURL != "" {
+			_, dlqErr := client.SendMessage(ctx, &sqs.SendMessageInput{
+				QueueUrl:    aws.String(config.DeadLetterQueueURL),
+				MessageBody: aws.String(record.Body),
+				MessageAttributes: map[string]types.MessageAttributeValue{
+					errorAttribute: {DataType: aws.String("String"), StringValue: aws.String(err.Error())},
+				},
+			})
+
+			if dlqErr == nil {
+				logger.Error(fmt.Sprintf("message (%v) sent to dead letter queue: %v", record.MessageId, err))
+				return nil
+			}
+
+			logger.Error(fmt.Sprintf("failed to send message (%v) to dead letter queue: %v", record.MessageId, dlqErr))
+		}
+
+		queueURL, urlErr := getQueueURL(record.EventSourceARN)
+		if urlErr != nil {
+			logger.Error(urlErr.Error())
+			return err
+		}
+
+		delay := getVisibilityTimeout(config, getReceiveCount(record))
+		_, visibilityErr := client.ChangeMessageVisibility(ctx, &sqs.ChangeMessageVisibilityInput{
+			QueueUrl:          aws.String(queueURL),
+			ReceiptHandle:     aws.String(record.ReceiptHandle),
+			VisibilityTimeout: int32(delay / time.Second),
+		})
+
+		if visibilityErr != nil {
+			logger.Error(fmt.Sprintf("failed to change message (%v) visibility: %v", record.MessageId, visibilityErr))
+			return err
+		}
+
+		logger.Info(fmt.Sprintf("message (%v) will be retried in %v", record.MessageId, delay))
+		return err
+	}
+}
+
+func getReceiveCount(record events.SQSMessage) int {
+	count, err := strconv.Atoi(record.Attributes[receiveCountAttribute])
+	if err != nil || count < 1 {
+		return 1
+	}
+
+	return count
+}
+
+func getVisibilityTimeout(config *BackoffConfig, receiveCount int) time.Duration {
+	max := config.MaxDelay
+	if max <= 0 || max > maxVisibilityTimeout {
+		max = maxVisibilityTimeout
+	}
+
+	d := config.BaseDelay
+	for i := 1; i < receiveCount && d < max; i++ {
+		d *= 2
+	}
+
+	if d > max {
+		return max
+	}
+
+	return d
+}
+
+// getQueueURL converts a queue ARN (arn:partition:sqs:region:account:name) to its queue URL.
+func getQueueURL(arn string) (string, error) {
+	parts := strings.Split(arn, ":")
+	if len(parts) != 6 || parts[2] != "sqs" {
+		return "", fmt.Errorf("invalid sqs queue arn: %v", arn)
+	}
+
+	domain := "amazonaws.com"
+	if parts[1] == "aws-cn" {
+		domain = "amazonaws.com.cn"
+	}
+
+	return fmt.Sprintf("https://sqs.%v.%v/%v/%v", parts[3], domain, parts[4], parts[5]), nil
+}
@@ -0,0 +1,188 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-lambda-go/events"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestWithBackoff(t *testing.T) {
+	queueARN := "arn:aws:sqs:ap-southeast-2:123456789012:launcher"
+	queueURL := "https://sqs.ap-southeast-2.amazonaws.com/123456789012/launcher"
+	config := &BackoffConfig{
+		BaseDelay:          10 * time.Second,
+		MaxDelay:           time.Minute,
+		DeadLetterQueueURL: "https://sqs.ap-southeast-2.amazonaws.com/123456789012/launcher-dlq",
+	}
+	cases := map[string]struct {
+		handlerErr         error
+		receiveCount       string
+		sendErr            error
+		visibilityErr      error
+		expectedVisibility *sqs.ChangeMessageVisibilityInput
+		expectedDLQ        bool
+		err                error
+	}{
+		"handled message": {},
+		"first failure": {
+			handlerErr:   errors.New("some error"),
+			receiveCount: "1",
+			expectedVisibility: &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueURL),
+				ReceiptHandle:     aws.String("receipt"),
+				VisibilityTimeout: 10,
+			},
+			err: errors.New("some error"),
+		},
+		"third failure": {
+			handlerErr:   &runner.RetryableError{Err: errors.New("throttled")},
+			receiveCount: "3",
+			expectedVisibility: &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueURL),
+				ReceiptHandle:     aws.String("receipt"),
+				VisibilityTimeout: 40,
+			},
+			err: &runner.RetryableError{Err: errors.New("throttled")},
+		},
+		"delay capped": {
+			handlerErr:   errors.New("some error"),
+			receiveCount: "20",
+			expectedVisibility: &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueURL),
+				ReceiptHandle:     aws.String("receipt"),
+				VisibilityTimeout: 60,
+			},
+			err: errors.New("some error"),
+		},
+		"failed to change visibility": {
+			handlerErr:    errors.New("some error"),
+			receiveCount:  "1",
+			visibilityErr: errors.New("access denied"),
+			expectedVisibility: &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueURL),
+				ReceiptHandle:     aws.String("receipt"),
+				VisibilityTimeout: 10,
+			},
+			err: errors.New("some error"),
+		},
+		"permanent error sent to dead letter queue": {
+			handlerErr:   &runner.PermanentError{Err: errors.New("invalid")},
+			receiveCount: "1",
+			expectedDLQ:  true,
+		},
+		"failed to send to dead letter queue": {
+			handlerErr:   &runner.PermanentError{Err: errors.New("invalid")},
+			receiveCount: "1",
+			sendErr:      errors.New("access denied"),
+			expectedDLQ:  true,
+			expectedVisibility: &sqs.ChangeMessageVisibilityInput{
+				QueueUrl:          aws.String(queueURL),
+				ReceiptHandle:     aws.String("receipt"),
+				VisibilityTimeout: 10,
+			},
+			err: &runner.PermanentError{Err: errors.New("invalid")},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedSQSClient{sendErr: tc.sendErr, visibilityErr: tc.visibilityErr}
+			h := func(_ context.Context, _ events.SQSEvent) error {
+				return tc.handlerErr
+			}
+
+			err := WithBackoff(h, client, config, zap.NewNop())(context.TODO(), events.SQSEvent{
+				Records: []events.SQSMessage{
+					{
+						MessageId:      "1",
+						ReceiptHandle:  "receipt",
+						Body:           "body",
+						EventSourceARN: queueARN,
+						Attributes:     map[string]string{receiveCountAttribute: tc.receiveCount},
+					},
+				},
+			})
+
+			a.Equal(tc.err, err)
+			a.Equal(tc.expectedVisibility, client.visibilityInput)
+
+			if !tc.expectedDLQ {
+				a.Nil(client.sendInput)
+				return
+			}
+
+			a.Equal(config.DeadLetterQueueURL, *client.sendInput.QueueUrl)
+			a.Equal("body", *client.sendInput.MessageBody)
+			a.Equal(tc.handlerErr.Error(), *client.sendInput.MessageAttributes[errorAttribute].StringValue)
+		})
+	}
+}
+
+func TestGetQueueURL(t *testing.T) {
+	cases := map[string]struct {
+		arn      string
+		expected string
+		errMsg   string
+	}{
+		"aws partition": {
+			arn:      "arn:aws:sqs:us-east-1:123456789012:queue",
+			expected: "https://sqs.us-east-1.amazonaws.com/123456789012/queue",
+		},
+		"china partition": {
+			arn:      "arn:aws-cn:sqs:cn-north-1:123456789012:queue",
+			expected: "https://sqs.cn-north-1.amazonaws.com.cn/123456789012/queue",
+		},
+		"invalid arn": {
+			arn:    "arn:aws:sns:us-east-1:123456789012",
+			errMsg: "invalid sqs queue arn: arn:aws:sns:us-east-1:123456789012",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			url, err := getQueueURL(tc.arn)
+			if tc.errMsg != "" {
+				a.EqualError(err, tc.errMsg)
+				return
+			}
+
+			a.Nil(err)
+			a.Equal(tc.expected, url)
+		})
+	}
+}
+
+type mockedSQSClient struct {
+	visibilityInput *sqs.ChangeMessageVisibilityInput
+	visibilityErr   error
+	sendInput       *sqs.SendMessageInput
+	sendErr         error
+}
+
+func (m *mockedSQSClient) ChangeMessageVisibility(
+	_ context.Context,
+	params *sqs.ChangeMessageVisibilityInput,
+	_ ...func(*sqs.Options),
+) (*sqs.ChangeMessageVisibilityOutput, error) {
+	m.visibilityInput = params
+	return new(sqs.ChangeMessageVisibilityOutput), m.visibilityErr
+}
+
+func (m *mockedSQSClient) SendMessage(
+	_ context.Context,
+	params *sqs.SendMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageOutput, error) {
+	m.sendInput = params
+	return new(sqs.SendMessageOutput), m.sendErr
+}
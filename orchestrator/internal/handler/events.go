@@ -1,22 +1,34 @@
 package handler
 
 import (
+	"context"
 	"encoding/json"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LaunchEvent struct {
 	Message *runner.LaunchInput
+	// MessageID is the SNS message ID, the duplicate deliveries of a notification share it. It's empty
+	// for the transports which don't publish through SNS.
+	MessageID string
+	// SpanContext is the publisher span which published the message.
+	SpanContext trace.SpanContext
 }
 
 func (l *LaunchEvent) UnmarshalJSON(data []byte) error {
 	msg := new(runner.LaunchInput)
-	if err := unmarshalEvent(data, msg); err != nil {
+	id, sc, err := unmarshalEvent(data, msg)
+	if err != nil {
 		return err
 	}
 
 	l.Message = msg
+	l.MessageID = id
+	l.SpanContext = sc
 	return nil
 }
 
@@ -25,27 +37,45 @@ type TerminationInput struct {
 }
 
 type TerminationEvent struct {
-	Message *TerminationInput
+	Message     *TerminationInput
+	SpanContext trace.SpanContext
 }
 
 func (l *TerminationEvent) UnmarshalJSON(data []byte) error {
 	msg := new(TerminationInput)
-	if err := unmarshalEvent(data, msg); err != nil {
+	_, sc, err := unmarshalEvent(data, msg)
+	if err != nil {
 		return err
 	}
 
 	l.Message = msg
+	l.SpanContext = sc
 	return nil
 }
 
-func unmarshalEvent(data []byte, o interface{}) error {
+type snsMessageAttribute struct {
+	Type  string
+	Value string
+}
+
+// unmarshalEvent unmarshals the SNS notification message, and returns its message ID and the trace
+// context the publisher propagated as message attributes.
+func unmarshalEvent(data []byte, o interface{}) (string, trace.SpanContext, error) {
 	raw := new(struct {
-		Message string
+		MessageID         string `json:"MessageId"`
+		Message           string
+		MessageAttributes map[string]snsMessageAttribute
 	})
 
 	if err := json.Unmarshal(data, raw); err != nil {
-		return err
+		return "", trace.SpanContext{}, err
+	}
+
+	carrier := make(propagation.MapCarrier, len(raw.MessageAttributes))
+	for k, v := range raw.MessageAttributes {
+		carrier[k] = v.Value
 	}
 
-	return json.Unmarshal([]byte(raw.Message), o)
+	sc := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), carrier))
+	return raw.MessageID, sc, json.Unmarshal([]byte(raw.Message), o)
 }
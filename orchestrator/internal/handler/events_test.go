@@ -6,6 +6,9 @@ import (
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestLaunchEvent_UnmarshalJSON(t *testing.T) {
@@ -23,6 +26,13 @@ func TestLaunchEvent_UnmarshalJSON(t *testing.T) {
 				Labels:     []string{"ubuntu"},
 			}},
 		},
+		"unmarshal launch event with message id": {
+			input: []byte(`{"MessageId":"sns-1","Message":"{\"ID\":1}"}`),
+			expected: &LaunchEvent{
+				Message:   &runner.LaunchInput{ID: 1},
+				MessageID: "sns-1",
+			},
+		},
 		"invalid json input": {
 			input:   []byte(`{`),
 			errType: new(json.SyntaxError),
@@ -86,3 +96,41 @@ func TestTerminationEvent_UnmarshalJSON(t *testing.T) {
 		})
 	}
 }
+
+func TestUnmarshalEventWithTraceContext(t *testing.T) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	traceID, _ := trace.TraceIDFromHex("4bf92f3577b34da6a3ce929d0e0e4736")
+	spanID, _ := trace.SpanIDFromHex("00f067aa0ba902b7")
+
+	cases := map[string]struct {
+		input    []byte
+		expected trace.SpanContext
+	}{
+		"extract trace context from message attributes": {
+			input: []byte(`{"Message":"{\"ID\":1}","MessageAttributes":{"traceparent":{"Type":"String","Value":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}}`),
+			expected: trace.NewSpanContext(trace.SpanContextConfig{
+				TraceID:    traceID,
+				SpanID:     spanID,
+				TraceFlags: trace.FlagsSampled,
+				Remote:     true,
+			}),
+		},
+		"message without trace context": {
+			input: []byte(`{"Message":"{\"ID\":1}"}`),
+		},
+		"invalid trace context": {
+			input: []byte(`{"Message":"{\"ID\":1}","MessageAttributes":{"traceparent":{"Type":"String","Value":"invalid"}}}`),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			res := new(TerminationEvent)
+
+			a.Nil(json.Unmarshal(tc.input, res))
+			a.Equal(&TerminationInput{ID: 1}, res.Message)
+			a.Equal(tc.expected, res.SpanContext)
+		})
+	}
+}
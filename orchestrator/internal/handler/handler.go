@@ -5,9 +5,13 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel"
 )
 
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/orchestrator/internal/handler")
+
 type SQSEventHandler func(ctx context.Context, event events.SQSEvent) error
 
 func getSQSEventMessage(event events.SQSEvent) (string, error) {
@@ -24,5 +28,10 @@ func getInput(event events.SQSEvent, input interface{}) error {
 		return err
 	}
 
-	return json.Unmarshal([]byte(msg), input)
+	// a malformed message will never be processed, retrying it only delays the dead letter queue.
+	if err := json.Unmarshal([]byte(msg), input); err != nil {
+		return &runner.PermanentError{Err: err}
+	}
+
+	return nil
 }
@@ -5,20 +5,37 @@ import (
 	"fmt"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 func SetupLauncherHandler(launcher runner.Launcher, logger *zap.Logger) SQSEventHandler {
-	return func(ctx context.Context, event events.SQSEvent) error {
+	return func(ctx context.Context, event events.SQSEvent) (err error) {
 		input := new(LaunchEvent)
 		if inputErr := getInput(event, input); inputErr != nil {
 			return inputErr
 		}
 
+		// a duplicate SNS delivery is a new SQS message, so the delivery is identified by the SNS message
+		// ID, and by the SQS message ID for the transports which send to SQS directly.
+		input.Message.DeliveryID = input.MessageID
+		if input.Message.DeliveryID == "" {
+			input.Message.DeliveryID = event.Records[0].MessageId
+		}
+
+		ctx, span := tracer.Start(
+			trace.ContextWithRemoteSpanContext(ctx, input.SpanContext),
+			"launcher.Launch",
+			trace.WithAttributes(attribute.Int64("job.id", int64(input.Message.ID))),
+		)
+		defer func() { tracing.End(span, err) }()
+
 		logger.Info(fmt.Sprintf("launching runner with ID (%v)", input.Message.ID))
 
-		err := launcher.Launch(ctx, input.Message)
+		err = launcher.Launch(ctx, input.Message)
 		if err != nil && runner.IsAlreadyExistsError(err) {
 			logger.Info(fmt.Sprintf(`runner with ID (%v) already exists`, input.Message.ID))
 			return nil
@@ -7,6 +7,12 @@ import (
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
 	"github.com/aws/aws-lambda-go/events"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 )
@@ -34,7 +40,7 @@ func TestSetupLauncherHandler(t *testing.T) {
 			event: events.SQSEvent{Records: []events.SQSMessage{
 				{Body: `{`},
 			}},
-			errMsg: `unexpected end of JSON input`,
+			errMsg: `permanent error: unexpected end of JSON input`,
 		},
 		"one sqs message": {
 			event: events.SQSEvent{Records: []events.SQSMessage{
@@ -81,12 +87,75 @@ func TestSetupLauncherHandler(t *testing.T) {
 	}
 }
 
+func TestSetupLauncherHandlerSpan(t *testing.T) {
+	a := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	launcher := new(mockedLauncher)
+	err := SetupLauncherHandler(launcher, zap.NewNop())(context.TODO(), events.SQSEvent{Records: []events.SQSMessage{
+		{MessageId: "message-1", Body: `{"Message":"{\"ID\":1}","MessageAttributes":{"traceparent":{"Type":"String","Value":"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"}}}`},
+	}})
+	a.Nil(err)
+
+	spans := recorder.Ended()
+	a.Len(spans, 1)
+	a.Equal("launcher.Launch", spans[0].Name())
+	a.Equal("4bf92f3577b34da6a3ce929d0e0e4736", spans[0].Parent().TraceID().String())
+	a.Equal("00f067aa0ba902b7", spans[0].Parent().SpanID().String())
+	a.True(spans[0].Parent().IsRemote())
+	a.Equal([]attribute.KeyValue{attribute.Int64("job.id", 1)}, spans[0].Attributes())
+	a.Equal(spans[0].SpanContext(), trace.SpanContextFromContext(launcher.ctx))
+	a.Equal("message-1", launcher.input.DeliveryID)
+}
+
+func TestSetupLauncherHandlerDeliveryID(t *testing.T) {
+	cases := map[string]struct {
+		records  []events.SQSMessage
+		expected []string
+	}{
+		"duplicate sns deliveries share the sns message id": {
+			records: []events.SQSMessage{
+				{MessageId: "sqs-1", Body: `{"MessageId":"sns-1","Message":"{\"ID\":1}"}`},
+				{MessageId: "sqs-2", Body: `{"MessageId":"sns-1","Message":"{\"ID\":1}"}`},
+			},
+			expected: []string{"sns-1", "sns-1"},
+		},
+		"sqs deliveries without sns message id": {
+			records: []events.SQSMessage{
+				{MessageId: "sqs-1", Body: `{"Message":"{\"ID\":1}"}`},
+				{MessageId: "sqs-1", Body: `{"Message":"{\"ID\":1}"}`},
+			},
+			expected: []string{"sqs-1", "sqs-1"},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			launcher := new(mockedLauncher)
+			h := SetupLauncherHandler(launcher, zap.NewNop())
+
+			ids := make([]string, 0)
+			for _, r := range tc.records {
+				a.Nil(h(context.TODO(), events.SQSEvent{Records: []events.SQSMessage{r}}))
+				ids = append(ids, launcher.input.DeliveryID)
+			}
+
+			a.Equal(tc.expected, ids)
+		})
+	}
+}
+
 type mockedLauncher struct {
+	ctx       context.Context
 	input     *runner.LaunchInput
 	launchErr error
 }
 
-func (m *mockedLauncher) Launch(_ context.Context, input *runner.LaunchInput) error {
+func (m *mockedLauncher) Launch(ctx context.Context, input *runner.LaunchInput) error {
+	m.ctx = ctx
 	m.input = input
 	return m.launchErr
 }
@@ -5,20 +5,30 @@ import (
 	"fmt"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/events"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
 func SetupTerminatorHandler(terminator runner.Terminator, logger *zap.Logger) SQSEventHandler {
-	return func(ctx context.Context, event events.SQSEvent) error {
+	return func(ctx context.Context, event events.SQSEvent) (err error) {
 		input := new(TerminationEvent)
 		if inputErr := getInput(event, input); inputErr != nil {
 			return inputErr
 		}
 
+		ctx, span := tracer.Start(
+			trace.ContextWithRemoteSpanContext(ctx, input.SpanContext),
+			"terminator.Terminate",
+			trace.WithAttributes(attribute.Int64("job.id", int64(input.Message.ID))),
+		)
+		defer func() { tracing.End(span, err) }()
+
 		logger.Info(fmt.Sprintf("terminating runner with ID (%v)", input.Message.ID))
 
-		err := terminator.Terminate(ctx, input.Message.ID)
+		err = terminator.Terminate(ctx, input.Message.ID)
 		if err != nil && runner.IsNotExistsError(err) {
 			logger.Info(fmt.Sprintf(`runner with ID (%v) not exists`, input.Message.ID))
 			return nil
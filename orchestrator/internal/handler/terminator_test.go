@@ -34,7 +34,7 @@ func TestSetupTerminatorHandler(t *testing.T) {
 			event: events.SQSEvent{Records: []events.SQSMessage{
 				{Body: `{`},
 			}},
-			eventErrMsg: `unexpected end of JSON input`,
+			eventErrMsg: `permanent error: unexpected end of JSON input`,
 		},
 		"one sqs message": {
 			event: events.SQSEvent{Records: []events.SQSMessage{
@@ -0,0 +1,119 @@
+package metrics
+
+import (
+	"context"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+)
+
+const (
+	RunnerTypeDimension = "RunnerType"
+	OSDimension         = "OS"
+	outcomeDimension    = "Outcome"
+)
+
+type launcher struct {
+	launcher   runner.Launcher
+	recorder   telemetry.Recorder
+	dimensions telemetry.Dimensions
+	now        func() time.Time
+}
+
+func (l *launcher) Launch(ctx context.Context, input *runner.LaunchInput) error {
+	start := l.now()
+	err := l.launcher.Launch(ctx, input)
+
+	l.recorder.Put(
+		withOutcome(l.dimensions, err),
+		telemetry.Metric{Name: "Launches", Value: 1, Unit: telemetry.Count},
+		telemetry.Metric{Name: "LaunchLatency", Value: milliseconds(l.now().Sub(start)), Unit: telemetry.Milliseconds},
+	)
+
+	if runner.IsAlreadyExistsError(err) {
+		l.recorder.Put(l.dimensions, telemetry.Metric{Name: "RunnerAlreadyExists", Value: 1, Unit: telemetry.Count})
+	}
+
+	return err
+}
+
+// NewLauncher records the latency and outcome of every launch, dimensions usually contain the
+// RunnerType and OS.
+func NewLauncher(l runner.Launcher, recorder telemetry.Recorder, dimensions telemetry.Dimensions) runner.Launcher {
+	return &launcher{
+		launcher:   l,
+		recorder:   recorder,
+		dimensions: dimensions,
+		now:        time.Now,
+	}
+}
+
+type terminator struct {
+	terminator runner.Terminator
+	recorder   telemetry.Recorder
+	dimensions telemetry.Dimensions
+	now        func() time.Time
+}
+
+func (t *terminator) Terminate(ctx context.Context, id uint64) error {
+	start := t.now()
+	err := t.terminator.Terminate(ctx, id)
+
+	t.recorder.Put(
+		withOutcome(t.dimensions, err),
+		telemetry.Metric{Name: "Terminations", Value: 1, Unit: telemetry.Count},
+		telemetry.Metric{Name: "TerminateLatency", Value: milliseconds(t.now().Sub(start)), Unit: telemetry.Milliseconds},
+	)
+
+	if runner.IsNotExistsError(err) {
+		t.recorder.Put(t.dimensions, telemetry.Metric{Name: "RunnerNotExists", Value: 1, Unit: telemetry.Count})
+	}
+
+	return err
+}
+
+// NewTerminator records the latency and outcome of every termination.
+func NewTerminator(t runner.Terminator, recorder telemetry.Recorder, dimensions telemetry.Dimensions) runner.Terminator {
+	return &terminator{
+		terminator: t,
+		recorder:   recorder,
+		dimensions: dimensions,
+		now:        time.Now,
+	}
+}
+
+func withOutcome(dimensions telemetry.Dimensions, err error) telemetry.Dimensions {
+	d := make(telemetry.Dimensions, len(dimensions)+1)
+	for k, v := range dimensions {
+		d[k] = v
+	}
+
+	d[outcomeDimension] = getOutcome(err)
+	return d
+}
+
+func getOutcome(err error) string {
+	switch {
+	case err == nil:
+		return "success"
+	case runner.IsAlreadyExistsError(err):
+		return "already_exists"
+	case runner.IsNotExistsError(err):
+		return "not_exists"
+	case runner.IsCleanupNotConfirmedError(err):
+		return "cleanup_not_confirmed"
+	case runner.IsQuotaError(err):
+		return "quota"
+	case runner.IsPermanentError(err):
+		return "permanent"
+	case runner.IsRetryableError(err):
+		return "retryable"
+	default:
+		return "error"
+	}
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
@@ -0,0 +1,156 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	telemetry "github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLauncher_Launch(t *testing.T) {
+	launched := func(outcome string) put {
+		return put{
+			dimensions: telemetry.Dimensions{RunnerTypeDimension: "ec2", OSDimension: "ubuntu", outcomeDimension: outcome},
+			metrics: []telemetry.Metric{
+				{Name: "Launches", Value: 1, Unit: telemetry.Count},
+				{Name: "LaunchLatency", Value: 250, Unit: telemetry.Milliseconds},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		err      error
+		expected []put
+	}{
+		"launched": {
+			expected: []put{launched("success")},
+		},
+		"runner already exists": {
+			err: &runner.AlreadyExistsError{ID: 1, Type: "ec2"},
+			expected: []put{
+				launched("already_exists"),
+				{
+					dimensions: telemetry.Dimensions{RunnerTypeDimension: "ec2", OSDimension: "ubuntu"},
+					metrics:    []telemetry.Metric{{Name: "RunnerAlreadyExists", Value: 1, Unit: telemetry.Count}},
+				},
+			},
+		},
+		"quota exceeded": {
+			err:      &runner.QuotaError{Err: errors.New("limit exceeded")},
+			expected: []put{launched("quota")},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			recorder := new(mockedRecorder)
+			input := &runner.LaunchInput{ID: 1}
+			mocked := &mockedLauncher{err: tc.err}
+			l := NewLauncher(mocked, recorder, telemetry.Dimensions{
+				RunnerTypeDimension: "ec2",
+				OSDimension:         "ubuntu",
+			}).(*launcher)
+			l.now = newTestClock(250 * time.Millisecond)
+
+			a.Equal(tc.err, l.Launch(context.TODO(), input))
+			a.Equal(input, mocked.input)
+			a.Equal(tc.expected, recorder.puts)
+		})
+	}
+}
+
+func TestTerminator_Terminate(t *testing.T) {
+	terminated := func(outcome string) put {
+		return put{
+			dimensions: telemetry.Dimensions{RunnerTypeDimension: "eks", outcomeDimension: outcome},
+			metrics: []telemetry.Metric{
+				{Name: "Terminations", Value: 1, Unit: telemetry.Count},
+				{Name: "TerminateLatency", Value: 250, Unit: telemetry.Milliseconds},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		err      error
+		expected []put
+	}{
+		"terminated": {
+			expected: []put{terminated("success")},
+		},
+		"runner not exists": {
+			err: &runner.NotExistsError{ID: 1, Type: "eks"},
+			expected: []put{
+				terminated("not_exists"),
+				{
+					dimensions: telemetry.Dimensions{RunnerTypeDimension: "eks"},
+					metrics:    []telemetry.Metric{{Name: "RunnerNotExists", Value: 1, Unit: telemetry.Count}},
+				},
+			},
+		},
+		"unknown error": {
+			err:      errors.New("some error"),
+			expected: []put{terminated("error")},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			recorder := new(mockedRecorder)
+			mocked := &mockedTerminator{err: tc.err}
+			term := NewTerminator(mocked, recorder, telemetry.Dimensions{RunnerTypeDimension: "eks"}).(*terminator)
+			term.now = newTestClock(250 * time.Millisecond)
+
+			a.Equal(tc.err, term.Terminate(context.TODO(), 1))
+			a.Equal(uint64(1), mocked.id)
+			a.Equal(tc.expected, recorder.puts)
+		})
+	}
+}
+
+// newTestClock advances by step on every call.
+func newTestClock(step time.Duration) func() time.Time {
+	now := time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+	return func() time.Time {
+		now = now.Add(step)
+		return now
+	}
+}
+
+type put struct {
+	dimensions telemetry.Dimensions
+	metrics    []telemetry.Metric
+}
+
+type mockedRecorder struct {
+	puts []put
+}
+
+func (m *mockedRecorder) Put(dimensions telemetry.Dimensions, metrics ...telemetry.Metric) {
+	m.puts = append(m.puts, put{dimensions: dimensions, metrics: metrics})
+}
+
+type mockedLauncher struct {
+	input *runner.LaunchInput
+	err   error
+}
+
+func (m *mockedLauncher) Launch(_ context.Context, input *runner.LaunchInput) error {
+	m.input = input
+	return m.err
+}
+
+type mockedTerminator struct {
+	id  uint64
+	err error
+}
+
+func (m *mockedTerminator) Terminate(_ context.Context, id uint64) error {
+	m.id = id
+	return m.err
+}
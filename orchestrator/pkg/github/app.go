@@ -0,0 +1,152 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+)
+
+const (
+	// jwtClockDrift backdates the app token, GitHub rejects tokens issued in its future.
+	jwtClockDrift = time.Minute
+	jwtExpiry     = 9 * time.Minute
+)
+
+// installationPermissions limits the installation token to managing self-hosted runners.
+var installationPermissions = map[string]map[string]string{
+	"repos": {"administration": "write"},
+	"orgs":  {"organization_self_hosted_runners": "write"},
+}
+
+type appAuthorizer struct {
+	client *http.Client
+	apiURL string
+	appID  string
+	key    *rsa.PrivateKey
+}
+
+// authorize exchanges the app token for an installation token, scoped to the repository of the
+// runner and to the runner permissions only.
+func (a *appAuthorizer) authorize(ctx context.Context, path string) (string, error) {
+	jwt, jwtErr := a.getJWT()
+	if jwtErr != nil {
+		return "", jwtErr
+	}
+
+	auth := fmt.Sprintf("Bearer %v", jwt)
+	apiURL := strings.TrimSuffix(a.apiURL, "/")
+
+	installation := new(struct {
+		ID int64 `json:"id"`
+	})
+
+	if err := doRequest(ctx, a.client, http.MethodGet,
+		fmt.Sprintf("%v/%v/installation", apiURL, path), auth, nil, installation,
+	); err != nil {
+		return "", fmt.Errorf("failed to get installation for %v: %w", path, err)
+	}
+
+	scope := strings.SplitN(path, "/", 3)
+	req := map[string]interface{}{"permissions": installationPermissions[scope[0]]}
+	if len(scope) == 3 {
+		req["repositories"] = []string{scope[2]}
+	}
+
+	token := new(struct {
+		Token string `json:"token"`
+	})
+
+	if err := doRequest(ctx, a.client, http.MethodPost,
+		fmt.Sprintf("%v/app/installations/%v/access_tokens", apiURL, installation.ID), auth, req, token,
+	); err != nil {
+		return "", fmt.Errorf("failed to create installation token for %v: %w", path, err)
+	}
+
+	return fmt.Sprintf("token %v", token.Token), nil
+}
+
+func (a *appAuthorizer) getJWT() (string, error) {
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iat": now.Add(-jwtClockDrift).Unix(),
+		"exp": now.Add(jwtExpiry).Unix(),
+		"iss": a.appID,
+	})
+
+	unsigned := fmt.Sprintf("%v.%v",
+		base64.RawURLEncoding.EncodeToString(header),
+		base64.RawURLEncoding.EncodeToString(claims),
+	)
+
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, a.key, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%v.%v", unsigned, base64.RawURLEncoding.EncodeToString(signature)), nil
+}
+
+// ParsePrivateKey parses the PEM encoded GitHub App private key.
+func ParsePrivateKey(data []byte) (*rsa.PrivateKey, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("invalid private key, no PEM data found")
+	}
+
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, errors.New("invalid private key, not a RSA key")
+	}
+
+	return rsaKey, nil
+}
+
+// NewAppTokenProvider issues the runner tokens as a GitHub App installation, so the launcher
+// doesn't need a personal access token of the organisation.
+func NewAppTokenProvider(
+	client *http.Client,
+	apiURL string,
+	appID string,
+	key *rsa.PrivateKey,
+) runner.RegistrationTokenProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	a := &appAuthorizer{
+		client: client,
+		apiURL: apiURL,
+		appID:  appID,
+		key:    key,
+	}
+
+	return &tokenProvider{
+		client:    client,
+		apiURL:    apiURL,
+		authorize: a.authorize,
+	}
+}
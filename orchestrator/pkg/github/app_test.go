@@ -0,0 +1,154 @@
+package github
+
+import (
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAppTokenProvider_RegistrationToken(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	cases := map[string]struct {
+		repository          string
+		installationStatus  int
+		expectedPaths       []string
+		expectedAccessToken string
+		expected            string
+		errMsg              string
+	}{
+		"repository registration token": {
+			repository:         "repo",
+			installationStatus: http.StatusOK,
+			expectedPaths: []string{
+				"GET /repos/owner/repo/installation",
+				"POST /app/installations/1/access_tokens",
+				"POST /repos/owner/repo/actions/runners/registration-token",
+			},
+			expectedAccessToken: `{"permissions":{"administration":"write"},"repositories":["repo"]}`,
+			expected:            "registration-token",
+		},
+		"organisation registration token": {
+			installationStatus: http.StatusOK,
+			expectedPaths: []string{
+				"GET /orgs/owner/installation",
+				"POST /app/installations/1/access_tokens",
+				"POST /orgs/owner/actions/runners/registration-token",
+			},
+			expectedAccessToken: `{"permissions":{"organization_self_hosted_runners":"write"}}`,
+			expected:            "registration-token",
+		},
+		"app not installed": {
+			repository:         "repo",
+			installationStatus: http.StatusNotFound,
+			expectedPaths:      []string{"GET /repos/owner/repo/installation"},
+			errMsg:             "failed to get installation for repos/owner/repo: status code: 404",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			paths := make([]string, 0)
+			accessToken := ""
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				paths = append(paths, r.Method+" "+r.URL.Path)
+				switch {
+				case strings.HasSuffix(r.URL.Path, "/installation"):
+					assertJWT(a, &key.PublicKey, r.Header.Get("Authorization"))
+					w.WriteHeader(tc.installationStatus)
+					_, _ = w.Write([]byte(`{"id":1}`))
+				case strings.HasSuffix(r.URL.Path, "/access_tokens"):
+					assertJWT(a, &key.PublicKey, r.Header.Get("Authorization"))
+					a.Equal("application/json", r.Header.Get("Content-Type"))
+					b, _ := io.ReadAll(r.Body)
+					accessToken = string(b)
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{"token":"installation-token"}`))
+				default:
+					a.Equal("token installation-token", r.Header.Get("Authorization"))
+					w.WriteHeader(http.StatusCreated)
+					_, _ = w.Write([]byte(`{"token":"registration-token"}`))
+				}
+			}))
+			defer server.Close()
+
+			token, err := NewAppTokenProvider(server.Client(), server.URL, "123", key).
+				RegistrationToken(context.TODO(), "owner", tc.repository)
+
+			a.Equal(tc.expectedPaths, paths)
+			if tc.errMsg != "" {
+				a.EqualError(err, tc.errMsg)
+				return
+			}
+
+			a.Nil(err)
+			a.Equal(tc.expected, token)
+			a.JSONEq(tc.expectedAccessToken, accessToken)
+		})
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, _ := rsa.GenerateKey(rand.Reader, 2048)
+	pkcs8, _ := x509.MarshalPKCS8PrivateKey(key)
+	cases := map[string]struct {
+		data   []byte
+		errMsg string
+	}{
+		"pkcs1 key": {
+			data: pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}),
+		},
+		"pkcs8 key": {
+			data: pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: pkcs8}),
+		},
+		"invalid key": {
+			data:   []byte("key"),
+			errMsg: "invalid private key, no PEM data found",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			k, err := ParsePrivateKey(tc.data)
+			if tc.errMsg != "" {
+				a.EqualError(err, tc.errMsg)
+				return
+			}
+
+			a.Nil(err)
+			a.True(key.Equal(k))
+		})
+	}
+}
+
+func assertJWT(a *assert.Assertions, key *rsa.PublicKey, auth string) {
+	parts := strings.Split(strings.TrimPrefix(auth, "Bearer "), ".")
+	if !a.Len(parts, 3) {
+		return
+	}
+
+	digest := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	signature, _ := base64.RawURLEncoding.DecodeString(parts[2])
+	a.Nil(rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature))
+
+	claims := new(struct {
+		Iss string `json:"iss"`
+	})
+	b, _ := base64.RawURLEncoding.DecodeString(parts[1])
+	a.Nil(json.Unmarshal(b, claims))
+	a.Equal("123", claims.Iss)
+}
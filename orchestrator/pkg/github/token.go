@@ -0,0 +1,121 @@
+package github
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+)
+
+const (
+	DefaultAPIURL          = "https://api.github.com"
+	registrationTokenPath  = "registration-token"
+	removalTokenPath       = "remove-token"
+	githubMediaType        = "application/vnd.github.v3+json"
+	jsonMediaType          = "application/json"
+	authorizationHeaderKey = "Authorization"
+)
+
+// authorizer returns the Authorization header of the requests to the runners API of the path.
+type authorizer func(ctx context.Context, path string) (string, error)
+
+type tokenProvider struct {
+	client    *http.Client
+	apiURL    string
+	authorize authorizer
+}
+
+func (p *tokenProvider) RegistrationToken(ctx context.Context, owner, repository string) (string, error) {
+	return p.runnerToken(ctx, owner, repository, registrationTokenPath)
+}
+
+func (p *tokenProvider) RemovalToken(ctx context.Context, owner, repository string) (string, error) {
+	return p.runnerToken(ctx, owner, repository, removalTokenPath)
+}
+
+func (p *tokenProvider) runnerToken(ctx context.Context, owner, repository, kind string) (string, error) {
+	path := getRunnersPath(owner, repository)
+	auth, authErr := p.authorize(ctx, path)
+	if authErr != nil {
+		return "", authErr
+	}
+
+	body := new(struct {
+		Token string `json:"token"`
+	})
+
+	if err := doRequest(ctx, p.client, http.MethodPost,
+		fmt.Sprintf("%v/%v/actions/runners/%v", strings.TrimSuffix(p.apiURL, "/"), path, kind),
+		auth, nil, body,
+	); err != nil {
+		return "", fmt.Errorf("failed to create %v for %v: %w", kind, path, err)
+	}
+
+	return body.Token, nil
+}
+
+func getRunnersPath(owner, repository string) string {
+	if repository != "" {
+		return fmt.Sprintf("repos/%v/%v", owner, repository)
+	}
+
+	return fmt.Sprintf("orgs/%v", owner)
+}
+
+// doRequest sends the JSON request body, and decodes the JSON response into out.
+func doRequest(ctx context.Context, client *http.Client, method, url, auth string, in, out interface{}) error {
+	var body io.Reader = http.NoBody
+	if in != nil {
+		b, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+
+		body = bytes.NewReader(b)
+	}
+
+	req, reqErr := http.NewRequestWithContext(ctx, method, url, body)
+	if reqErr != nil {
+		return reqErr
+	}
+
+	req.Header.Set("Accept", githubMediaType)
+	if in != nil {
+		req.Header.Set("Content-Type", jsonMediaType)
+	}
+
+	req.Header.Set(authorizationHeaderKey, auth)
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return fmt.Errorf("status code: %v", resp.StatusCode)
+	}
+
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// NewTokenProvider issues the runner tokens with a personal access token.
+func NewTokenProvider(client *http.Client, apiURL, token string) runner.RegistrationTokenProvider {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return &tokenProvider{
+		client: client,
+		apiURL: apiURL,
+		authorize: func(context.Context, string) (string, error) {
+			return fmt.Sprintf("token %v", token), nil
+		},
+	}
+}
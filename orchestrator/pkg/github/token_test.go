@@ -0,0 +1,101 @@
+package github
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTokenProvider_RegistrationToken(t *testing.T) {
+	cases := map[string]struct {
+		owner        string
+		repository   string
+		status       int
+		body         string
+		expectedPath string
+		expected     string
+		errMsg       string
+	}{
+		"repository registration token": {
+			owner:        "owner",
+			repository:   "repo",
+			status:       http.StatusCreated,
+			body:         `{"token":"registration-token","expires_at":"2020-01-22T12:13:35.123-08:00"}`,
+			expectedPath: "/repos/owner/repo/actions/runners/registration-token",
+			expected:     "registration-token",
+		},
+		"organisation registration token": {
+			owner:        "owner",
+			status:       http.StatusCreated,
+			body:         `{"token":"registration-token"}`,
+			expectedPath: "/orgs/owner/actions/runners/registration-token",
+			expected:     "registration-token",
+		},
+		"unauthorized": {
+			owner:        "owner",
+			repository:   "repo",
+			status:       http.StatusUnauthorized,
+			expectedPath: "/repos/owner/repo/actions/runners/registration-token",
+			errMsg:       "failed to create registration-token for repos/owner/repo: status code: 401",
+		},
+		"invalid response": {
+			owner:        "owner",
+			repository:   "repo",
+			status:       http.StatusCreated,
+			body:         `{`,
+			expectedPath: "/repos/owner/repo/actions/runners/registration-token",
+			errMsg:       "failed to create registration-token for repos/owner/repo: unexpected EOF",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			var req *http.Request
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				req = r
+				w.WriteHeader(tc.status)
+				_, _ = w.Write([]byte(tc.body))
+			}))
+			defer server.Close()
+
+			token, err := NewTokenProvider(server.Client(), server.URL, "pat").
+				RegistrationToken(context.TODO(), tc.owner, tc.repository)
+
+			a.Equal(http.MethodPost, req.Method)
+			a.Equal(tc.expectedPath, req.URL.Path)
+			a.Equal("token pat", req.Header.Get("Authorization"))
+			a.Empty(req.Header.Get("Content-Type"))
+
+			if tc.errMsg != "" {
+				a.EqualError(err, tc.errMsg)
+				return
+			}
+
+			a.Nil(err)
+			a.Equal(tc.expected, token)
+		})
+	}
+}
+
+func TestTokenProvider_RemovalToken(t *testing.T) {
+	a := assert.New(t)
+	var req *http.Request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req = r
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"token":"removal-token"}`))
+	}))
+	defer server.Close()
+
+	token, err := NewTokenProvider(server.Client(), server.URL, "pat").
+		RemovalToken(context.TODO(), "owner", "repo")
+
+	a.Nil(err)
+	a.Equal("removal-token", token)
+	a.Equal(http.MethodPost, req.Method)
+	a.Equal("/repos/owner/repo/actions/runners/remove-token", req.URL.Path)
+}
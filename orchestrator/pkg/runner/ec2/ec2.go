@@ -5,9 +5,13 @@ import (
 	"fmt"
 	"strconv"
 
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 const (
@@ -15,33 +19,87 @@ const (
 	RunnerType = "ec2"
 )
 
-func getInstanceIDByTag(
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/ec2")
+
+// activeStates are instance states which still hold a runner, terminated instances keep
+// their tags for a while and must not be treated as existing runners.
+var activeStates = []types.InstanceStateName{
+	types.InstanceStateNamePending,
+	types.InstanceStateNameRunning,
+	types.InstanceStateNameStopping,
+	types.InstanceStateNameStopped,
+}
+
+func getInstancesByTag(
 	client ec2.DescribeInstancesAPIClient,
 	ctx context.Context,
 	tag string,
 	values []string,
-) ([]string, error) {
-	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
-		Filters: []types.Filter{
-			{
-				Name:   aws.String(fmt.Sprintf("tag:%s", tag)),
-				Values: values,
-			},
+	states []types.InstanceStateName,
+) (instances []types.Instance, err error) {
+	ctx, span := tracer.Start(ctx, "ec2.DescribeInstances", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("tag", tag),
+		attribute.StringSlice("values", values),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	filters := []types.Filter{
+		{
+			Name:   aws.String(fmt.Sprintf("tag:%s", tag)),
+			Values: values,
 		},
+	}
+
+	if len(states) != 0 {
+		s := make([]string, 0)
+		for _, i := range states {
+			s = append(s, string(i))
+		}
+
+		filters = append(filters, types.Filter{
+			Name:   aws.String("instance-state-name"),
+			Values: s,
+		})
+	}
+
+	resp, err := client.DescribeInstances(ctx, &ec2.DescribeInstancesInput{
+		Filters: filters,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	ids := make([]string, 0)
+	instances = make([]types.Instance, 0)
 	for _, r := range resp.Reservations {
-		for i := range r.Instances {
-			ids = append(ids, aws.ToString(r.Instances[i].InstanceId))
+		instances = append(instances, r.Instances...)
+	}
+
+	return instances, nil
+}
+
+// isActive treats instances with unknown state as active to avoid launching duplicates.
+func isActive(instance *types.Instance) bool {
+	if instance.State == nil {
+		return true
+	}
+
+	for _, s := range activeStates {
+		if instance.State.Name == s {
+			return true
 		}
 	}
 
-	return ids, nil
+	return false
+}
+
+func getInstanceIDs(instances []types.Instance) []string {
+	ids := make([]string, 0)
+	for i := range instances {
+		ids = append(ids, aws.ToString(instances[i].InstanceId))
+	}
+
+	return ids
 }
 
 func uint64ToString(n uint64) string {
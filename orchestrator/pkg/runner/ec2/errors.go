@@ -0,0 +1,79 @@
+package ec2
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+)
+
+var retryableCodes = map[string]bool{
+	"RequestLimitExceeded":         true,
+	"Throttling":                   true,
+	"ThrottlingException":          true,
+	"InsufficientInstanceCapacity": true,
+	"InternalError":                true,
+	"InternalFailure":              true,
+	"ServiceUnavailable":           true,
+	"Unavailable":                  true,
+	// the instances just launched may not be visible yet, EC2 APIs are eventually consistent.
+	"InvalidInstanceID.NotFound": true,
+}
+
+var quotaCodes = map[string]bool{
+	"InstanceLimitExceeded":             true,
+	"VcpuLimitExceeded":                 true,
+	"MaxSpotInstanceCountExceeded":      true,
+	"InsufficientFreeAddressesInSubnet": true,
+}
+
+// permanentCodes are the configuration and request errors which fail the same way on every retry,
+// codes not listed here, e.g. other Invalid*.NotFound codes, are not permanent.
+var permanentCodes = map[string]bool{
+	"MissingParameter":                        true,
+	"UnauthorizedOperation":                   true,
+	"AuthFailure":                             true,
+	"IdempotentParameterMismatch":             true,
+	"UnsupportedOperation":                    true,
+	"OptInRequired":                           true,
+	"Unsupported":                             true,
+	"InvalidParameter":                        true,
+	"InvalidParameterValue":                   true,
+	"InvalidParameterCombination":             true,
+	"InvalidUserData.Malformed":               true,
+	"InvalidLaunchTemplateId.Malformed":       true,
+	"InvalidLaunchTemplateId.NotFound":        true,
+	"InvalidLaunchTemplateId.VersionNotFound": true,
+	"InvalidSubnetID.Malformed":               true,
+	"InvalidSubnetID.NotFound":                true,
+	"InvalidAMIID.Malformed":                  true,
+}
+
+// ClassifyError classifies EC2 API errors, RunInstances and DescribeInstances share the codes.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	var apiErr smithy.APIError
+	if errors.As(err, &apiErr) {
+		code := apiErr.ErrorCode()
+		switch {
+		case retryableCodes[code]:
+			return &runner.RetryableError{Err: err}
+		case quotaCodes[code]:
+			return &runner.QuotaError{Err: err}
+		case permanentCodes[code]:
+			return &runner.PermanentError{Err: err}
+		}
+	}
+
+	var respErr *smithyhttp.ResponseError
+	if errors.As(err, &respErr) && respErr.HTTPStatusCode() >= http.StatusInternalServerError {
+		return &runner.RetryableError{Err: err}
+	}
+
+	return err
+}
@@ -0,0 +1,79 @@
+package ec2
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/smithy-go"
+	smithyhttp "github.com/aws/smithy-go/transport/http"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClassifyError(t *testing.T) {
+	cases := map[string]struct {
+		err       error
+		retryable bool
+		permanent bool
+		quota     bool
+	}{
+		"request limit exceeded": {
+			err:       &smithy.GenericAPIError{Code: "RequestLimitExceeded"},
+			retryable: true,
+		},
+		"insufficient instance capacity": {
+			err:       &smithy.GenericAPIError{Code: "InsufficientInstanceCapacity"},
+			retryable: true,
+		},
+		"vcpu limit exceeded": {
+			err:   &smithy.GenericAPIError{Code: "VcpuLimitExceeded"},
+			quota: true,
+		},
+		"invalid parameter": {
+			err:       &smithy.GenericAPIError{Code: "InvalidParameterValue"},
+			permanent: true,
+		},
+		"launch template not found": {
+			err:       &smithy.GenericAPIError{Code: "InvalidLaunchTemplateId.NotFound"},
+			permanent: true,
+		},
+		"instance not visible yet": {
+			err:       &smithy.GenericAPIError{Code: "InvalidInstanceID.NotFound"},
+			retryable: true,
+		},
+		"unlisted invalid code": {
+			err: &smithy.GenericAPIError{Code: "InvalidNetworkInterfaceID.NotFound"},
+		},
+		"unauthorized operation": {
+			err:       &smithy.GenericAPIError{Code: "UnauthorizedOperation"},
+			permanent: true,
+		},
+		"server error": {
+			err: &smithyhttp.ResponseError{
+				Response: &smithyhttp.Response{Response: &http.Response{StatusCode: http.StatusBadGateway}},
+				Err:      errors.New("bad gateway"),
+			},
+			retryable: true,
+		},
+		"unknown error": {
+			err: errors.New("some error"),
+		},
+		"runner already exists": {
+			err: &runner.AlreadyExistsError{ID: 1, Type: RunnerType},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			err := ClassifyError(tc.err)
+			a.ErrorIs(err, tc.err)
+			a.Equal(tc.retryable, runner.IsRetryableError(err))
+			a.Equal(tc.permanent, runner.IsPermanentError(err))
+			a.Equal(tc.quota, runner.IsQuotaError(err))
+		})
+	}
+
+	assert.Nil(t, ClassifyError(nil))
+}
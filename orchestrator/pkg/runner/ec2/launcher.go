@@ -3,15 +3,19 @@ package ec2
 import (
 	"bytes"
 	"context"
+	"crypto/sha256"
 	"encoding/base64"
 	"fmt"
 	"strings"
 	"text/template"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
 	"github.com/aws/aws-sdk-go-v2/service/ec2/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type LaunchConfig struct {
@@ -45,22 +49,27 @@ type ec2Launcher struct {
 }
 
 func (l *ec2Launcher) Launch(ctx context.Context, input *runner.LaunchInput) error {
-	ids, rErr := getInstanceIDByTag(l.client, ctx, idTag, []string{uint64ToString(input.ID)})
+	instances, rErr := getInstancesByTag(l.client, ctx, idTag, []string{uint64ToString(input.ID)}, nil)
 
 	if rErr != nil {
 		return rErr
 	}
 
-	if len(ids) != 0 {
-		return &runner.AlreadyExistsError{
-			ID:   input.ID,
-			Type: RunnerType,
+	for i := range instances {
+		if isActive(&instances[i]) {
+			return &runner.AlreadyExistsError{
+				ID:   input.ID,
+				Type: RunnerType,
+			}
 		}
 	}
 
 	i := &ec2.RunInstancesInput{
-		MaxCount: aws.Int32(1),
-		MinCount: aws.Int32(1),
+		// concurrent deliveries of the same message share the client token, so EC2 launches
+		// only one instance, a requeued job is a new message and gets a new token.
+		ClientToken: aws.String(getClientToken(l.runnerNamePrefix, input.ID, input.DeliveryID)),
+		MaxCount:    aws.Int32(1),
+		MinCount:    aws.Int32(1),
 		LaunchTemplate: &types.LaunchTemplateSpecification{
 			LaunchTemplateId: aws.String(l.config.TemplateID),
 			Version:          aws.String(l.config.TemplateVersion),
@@ -96,9 +105,23 @@ func (l *ec2Launcher) Launch(ctx context.Context, input *runner.LaunchInput) err
 		i.UserData = aws.String(base64.StdEncoding.EncodeToString(userData.Bytes()))
 	}
 
-	_, launchErr := l.client.RunInstances(ctx, i)
+	return l.runInstances(ctx, i)
+}
+
+func (l *ec2Launcher) runInstances(ctx context.Context, input *ec2.RunInstancesInput) (err error) {
+	ctx, span := tracer.Start(ctx, "ec2.RunInstances", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.String("client_token", aws.ToString(input.ClientToken)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	_, err = l.client.RunInstances(ctx, input)
+
+	return err
+}
 
-	return launchErr
+// getClientToken hashes the token parts, as EC2 client tokens are limited to 64 characters.
+func getClientToken(prefix string, id uint64, delivery string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(fmt.Sprintf("%v-%v-%v", prefix, id, delivery))))
 }
 
 func NewLauncher(
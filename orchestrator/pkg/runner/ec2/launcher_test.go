@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"strconv"
+	"sync"
 	"testing"
 	"text/template"
 
@@ -22,6 +23,7 @@ func TestEc2Launcher_Launch(t *testing.T) {
 		config                        *LaunchConfig
 		input                         *runner.LaunchInput
 		numInstances                  int
+		numTerminatedInstances        int
 		describeInstancesErr          error
 		expectedRunInstanceInput      *ec2.RunInstancesInput
 		expectedDescribeInstanceInput *ec2.DescribeInstancesInput
@@ -42,6 +44,7 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				Owner:      "owner",
 				Repository: "repo",
 				Labels:     []string{"ec2", "ubuntu"},
+				DeliveryID: "message-1",
 			},
 			expectedDescribeInstanceInput: &ec2.DescribeInstancesInput{
 				Filters: []types.Filter{
@@ -52,8 +55,9 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				},
 			},
 			expectedRunInstanceInput: &ec2.RunInstancesInput{
-				MaxCount: aws.Int32(1),
-				MinCount: aws.Int32(1),
+				ClientToken: aws.String(getClientToken("prefix", 1, "message-1")),
+				MaxCount:    aws.Int32(1),
+				MinCount:    aws.Int32(1),
 				LaunchTemplate: &types.LaunchTemplateSpecification{
 					LaunchTemplateId: aws.String("template-id"),
 					Version:          aws.String("$Latest"),
@@ -75,6 +79,50 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				),
 			},
 		},
+		"relaunch after runner terminated": {
+			config: &LaunchConfig{
+				TemplateID:      "template-id",
+				TemplateVersion: "$Latest",
+				SubnetID:        "subnet-id",
+			},
+			numTerminatedInstances: 2,
+			input: &runner.LaunchInput{
+				ID:         1,
+				Owner:      "owner",
+				Repository: "repo",
+				Labels:     []string{"ec2", "ubuntu"},
+				DeliveryID: "message-2",
+			},
+			expectedDescribeInstanceInput: &ec2.DescribeInstancesInput{
+				Filters: []types.Filter{
+					{
+						Name:   aws.String(fmt.Sprintf("tag:%s", idTag)),
+						Values: []string{"1"},
+					},
+				},
+			},
+			expectedRunInstanceInput: &ec2.RunInstancesInput{
+				ClientToken: aws.String(getClientToken("prefix", 1, "message-2")),
+				MaxCount:    aws.Int32(1),
+				MinCount:    aws.Int32(1),
+				LaunchTemplate: &types.LaunchTemplateSpecification{
+					LaunchTemplateId: aws.String("template-id"),
+					Version:          aws.String("$Latest"),
+				},
+				SubnetId: aws.String("subnet-id"),
+				TagSpecifications: []types.TagSpecification{
+					{
+						ResourceType: types.ResourceTypeInstance,
+						Tags: []types.Tag{
+							{
+								Key:   aws.String(idTag),
+								Value: aws.String("1"),
+							},
+						},
+					},
+				},
+			},
+		},
 		"invalid userdata template": {
 			config: &LaunchConfig{
 				TemplateID:      "template-id",
@@ -90,6 +138,7 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				Owner:      "owner",
 				Repository: "repo",
 				Labels:     []string{"ec2", "ubuntu"},
+				DeliveryID: "message-1",
 			},
 			expectedDescribeInstanceInput: &ec2.DescribeInstancesInput{
 				Filters: []types.Filter{
@@ -111,6 +160,7 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				Owner:      "owner",
 				Repository: "repo",
 				Labels:     []string{"ec2", "ubuntu"},
+				DeliveryID: "message-1",
 			},
 			expectedDescribeInstanceInput: &ec2.DescribeInstancesInput{
 				Filters: []types.Filter{
@@ -132,6 +182,7 @@ func TestEc2Launcher_Launch(t *testing.T) {
 				Owner:      "owner",
 				Repository: "repo",
 				Labels:     []string{"ec2", "ubuntu"},
+				DeliveryID: "message-1",
 			},
 			expectedDescribeInstanceInput: &ec2.DescribeInstancesInput{
 				Filters: []types.Filter{
@@ -149,8 +200,9 @@ func TestEc2Launcher_Launch(t *testing.T) {
 		t.Run(n, func(t *testing.T) {
 			a := assert.New(t)
 			client := &mockedLauncherClient{
-				describeInstancesErr: tc.describeInstancesErr,
-				existsInstancesNum:   tc.numInstances,
+				describeInstancesErr:   tc.describeInstancesErr,
+				existsInstancesNum:     tc.numInstances,
+				terminatedInstancesNum: tc.numTerminatedInstances,
 			}
 
 			a.Equal(tc.err, NewLauncher(runnerPrefix, client, tc.config).Launch(context.TODO(), tc.input))
@@ -160,11 +212,51 @@ func TestEc2Launcher_Launch(t *testing.T) {
 	}
 }
 
+func TestEc2Launcher_LaunchConcurrently(t *testing.T) {
+	a := assert.New(t)
+	client := &mockedIdempotentClient{tokens: make(map[string]string)}
+	client.describing.Add(2)
+	l := NewLauncher("prefix", client, &LaunchConfig{
+		TemplateID:      "template-id",
+		TemplateVersion: "$Latest",
+		SubnetID:        "subnet-id",
+	})
+	input := &runner.LaunchInput{
+		ID:         1,
+		Owner:      "owner",
+		Repository: "repo",
+		Labels:     []string{"ec2", "ubuntu"},
+		DeliveryID: "message-1",
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- l.Launch(context.TODO(), input)
+		}()
+	}
+
+	a.Nil(<-errs)
+	a.Nil(<-errs)
+	a.Len(client.instances, 1)
+	a.Equal(2, client.runInstancesCalls)
+}
+
+func TestGetClientToken(t *testing.T) {
+	a := assert.New(t)
+	token := getClientToken("prefix", 1, "a4d3c8e5-62c5-4b8a-9f3a-7d1f8e5b2c4d")
+
+	a.Len(token, 64)
+	a.Equal(token, getClientToken("prefix", 1, "a4d3c8e5-62c5-4b8a-9f3a-7d1f8e5b2c4d"))
+	a.NotEqual(token, getClientToken("prefix", 1, "0b6e4f1a-93d2-4c7e-8a5b-2f9c1d7e3a6b"))
+}
+
 type mockedLauncherClient struct {
 	instancesInput         *ec2.RunInstancesInput
 	describeInstancesInput *ec2.DescribeInstancesInput
 	describeInstancesErr   error
 	existsInstancesNum     int
+	terminatedInstancesNum int
 }
 
 func (m *mockedLauncherClient) RunInstances(
@@ -183,9 +275,12 @@ func (m *mockedLauncherClient) DescribeInstances(
 ) (*ec2.DescribeInstancesOutput, error) {
 	m.describeInstancesInput = input
 
-	s := make([]types.Instance, m.existsInstancesNum)
+	s := make([]types.Instance, m.existsInstancesNum+m.terminatedInstancesNum)
 	for i := range s {
 		s[i].InstanceId = aws.String(strconv.Itoa(i))
+		if i >= m.existsInstancesNum {
+			s[i].State = &types.InstanceState{Name: types.InstanceStateNameTerminated}
+		}
 	}
 
 	return &ec2.DescribeInstancesOutput{
@@ -196,3 +291,51 @@ func (m *mockedLauncherClient) DescribeInstances(
 		},
 	}, m.describeInstancesErr
 }
+
+// mockedIdempotentClient launches at most one instance per client token like EC2, and holds
+// DescribeInstances until both launches looked up the tag to reproduce the race.
+type mockedIdempotentClient struct {
+	sync.Mutex
+	describing        sync.WaitGroup
+	tokens            map[string]string
+	instances         []types.Instance
+	runInstancesCalls int
+}
+
+func (m *mockedIdempotentClient) RunInstances(
+	_ context.Context,
+	input *ec2.RunInstancesInput,
+	_ ...func(*ec2.Options),
+) (*ec2.RunInstancesOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.runInstancesCalls++
+	if _, ok := m.tokens[aws.ToString(input.ClientToken)]; !ok {
+		id := strconv.Itoa(len(m.instances))
+		m.tokens[aws.ToString(input.ClientToken)] = id
+		m.instances = append(m.instances, types.Instance{
+			InstanceId: aws.String(id),
+			State:      &types.InstanceState{Name: types.InstanceStateNamePending},
+		})
+	}
+
+	return &ec2.RunInstancesOutput{}, nil
+}
+
+func (m *mockedIdempotentClient) DescribeInstances(
+	_ context.Context,
+	_ *ec2.DescribeInstancesInput,
+	_ ...func(*ec2.Options),
+) (*ec2.DescribeInstancesOutput, error) {
+	m.Lock()
+	instances := append([]types.Instance{}, m.instances...)
+	m.Unlock()
+
+	m.describing.Done()
+	m.describing.Wait()
+
+	return &ec2.DescribeInstancesOutput{
+		Reservations: []types.Reservation{{Instances: instances}},
+	}, nil
+}
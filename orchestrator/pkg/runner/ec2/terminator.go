@@ -4,7 +4,10 @@ import (
 	"context"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-sdk-go-v2/service/ec2"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type TerminateInstancesAPIClient interface {
@@ -21,12 +24,13 @@ type ec2Terminator struct {
 }
 
 func (t *ec2Terminator) Terminate(ctx context.Context, id uint64) error {
-	ids, rErr := getInstanceIDByTag(t.client, ctx, idTag, []string{uint64ToString(id)})
+	instances, rErr := getInstancesByTag(t.client, ctx, idTag, []string{uint64ToString(id)}, activeStates)
 
 	if rErr != nil {
 		return rErr
 	}
 
+	ids := getInstanceIDs(instances)
 	if len(ids) == 0 {
 		return &runner.NotExistsError{
 			ID:   id,
@@ -34,11 +38,20 @@ func (t *ec2Terminator) Terminate(ctx context.Context, id uint64) error {
 		}
 	}
 
-	_, dErr := t.client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
+	return t.terminateInstances(ctx, ids)
+}
+
+func (t *ec2Terminator) terminateInstances(ctx context.Context, ids []string) (err error) {
+	ctx, span := tracer.Start(ctx, "ec2.TerminateInstances", trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		attribute.StringSlice("instance_ids", ids),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	_, err = t.client.TerminateInstances(ctx, &ec2.TerminateInstancesInput{
 		InstanceIds: ids,
 	})
 
-	return dErr
+	return err
 }
 
 func NewTerminator(client TerminateInstancesAPIClient) runner.Terminator {
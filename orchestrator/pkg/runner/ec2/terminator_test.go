@@ -32,6 +32,10 @@ func TestEc2Terminator_Terminate(t *testing.T) {
 						Name:   aws.String(fmt.Sprintf("tag:%s", idTag)),
 						Values: []string{"1"},
 					},
+					{
+						Name:   aws.String("instance-state-name"),
+						Values: []string{"pending", "running", "stopping", "stopped"},
+					},
 				},
 			},
 			expectedTerminateInstancesInput: &ec2.TerminateInstancesInput{
@@ -47,6 +51,10 @@ func TestEc2Terminator_Terminate(t *testing.T) {
 						Name:   aws.String(fmt.Sprintf("tag:%s", idTag)),
 						Values: []string{"1"},
 					},
+					{
+						Name:   aws.String("instance-state-name"),
+						Values: []string{"pending", "running", "stopping", "stopped"},
+					},
 				},
 			},
 			err: errors.New("describe instance error"),
@@ -59,6 +67,10 @@ func TestEc2Terminator_Terminate(t *testing.T) {
 						Name:   aws.String(fmt.Sprintf("tag:%s", idTag)),
 						Values: []string{"1"},
 					},
+					{
+						Name:   aws.String("instance-state-name"),
+						Values: []string{"pending", "running", "stopping", "stopped"},
+					},
 				},
 			},
 			err: &runner.NotExistsError{
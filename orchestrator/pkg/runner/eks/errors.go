@@ -0,0 +1,39 @@
+package eks
+
+import (
+	"strings"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"k8s.io/apimachinery/pkg/api/errors"
+)
+
+// ClassifyError classifies Kubernetes API errors, ResourceQuota rejections are reported as
+// forbidden with an exceeded quota message.
+func ClassifyError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	switch {
+	case errors.IsForbidden(err) && strings.Contains(err.Error(), "exceeded quota"):
+		return &runner.QuotaError{Err: err}
+	case errors.IsTooManyRequests(err),
+		errors.IsServerTimeout(err),
+		errors.IsTimeout(err),
+		errors.IsServiceUnavailable(err),
+		errors.IsInternalError(err),
+		errors.IsUnexpectedServerError(err),
+		errors.IsConflict(err):
+		return &runner.RetryableError{Err: err}
+	case errors.IsInvalid(err),
+		errors.IsBadRequest(err),
+		errors.IsForbidden(err),
+		errors.IsUnauthorized(err),
+		errors.IsMethodNotSupported(err),
+		errors.IsNotAcceptable(err),
+		errors.IsRequestEntityTooLargeError(err):
+		return &runner.PermanentError{Err: err}
+	}
+
+	return err
+}
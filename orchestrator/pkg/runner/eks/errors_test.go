@@ -0,0 +1,76 @@
+package eks
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/stretchr/testify/assert"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestClassifyError(t *testing.T) {
+	deployments := schema.GroupResource{Group: "apps", Resource: "deployments"}
+	cases := map[string]struct {
+		err       error
+		retryable bool
+		permanent bool
+		quota     bool
+	}{
+		"too many requests": {
+			err:       k8serr.NewTooManyRequests("slow down", 1),
+			retryable: true,
+		},
+		"server timeout": {
+			err:       k8serr.NewServerTimeout(deployments, "create", 1),
+			retryable: true,
+		},
+		"internal error": {
+			err:       k8serr.NewInternalError(errors.New("etcd")),
+			retryable: true,
+		},
+		"service unavailable": {
+			err:       k8serr.NewServiceUnavailable("unavailable"),
+			retryable: true,
+		},
+		"exceeded quota": {
+			err: k8serr.NewForbidden(
+				deployments,
+				"1",
+				errors.New("exceeded quota: compute-resources, requested: requests.cpu=1"),
+			),
+			quota: true,
+		},
+		"forbidden": {
+			err:       k8serr.NewForbidden(deployments, "1", errors.New("not allowed")),
+			permanent: true,
+		},
+		"invalid": {
+			err: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonInvalid},
+			},
+			permanent: true,
+		},
+		"runner not exists": {
+			err: &runner.NotExistsError{ID: 1, Type: RunnerType},
+		},
+		"unknown error": {
+			err: errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			err := ClassifyError(tc.err)
+			a.ErrorIs(err, tc.err)
+			a.Equal(tc.retryable, runner.IsRetryableError(err))
+			a.Equal(tc.permanent, runner.IsPermanentError(err))
+			a.Equal(tc.quota, runner.IsQuotaError(err))
+		})
+	}
+
+	assert.Nil(t, ClassifyError(nil))
+}
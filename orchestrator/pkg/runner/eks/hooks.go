@@ -0,0 +1,155 @@
+package eks
+
+import (
+	"context"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	appv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	containerHooksPath = "/home/runner/k8s/index.js"
+	runnerWorkDir      = "/home/runner/work"
+	workVolumeName     = "work"
+	runnerGroupID      = 1001
+)
+
+// getContainerHooksPodSpec runs the runner without a docker daemon, the container hooks spawn
+// job containers as pods sharing the work volume, using the runner's service account.
+func (l *eksLauncher) getContainerHooksPodSpec(config *RunnerConfig) (apiv1.PodSpec, error) {
+	size, err := resource.ParseQuantity(l.config.WorkVolume.Size)
+	if err != nil {
+		return apiv1.PodSpec{}, &runner.PermanentError{Err: err}
+	}
+
+	var storageClass *string
+	if l.config.WorkVolume.StorageClass != "" {
+		storageClass = aws.String(l.config.WorkVolume.StorageClass)
+	}
+
+	c := l.getRunnerContainer(
+		config,
+		apiv1.EnvVar{Name: "ACTIONS_RUNNER_CONTAINER_HOOKS", Value: containerHooksPath},
+		apiv1.EnvVar{Name: "ACTIONS_RUNNER_REQUIRE_JOB_CONTAINER", Value: "true"},
+		apiv1.EnvVar{Name: "ACTIONS_RUNNER_POD_NAME", ValueFrom: &apiv1.EnvVarSource{
+			FieldRef: &apiv1.ObjectFieldSelector{FieldPath: "metadata.name"},
+		}},
+	)
+	c.VolumeMounts = []apiv1.VolumeMount{
+		{Name: workVolumeName, MountPath: runnerWorkDir},
+	}
+
+	return apiv1.PodSpec{
+		TerminationGracePeriodSeconds: aws.Int64(terminationGracePeriodSeconds),
+		ServiceAccountName:            l.getRunnerName(config.ID),
+		SecurityContext: &apiv1.PodSecurityContext{
+			FSGroup: aws.Int64(runnerGroupID),
+		},
+		Containers: []apiv1.Container{c},
+		Volumes: []apiv1.Volume{
+			{
+				Name: workVolumeName,
+				VolumeSource: apiv1.VolumeSource{
+					Ephemeral: &apiv1.EphemeralVolumeSource{
+						VolumeClaimTemplate: &apiv1.PersistentVolumeClaimTemplate{
+							Spec: apiv1.PersistentVolumeClaimSpec{
+								AccessModes:      []apiv1.PersistentVolumeAccessMode{apiv1.ReadWriteOnce},
+								StorageClassName: storageClass,
+								Resources: apiv1.ResourceRequirements{
+									Requests: apiv1.ResourceList{
+										apiv1.ResourceStorage: size,
+									},
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// createContainerHooksResources creates the service account and RBAC the container hooks need,
+// owned by the runner deployment so they are garbage collected on termination.
+func (l *eksLauncher) createContainerHooksResources(
+	ctx context.Context,
+	id uint64,
+	owner *appv1.Deployment,
+) error {
+	name := l.getRunnerName(id)
+	meta := metav1.ObjectMeta{
+		Name:            name,
+		Labels:          getRunnerLabels(id),
+		OwnerReferences: getOwnerReferences(owner),
+	}
+
+	_, saErr := l.kubeClient.CoreV1().ServiceAccounts(l.config.Namespace).
+		Create(ctx, &apiv1.ServiceAccount{ObjectMeta: meta}, metav1.CreateOptions{})
+	if saErr != nil && !errors.IsAlreadyExists(saErr) {
+		return saErr
+	}
+
+	_, roleErr := l.kubeClient.RbacV1().Roles(l.config.Namespace).
+		Create(ctx, &rbacv1.Role{ObjectMeta: meta, Rules: getContainerHooksRules()}, metav1.CreateOptions{})
+	if roleErr != nil && !errors.IsAlreadyExists(roleErr) {
+		return roleErr
+	}
+
+	_, bindingErr := l.kubeClient.RbacV1().RoleBindings(l.config.Namespace).
+		Create(ctx, &rbacv1.RoleBinding{
+			ObjectMeta: meta,
+			RoleRef: rbacv1.RoleRef{
+				APIGroup: rbacv1.GroupName,
+				Kind:     "Role",
+				Name:     name,
+			},
+			Subjects: []rbacv1.Subject{
+				{
+					Kind:      rbacv1.ServiceAccountKind,
+					Name:      name,
+					Namespace: l.config.Namespace,
+				},
+			},
+		}, metav1.CreateOptions{})
+	if bindingErr != nil && !errors.IsAlreadyExists(bindingErr) {
+		return bindingErr
+	}
+
+	return nil
+}
+
+func getContainerHooksRules() []rbacv1.PolicyRule {
+	return []rbacv1.PolicyRule{
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods"},
+			Verbs:     []string{"get", "list", "create", "delete"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods/exec"},
+			Verbs:     []string{"get", "create"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"pods/log"},
+			Verbs:     []string{"get", "list", "watch"},
+		},
+		{
+			APIGroups: []string{"batch"},
+			Resources: []string{"jobs"},
+			Verbs:     []string{"get", "list", "create", "delete"},
+		},
+		{
+			APIGroups: []string{""},
+			Resources: []string{"secrets"},
+			Verbs:     []string{"get", "list", "create", "delete"},
+		},
+	}
+}
@@ -7,13 +7,19 @@ import (
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/eks"
+	appv1 "k8s.io/api/apps/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
 
 const (
-	RunnerType = "eks"
+	RunnerType    = "eks"
+	appLabel      = "app"
+	appName       = "actions-runner"
+	runnerIDLabel = "actions-runner-id"
 )
 
 type KubeClientFactory func(c *rest.Config) (*kubernetes.Clientset, error)
@@ -49,9 +55,33 @@ func GetKubeClient(
 		TLSClientConfig: rest.TLSClientConfig{
 			CAData: ca,
 		},
+		WrapTransport: wrapTransport,
 	})
 }
 
+func getRunnerLabels(id uint64) map[string]string {
+	return map[string]string{
+		appLabel:      appName,
+		runnerIDLabel: uint64ToString(id),
+	}
+}
+
+func getRunnerSelector(id uint64) string {
+	return labels.SelectorFromSet(getRunnerLabels(id)).String()
+}
+
+// getOwnerReferences makes resources garbage collected with the runner deployment.
+func getOwnerReferences(d *appv1.Deployment) []metav1.OwnerReference {
+	return []metav1.OwnerReference{
+		{
+			APIVersion: "apps/v1",
+			Kind:       "Deployment",
+			Name:       d.Name,
+			UID:        d.UID,
+		},
+	}
+}
+
 func uint64ToString(n uint64) string {
 	base := 10
 	return strconv.FormatUint(n, base)
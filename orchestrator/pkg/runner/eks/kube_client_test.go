@@ -11,9 +11,14 @@ import (
 	"github.com/aws/aws-sdk-go-v2/service/eks/types"
 	"github.com/stretchr/testify/assert"
 	appv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
+	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 	appsv1 "k8s.io/client-go/kubernetes/typed/apps/v1"
+	corev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	rbacv1client "k8s.io/client-go/kubernetes/typed/rbac/v1"
 	"k8s.io/client-go/rest"
 	"sigs.k8s.io/aws-iam-authenticator/pkg/token"
 )
@@ -63,6 +68,11 @@ func TestGetKubeClient(t *testing.T) {
 
 			a.Equal(tc.err, err)
 			a.Equal(tc.expectedDescribeClusterInput, eksClient.input)
+			if kubeFactory.config != nil {
+				a.NotNil(kubeFactory.config.WrapTransport)
+				kubeFactory.config.WrapTransport = nil
+			}
+
 			a.Equal(tc.expectedRestConfig, kubeFactory.config)
 		})
 	}
@@ -105,16 +115,49 @@ type mockedKubeClient struct {
 
 	namespace            string
 	deployment           *appv1.Deployment
+	updatedDeployment    *appv1.Deployment
 	deleteDeploymentName string
 	deleteOpt            metav1.DeleteOptions
+	pods                 *mockedPodClient
+	rbac                 *mockedRbacClient
 
 	deploymentErr error
+	// deploymentPolls is the number of Get calls which still find the deployment.
+	deploymentPolls int
 }
 
 func (m *mockedKubeClient) AppsV1() appsv1.AppsV1Interface {
 	return m
 }
 
+func (m *mockedKubeClient) CoreV1() corev1.CoreV1Interface {
+	if m.pods == nil {
+		m.pods = new(mockedPodClient)
+	}
+
+	return m.pods
+}
+
+func (m *mockedKubeClient) RbacV1() rbacv1client.RbacV1Interface {
+	if m.rbac == nil {
+		m.rbac = new(mockedRbacClient)
+	}
+
+	return m.rbac
+}
+
+// nolint:gocritic
+func (m *mockedKubeClient) Get(_ context.Context, name string, _ metav1.GetOptions) (*appv1.Deployment, error) {
+	if m.deploymentPolls > 0 {
+		m.deploymentPolls--
+		return &appv1.Deployment{ObjectMeta: metav1.ObjectMeta{Name: name}}, nil
+	}
+
+	return nil, &k8serr.StatusError{
+		ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+	}
+}
+
 func (m *mockedKubeClient) Deployments(namespace string) appsv1.DeploymentInterface {
 	m.namespace = namespace
 	return m
@@ -126,8 +169,18 @@ func (m *mockedKubeClient) Create(
 	// nolint:gocritic
 	_ metav1.CreateOptions,
 ) (*appv1.Deployment, error) {
-	m.deployment = deployment
-	return nil, m.deploymentErr
+	m.deployment = deployment.DeepCopy()
+	return deployment, m.deploymentErr
+}
+
+func (m *mockedKubeClient) Update(
+	_ context.Context,
+	deployment *appv1.Deployment,
+	// nolint:gocritic
+	_ metav1.UpdateOptions,
+) (*appv1.Deployment, error) {
+	m.updatedDeployment = deployment
+	return deployment, nil
 }
 
 // nolint:gocritic
@@ -138,6 +191,152 @@ func (m *mockedKubeClient) Delete(_ context.Context, name string, opts metav1.De
 	return m.deploymentErr
 }
 
+type mockedPodClient struct {
+	corev1.CoreV1Interface
+	corev1.PodInterface
+
+	pods            []apiv1.Pod
+	serviceAccounts *mockedServiceAccountClient
+	secrets         *mockedSecretClient
+	listSelector    string
+	deletedPods     []string
+	deleteOpt       metav1.DeleteOptions
+	// stuck keeps pods around until they are force deleted.
+	stuck bool
+	// finalizers keeps pods around after they are deleted.
+	finalizers bool
+	// podPolls is the number of List calls which still find the pods.
+	podPolls int
+}
+
+func (m *mockedPodClient) Pods(_ string) corev1.PodInterface {
+	return m
+}
+
+// nolint:gocritic
+func (m *mockedPodClient) List(_ context.Context, opts metav1.ListOptions) (*apiv1.PodList, error) {
+	m.listSelector = opts.LabelSelector
+	if m.podPolls > 0 {
+		m.podPolls--
+		return &apiv1.PodList{Items: m.pods}, nil
+	}
+
+	if m.finalizers || (m.stuck && len(m.deletedPods) == 0) {
+		return &apiv1.PodList{Items: m.pods}, nil
+	}
+
+	return &apiv1.PodList{}, nil
+}
+
+// nolint:gocritic
+func (m *mockedPodClient) Delete(_ context.Context, name string, opts metav1.DeleteOptions) error {
+	m.deletedPods = append(m.deletedPods, name)
+	m.deleteOpt = opts
+	return nil
+}
+
+func (m *mockedPodClient) ServiceAccounts(_ string) corev1.ServiceAccountInterface {
+	if m.serviceAccounts == nil {
+		m.serviceAccounts = new(mockedServiceAccountClient)
+	}
+
+	return m.serviceAccounts
+}
+
+func (m *mockedPodClient) Secrets(_ string) corev1.SecretInterface {
+	if m.secrets == nil {
+		m.secrets = new(mockedSecretClient)
+	}
+
+	return m.secrets
+}
+
+type mockedSecretClient struct {
+	corev1.SecretInterface
+	existing      *apiv1.Secret
+	secret        *apiv1.Secret
+	deletedSecret string
+	secretErr     error
+}
+
+// nolint:gocritic
+func (m *mockedSecretClient) Get(_ context.Context, name string, _ metav1.GetOptions) (*apiv1.Secret, error) {
+	if m.existing != nil && m.existing.Name == name {
+		return m.existing, nil
+	}
+
+	return nil, &k8serr.StatusError{
+		ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+	}
+}
+
+// nolint:gocritic
+func (m *mockedSecretClient) Create(_ context.Context, secret *apiv1.Secret, _ metav1.CreateOptions) (*apiv1.Secret, error) {
+	m.secret = secret
+	return secret, m.secretErr
+}
+
+// nolint:gocritic
+func (m *mockedSecretClient) Delete(_ context.Context, name string, _ metav1.DeleteOptions) error {
+	m.deletedSecret = name
+	return m.secretErr
+}
+
+type mockedServiceAccountClient struct {
+	corev1.ServiceAccountInterface
+	serviceAccount *apiv1.ServiceAccount
+}
+
+// nolint:gocritic
+func (m *mockedServiceAccountClient) Create(
+	_ context.Context,
+	sa *apiv1.ServiceAccount,
+	_ metav1.CreateOptions,
+) (*apiv1.ServiceAccount, error) {
+	m.serviceAccount = sa
+	return sa, nil
+}
+
+type mockedRbacClient struct {
+	rbacv1client.RbacV1Interface
+	roles    mockedRoleClient
+	bindings mockedRoleBindingClient
+}
+
+func (m *mockedRbacClient) Roles(_ string) rbacv1client.RoleInterface {
+	return &m.roles
+}
+
+func (m *mockedRbacClient) RoleBindings(_ string) rbacv1client.RoleBindingInterface {
+	return &m.bindings
+}
+
+type mockedRoleClient struct {
+	rbacv1client.RoleInterface
+	role *rbacv1.Role
+}
+
+// nolint:gocritic
+func (m *mockedRoleClient) Create(_ context.Context, role *rbacv1.Role, _ metav1.CreateOptions) (*rbacv1.Role, error) {
+	m.role = role
+	return role, nil
+}
+
+type mockedRoleBindingClient struct {
+	rbacv1client.RoleBindingInterface
+	binding *rbacv1.RoleBinding
+}
+
+// nolint:gocritic
+func (m *mockedRoleBindingClient) Create(
+	_ context.Context,
+	binding *rbacv1.RoleBinding,
+	_ metav1.CreateOptions,
+) (*rbacv1.RoleBinding, error) {
+	m.binding = binding
+	return binding, nil
+}
+
 type mockedKubeClientFactory struct {
 	config *rest.Config
 }
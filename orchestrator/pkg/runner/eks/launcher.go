@@ -18,6 +18,11 @@ import (
 const (
 	runnerReplicas                = 1
 	terminationGracePeriodSeconds = 10
+
+	// DinDMode runs a privileged docker daemon sidecar next to the runner.
+	DinDMode = "dind"
+	// ContainerHooksMode uses the actions runner container hooks, job containers run as separate pods.
+	ContainerHooksMode = "container-hooks"
 )
 
 type RunnerConfig struct {
@@ -25,6 +30,7 @@ type RunnerConfig struct {
 	Owner      string
 	Repository string
 	Labels     string
+	Mode       string
 }
 
 type ContainerResource struct {
@@ -33,12 +39,54 @@ type ContainerResource struct {
 	Memory string
 }
 
+type WorkVolumeConfig struct {
+	// StorageClass uses the cluster default storage class when empty.
+	StorageClass string
+	Size         string
+}
+
+// Profile selects the mode of the runners for the jobs which have the label.
+type Profile struct {
+	Label string
+	Mode  string
+}
+
 type LaunchConfig struct {
-	Namespace       string
+	Namespace string
+	// Mode is the mode of the runners whose job matches no profile, it defaults to DinDMode.
+	Mode            string
+	Profiles        []Profile
 	Runner          ContainerResource
 	DinD            ContainerResource
+	WorkVolume      WorkVolumeConfig
 	GitHubSecret    string
 	GitHubSecretKey string
+	// RegistrationTokens creates a per runner secret with a registration token instead of
+	// sharing GitHubSecret across all runners.
+	RegistrationTokens runner.RegistrationTokenProvider
+}
+
+// Validate rejects unknown modes, and a work volume size which can't be parsed when a profile
+// uses the container hooks.
+func (c *LaunchConfig) Validate() error {
+	modes := []string{c.Mode}
+	for _, p := range c.Profiles {
+		modes = append(modes, p.Mode)
+	}
+
+	for _, m := range modes {
+		switch m {
+		case "", DinDMode:
+		case ContainerHooksMode:
+			if _, err := resource.ParseQuantity(c.WorkVolume.Size); err != nil {
+				return fmt.Errorf("invalid work volume size %q: %w", c.WorkVolume.Size, err)
+			}
+		default:
+			return fmt.Errorf("unknown runner mode %q", m)
+		}
+	}
+
+	return nil
 }
 
 type eksLauncher struct {
@@ -48,100 +96,216 @@ type eksLauncher struct {
 }
 
 func (l *eksLauncher) Launch(ctx context.Context, input *runner.LaunchInput) error {
-	_, err := l.kubeClient.AppsV1().Deployments(l.config.Namespace).
-		Create(ctx, l.getRunnerDeployment(&RunnerConfig{
-			ID:         input.ID,
-			Owner:      input.Owner,
-			Repository: input.Repository,
-			Labels:     strings.Join(input.Labels, ","),
-		}), metav1.CreateOptions{})
-
-	if errors.IsAlreadyExists(err) {
+	mode := l.getMode(input.Labels)
+	d, err := l.getRunnerDeployment(&RunnerConfig{
+		ID:         input.ID,
+		Owner:      input.Owner,
+		Repository: input.Repository,
+		Labels:     strings.Join(input.Labels, ","),
+		Mode:       mode,
+	})
+
+	if err != nil {
+		return err
+	}
+
+	hasResources := l.hasRunnerResources(mode)
+	if hasResources {
+		// the runner pods need the resources to start, the deployment is scaled up once they exist.
+		d.Spec.Replicas = aws.Int32(0)
+	}
+
+	deployments := l.kubeClient.AppsV1().Deployments(l.config.Namespace)
+	d, err = deployments.Create(ctx, d, metav1.CreateOptions{})
+
+	exists := errors.IsAlreadyExists(err)
+	if err != nil && !exists {
+		return err
+	}
+
+	if hasResources {
+		// a previous delivery may have failed before scaling up the deployment.
+		if exists {
+			if d, err = deployments.Get(ctx, uint64ToString(input.ID), metav1.GetOptions{}); err != nil {
+				return err
+			}
+		}
+
+		if err = l.createRunnerResources(ctx, input, mode, d); err != nil {
+			return err
+		}
+
+		if err = l.scaleUp(ctx, d); err != nil {
+			return err
+		}
+	}
+
+	if exists {
 		return &runner.AlreadyExistsError{
 			Type: RunnerType,
 			ID:   input.ID,
 		}
 	}
 
+	return nil
+}
+
+func (l *eksLauncher) scaleUp(ctx context.Context, d *appv1.Deployment) error {
+	if d.Spec.Replicas != nil && *d.Spec.Replicas == runnerReplicas {
+		return nil
+	}
+
+	d.Spec.Replicas = aws.Int32(runnerReplicas)
+	_, err := l.kubeClient.AppsV1().Deployments(l.config.Namespace).Update(ctx, d, metav1.UpdateOptions{})
 	return err
 }
 
-func (l *eksLauncher) getRunnerDeployment(config *RunnerConfig) *appv1.Deployment {
+// getMode returns the mode of the first profile whose label the job has.
+func (l *eksLauncher) getMode(labels []string) string {
+	for _, p := range l.config.Profiles {
+		for _, label := range labels {
+			if p.Label == label {
+				return p.Mode
+			}
+		}
+	}
+
+	if l.config.Mode == "" {
+		return DinDMode
+	}
+
+	return l.config.Mode
+}
+
+func (l *eksLauncher) hasRunnerResources(mode string) bool {
+	return mode == ContainerHooksMode || l.config.RegistrationTokens != nil
+}
+
+// createRunnerResources creates resources owned by the runner deployment.
+func (l *eksLauncher) createRunnerResources(
+	ctx context.Context,
+	input *runner.LaunchInput,
+	mode string,
+	d *appv1.Deployment,
+) error {
+	if l.config.RegistrationTokens != nil {
+		if err := l.createRegistrationSecret(ctx, input, d); err != nil {
+			return err
+		}
+	}
+
+	if mode == ContainerHooksMode {
+		return l.createContainerHooksResources(ctx, input.ID, d)
+	}
+
+	return nil
+}
+
+func (l *eksLauncher) getRunnerDeployment(config *RunnerConfig) (*appv1.Deployment, error) {
+	spec, err := l.getRunnerPodSpec(config)
+	if err != nil {
+		return nil, err
+	}
+
+	labels := getRunnerLabels(config.ID)
 	return &appv1.Deployment{
 		ObjectMeta: metav1.ObjectMeta{
-			Name: uint64ToString(config.ID),
-			Labels: map[string]string{
-				"app": "actions-runner",
-			},
+			Name:   uint64ToString(config.ID),
+			Labels: labels,
 		},
 		Spec: appv1.DeploymentSpec{
 			Replicas: aws.Int32(runnerReplicas),
 			Selector: &metav1.LabelSelector{
-				MatchLabels: map[string]string{
-					"app": "actions-runner",
-				},
+				MatchLabels: labels,
 			},
 			Template: apiv1.PodTemplateSpec{
 				ObjectMeta: metav1.ObjectMeta{
-					Labels: map[string]string{
-						"app": "actions-runner",
-					},
+					Labels: labels,
 				},
-				Spec: apiv1.PodSpec{
-					TerminationGracePeriodSeconds: aws.Int64(terminationGracePeriodSeconds),
-					Containers: []apiv1.Container{
-						{
-							Name:  "actions-runner",
-							Image: l.config.Runner.Image,
-							SecurityContext: &apiv1.SecurityContext{
-								RunAsNonRoot: aws.Bool(true),
-							},
-							Resources: apiv1.ResourceRequirements{
-								Requests: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse(l.config.Runner.CPU),
-									apiv1.ResourceMemory: resource.MustParse(l.config.Runner.Memory),
-								},
-							},
-							Env: []apiv1.EnvVar{
-								{Name: "RUNNER_NAME", Value: fmt.Sprintf("%v-%v", l.runnerNamePrefix, config.ID)},
-								{Name: "RUNNER_LABELS", Value: config.Labels},
-								{Name: "RUNNER_ORG", Value: config.Owner},
-								{Name: "RUNNER_REPO", Value: config.Repository},
-								{Name: "GH_TOKEN", ValueFrom: &apiv1.EnvVarSource{
-									SecretKeyRef: &apiv1.SecretKeySelector{
-										LocalObjectReference: apiv1.LocalObjectReference{
-											Name: l.config.GitHubSecret,
-										},
-										Key: l.config.GitHubSecretKey,
-									},
-								}},
-								{Name: "DOCKER_HOST", Value: "tcp://localhost:2375"},
-							},
-						},
-						{
-							Name:  "dind",
-							Image: l.config.DinD.Image,
-							SecurityContext: &apiv1.SecurityContext{
-								Privileged: aws.Bool(true),
-							},
-							Resources: apiv1.ResourceRequirements{
-								Requests: apiv1.ResourceList{
-									apiv1.ResourceCPU:    resource.MustParse(l.config.DinD.CPU),
-									apiv1.ResourceMemory: resource.MustParse(l.config.DinD.Memory),
-								},
-							},
-							Env: []apiv1.EnvVar{
-								{Name: "DOCKER_TLS_CERTDIR", Value: ""},
-							},
-						},
+				Spec: spec,
+			},
+		},
+		Status: appv1.DeploymentStatus{},
+	}, nil
+}
+
+func (l *eksLauncher) getRunnerPodSpec(config *RunnerConfig) (apiv1.PodSpec, error) {
+	if config.Mode == ContainerHooksMode {
+		return l.getContainerHooksPodSpec(config)
+	}
+
+	return apiv1.PodSpec{
+		TerminationGracePeriodSeconds: aws.Int64(terminationGracePeriodSeconds),
+		Containers: []apiv1.Container{
+			l.getRunnerContainer(config, apiv1.EnvVar{Name: "DOCKER_HOST", Value: "tcp://localhost:2375"}),
+			{
+				Name:  "dind",
+				Image: l.config.DinD.Image,
+				SecurityContext: &apiv1.SecurityContext{
+					Privileged: aws.Bool(true),
+				},
+				Resources: apiv1.ResourceRequirements{
+					Requests: apiv1.ResourceList{
+						apiv1.ResourceCPU:    resource.MustParse(l.config.DinD.CPU),
+						apiv1.ResourceMemory: resource.MustParse(l.config.DinD.Memory),
 					},
 				},
+				Env: []apiv1.EnvVar{
+					{Name: "DOCKER_TLS_CERTDIR", Value: ""},
+				},
 			},
 		},
-		Status: appv1.DeploymentStatus{},
+	}, nil
+}
+
+func (l *eksLauncher) getRunnerContainer(config *RunnerConfig, env ...apiv1.EnvVar) apiv1.Container {
+	return apiv1.Container{
+		Name:  "actions-runner",
+		Image: l.config.Runner.Image,
+		SecurityContext: &apiv1.SecurityContext{
+			RunAsNonRoot: aws.Bool(true),
+		},
+		Resources: apiv1.ResourceRequirements{
+			Requests: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse(l.config.Runner.CPU),
+				apiv1.ResourceMemory: resource.MustParse(l.config.Runner.Memory),
+			},
+		},
+		Env: append(append([]apiv1.EnvVar{
+			{Name: "RUNNER_NAME", Value: l.getRunnerName(config.ID)},
+			{Name: "RUNNER_LABELS", Value: config.Labels},
+			{Name: "RUNNER_ORG", Value: config.Owner},
+			{Name: "RUNNER_REPO", Value: config.Repository},
+		}, l.getTokenEnv(config.ID)...), env...),
 	}
 }
 
+func (l *eksLauncher) getTokenEnv(id uint64) []apiv1.EnvVar {
+	if l.config.RegistrationTokens != nil {
+		return []apiv1.EnvVar{
+			getSecretEnv("RUNNER_TOKEN", getRegistrationSecretName(id), registrationTokenKey),
+			getSecretEnv("RUNNER_REMOVE_TOKEN", getRegistrationSecretName(id), removalTokenKey),
+		}
+	}
+
+	return []apiv1.EnvVar{getSecretEnv("GH_TOKEN", l.config.GitHubSecret, l.config.GitHubSecretKey)}
+}
+
+func getSecretEnv(name, secret, key string) apiv1.EnvVar {
+	return apiv1.EnvVar{Name: name, ValueFrom: &apiv1.EnvVarSource{
+		SecretKeyRef: &apiv1.SecretKeySelector{
+			LocalObjectReference: apiv1.LocalObjectReference{
+				Name: secret,
+			},
+			Key: key,
+		},
+	}}
+}
+
+func (l *eksLauncher) getRunnerName(id uint64) string {
+	return fmt.Sprintf("%v-%v", l.runnerNamePrefix, id)
+}
+
 func NewLauncher(
 	runnerNamePrefix string,
 	kubeClient kubernetes.Interface,
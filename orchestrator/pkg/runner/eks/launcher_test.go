@@ -2,13 +2,23 @@ package eks
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"strings"
 	"testing"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/stretchr/testify/assert"
+	appv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	rbacv1 "k8s.io/api/rbac/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	k8sruntime "k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
 )
 
 func TestEksLauncher_Launch(t *testing.T) {
@@ -83,12 +93,426 @@ func TestEksLauncher_Launch(t *testing.T) {
 			l := NewLauncher(prefix, client, tc.config).(*eksLauncher)
 			a.Equal(tc.err, l.Launch(context.TODO(), tc.input))
 
-			a.Equal(l.getRunnerDeployment(&RunnerConfig{
+			d, err := l.getRunnerDeployment(&RunnerConfig{
 				ID:         tc.input.ID,
 				Owner:      tc.input.Owner,
 				Repository: tc.input.Repository,
 				Labels:     strings.Join(tc.input.Labels, ","),
-			}), client.deployment)
+				Mode:       DinDMode,
+			})
+			a.Nil(err)
+			a.Equal(d, client.deployment)
 		})
 	}
 }
+
+func TestEksLauncher_LaunchContainerHooks(t *testing.T) {
+	config := &LaunchConfig{
+		Namespace: "ns",
+		Mode:      ContainerHooksMode,
+		Runner: ContainerResource{
+			Image:  "runner",
+			CPU:    "1",
+			Memory: "1Gi",
+		},
+		WorkVolume: WorkVolumeConfig{
+			StorageClass: "gp2",
+			Size:         "10Gi",
+		},
+		GitHubSecret:    "secret",
+		GitHubSecretKey: "secretKey",
+	}
+	input := &runner.LaunchInput{
+		ID:         1,
+		Owner:      "owner",
+		Repository: "repo",
+		Labels:     []string{"eks", "ubuntu"},
+	}
+	cases := map[string]struct {
+		deploymentErr   error
+		deploymentPolls int
+		err             error
+	}{
+		"create runner with container hooks resources": {},
+		"recreate container hooks resources for existing runner": {
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonAlreadyExists},
+			},
+			deploymentPolls: 1,
+			err: &runner.AlreadyExistsError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedKubeClient{
+				deploymentErr:   tc.deploymentErr,
+				deploymentPolls: tc.deploymentPolls,
+			}
+
+			a.Equal(tc.err, NewLauncher("prefix", client, config).Launch(context.TODO(), input))
+
+			spec := client.deployment.Spec.Template.Spec
+			a.Len(spec.Containers, 1)
+			a.Nil(spec.Containers[0].SecurityContext.Privileged)
+			a.Contains(spec.Containers[0].Env, apiv1.EnvVar{
+				Name:  "ACTIONS_RUNNER_CONTAINER_HOOKS",
+				Value: containerHooksPath,
+			})
+			a.Equal([]apiv1.VolumeMount{{Name: workVolumeName, MountPath: runnerWorkDir}}, spec.Containers[0].VolumeMounts)
+			a.Equal("prefix-1", spec.ServiceAccountName)
+			a.Equal("gp2", *spec.Volumes[0].Ephemeral.VolumeClaimTemplate.Spec.StorageClassName)
+
+			owner := []metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "1"}}
+			sa := client.pods.serviceAccounts.serviceAccount
+			a.Equal("prefix-1", sa.Name)
+			a.Equal(owner, sa.OwnerReferences)
+
+			role := client.rbac.roles.role
+			a.Equal("prefix-1", role.Name)
+			a.Equal(owner, role.OwnerReferences)
+			a.Equal(getContainerHooksRules(), role.Rules)
+
+			binding := client.rbac.bindings.binding
+			a.Equal(owner, binding.OwnerReferences)
+			a.Equal(rbacv1.RoleRef{APIGroup: rbacv1.GroupName, Kind: "Role", Name: "prefix-1"}, binding.RoleRef)
+			a.Equal([]rbacv1.Subject{{Kind: rbacv1.ServiceAccountKind, Name: "prefix-1", Namespace: "ns"}}, binding.Subjects)
+		})
+	}
+}
+
+func TestEksLauncher_LaunchProfiles(t *testing.T) {
+	cases := map[string]struct {
+		labels       []string
+		workVolume   WorkVolumeConfig
+		containers   int
+		storageClass *string
+		err          error
+	}{
+		"job without profile label runs with dind": {
+			labels:     []string{"eks", "ubuntu"},
+			containers: 2,
+		},
+		"job with profile label runs with container hooks": {
+			labels:     []string{"eks", "ubuntu", "restricted"},
+			workVolume: WorkVolumeConfig{Size: "10Gi"},
+			containers: 1,
+		},
+		"invalid work volume size": {
+			labels: []string{"eks", "ubuntu", "restricted"},
+			err:    &runner.PermanentError{Err: resource.ErrFormatWrong},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := new(mockedKubeClient)
+			config := &LaunchConfig{
+				Namespace:  "ns",
+				Profiles:   []Profile{{Label: "restricted", Mode: ContainerHooksMode}},
+				Runner:     ContainerResource{Image: "runner", CPU: "1", Memory: "1Gi"},
+				DinD:       ContainerResource{Image: "dind", CPU: "1", Memory: "1Gi"},
+				WorkVolume: tc.workVolume,
+			}
+
+			err := NewLauncher("prefix", client, config).Launch(context.TODO(), &runner.LaunchInput{ID: 1, Labels: tc.labels})
+
+			a.Equal(tc.err, err)
+			if tc.err != nil {
+				a.Nil(client.deployment)
+				return
+			}
+
+			spec := client.deployment.Spec.Template.Spec
+			a.Len(spec.Containers, tc.containers)
+			if len(spec.Volumes) != 0 {
+				a.Nil(spec.Volumes[0].Ephemeral.VolumeClaimTemplate.Spec.StorageClassName)
+			}
+		})
+	}
+}
+
+func TestLaunchConfig_Validate(t *testing.T) {
+	cases := map[string]struct {
+		config *LaunchConfig
+		errMsg string
+	}{
+		"default mode": {
+			config: new(LaunchConfig),
+		},
+		"container hooks profile": {
+			config: &LaunchConfig{
+				Mode:       DinDMode,
+				Profiles:   []Profile{{Label: "restricted", Mode: ContainerHooksMode}},
+				WorkVolume: WorkVolumeConfig{Size: "10Gi"},
+			},
+		},
+		"unknown mode": {
+			config: &LaunchConfig{Mode: "privileged"},
+			errMsg: `unknown runner mode "privileged"`,
+		},
+		"unknown profile mode": {
+			config: &LaunchConfig{Profiles: []Profile{{Label: "restricted", Mode: "hooks"}}},
+			errMsg: `unknown runner mode "hooks"`,
+		},
+		"missing work volume size": {
+			config: &LaunchConfig{Mode: ContainerHooksMode},
+			errMsg: `invalid work volume size "": quantities must match the regular expression '^([+-]?[0-9.]+)([eEinumkKMGTP]*[-+]?[0-9]*)$'`,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			err := tc.config.Validate()
+			if tc.errMsg == "" {
+				a.Nil(err)
+				return
+			}
+
+			a.EqualError(err, tc.errMsg)
+		})
+	}
+}
+
+func TestEksLauncher_LaunchWithRegistrationToken(t *testing.T) {
+	input := &runner.LaunchInput{
+		ID:         1,
+		Owner:      "owner",
+		Repository: "repo",
+		Labels:     []string{"eks", "ubuntu"},
+	}
+	cases := map[string]struct {
+		tokenErr        error
+		deploymentErr   error
+		deploymentPolls int
+		existingSecret  bool
+		expectedSecret  bool
+		err             error
+	}{
+		"create runner with registration secret": {
+			expectedSecret: true,
+		},
+		"recreate registration secret for existing runner": {
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonAlreadyExists},
+			},
+			deploymentPolls: 1,
+			expectedSecret:  true,
+			err: &runner.AlreadyExistsError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+		"keep registration secret of previous delivery": {
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonAlreadyExists},
+			},
+			deploymentPolls: 1,
+			existingSecret:  true,
+			err: &runner.AlreadyExistsError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+		"failed to create registration token": {
+			tokenErr: errors.New("some error"),
+			err:      errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			secrets := new(mockedSecretClient)
+			if tc.existingSecret {
+				secrets.existing = &apiv1.Secret{ObjectMeta: metav1.ObjectMeta{Name: "1-registration-token"}}
+			}
+
+			client := &mockedKubeClient{
+				deploymentErr:   tc.deploymentErr,
+				deploymentPolls: tc.deploymentPolls,
+				pods:            &mockedPodClient{secrets: secrets},
+			}
+			tokens := &mockedTokenProvider{token: "registration-token", err: tc.tokenErr}
+			config := &LaunchConfig{
+				Namespace: "ns",
+				Runner: ContainerResource{
+					Image:  "runner",
+					CPU:    "1",
+					Memory: "1Gi",
+				},
+				DinD: ContainerResource{
+					Image:  "dind",
+					CPU:    "1",
+					Memory: "1Gi",
+				},
+				RegistrationTokens: tokens,
+			}
+
+			a.Equal(tc.err, NewLauncher("prefix", client, config).Launch(context.TODO(), input))
+			if tc.existingSecret {
+				a.Empty(tokens.owner)
+			} else {
+				a.Equal("owner", tokens.owner)
+				a.Equal("repo", tokens.repository)
+			}
+
+			a.Equal(int32(0), *client.deployment.Spec.Replicas)
+			env := client.deployment.Spec.Template.Spec.Containers[0].Env
+			a.Contains(env, apiv1.EnvVar{Name: "RUNNER_TOKEN", ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: "1-registration-token"},
+					Key:                  registrationTokenKey,
+				},
+			}})
+			a.Contains(env, apiv1.EnvVar{Name: "RUNNER_REMOVE_TOKEN", ValueFrom: &apiv1.EnvVarSource{
+				SecretKeyRef: &apiv1.SecretKeySelector{
+					LocalObjectReference: apiv1.LocalObjectReference{Name: "1-registration-token"},
+					Key:                  removalTokenKey,
+				},
+			}})
+
+			for _, e := range env {
+				a.NotEqual("GH_TOKEN", e.Name)
+			}
+
+			secret := client.pods.secrets.secret
+			if !tc.expectedSecret {
+				a.Nil(secret)
+				return
+			}
+
+			a.Equal("1-registration-token", secret.Name)
+			a.Equal(getRunnerLabels(1), secret.Labels)
+			a.Equal([]metav1.OwnerReference{{APIVersion: "apps/v1", Kind: "Deployment", Name: "1"}}, secret.OwnerReferences)
+			a.Equal(map[string]string{
+				registrationTokenKey: "registration-token",
+				removalTokenKey:      "removal-token",
+			}, secret.StringData)
+			a.Equal(int32(1), *client.updatedDeployment.Spec.Replicas)
+		})
+	}
+}
+
+type mockedTokenProvider struct {
+	owner      string
+	repository string
+	token      string
+	err        error
+}
+
+func (m *mockedTokenProvider) RegistrationToken(_ context.Context, owner, repository string) (string, error) {
+	m.owner = owner
+	m.repository = repository
+	return m.token, m.err
+}
+
+func (m *mockedTokenProvider) RemovalToken(context.Context, string, string) (string, error) {
+	return "removal-token", m.err
+}
+
+func TestEksLauncher_LaunchWithLauncherRole(t *testing.T) {
+	input := &runner.LaunchInput{
+		ID:         1,
+		Owner:      "owner",
+		Repository: "repo",
+		Labels:     []string{"eks", "ubuntu"},
+	}
+	cases := map[string]struct {
+		mode           string
+		tokens         bool
+		existing       bool
+		expectedSecret bool
+		err            error
+	}{
+		"launch dind runner": {
+			mode: DinDMode,
+		},
+		"launch dind runner with registration secret": {
+			mode:           DinDMode,
+			tokens:         true,
+			expectedSecret: true,
+		},
+		"launch container hooks runner with registration secret": {
+			mode:           ContainerHooksMode,
+			tokens:         true,
+			expectedSecret: true,
+		},
+		"scale up existing runner": {
+			mode:           ContainerHooksMode,
+			tokens:         true,
+			existing:       true,
+			expectedSecret: true,
+			err:            &runner.AlreadyExistsError{Type: RunnerType, ID: 1},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			objects := make([]k8sruntime.Object, 0)
+			if tc.existing {
+				objects = append(objects, &appv1.Deployment{
+					ObjectMeta: metav1.ObjectMeta{Name: "1", Namespace: "ns"},
+					Spec:       appv1.DeploymentSpec{Replicas: aws.Int32(0)},
+				})
+			}
+
+			client := getLauncherRoleClient(objects...)
+			config := &LaunchConfig{
+				Namespace:  "ns",
+				Mode:       tc.mode,
+				Runner:     ContainerResource{Image: "runner", CPU: "1", Memory: "1Gi"},
+				DinD:       ContainerResource{Image: "dind", CPU: "1", Memory: "1Gi"},
+				WorkVolume: WorkVolumeConfig{Size: "10Gi"},
+			}
+			if tc.tokens {
+				config.RegistrationTokens = &mockedTokenProvider{token: "registration-token"}
+			}
+
+			a.Equal(tc.err, NewLauncher("prefix", client, config).Launch(context.TODO(), input))
+
+			d, err := client.AppsV1().Deployments("ns").Get(context.TODO(), "1", metav1.GetOptions{})
+			a.Nil(err)
+			a.Equal(int32(runnerReplicas), *d.Spec.Replicas)
+
+			_, err = client.CoreV1().Secrets("ns").Get(context.TODO(), "1-registration-token", metav1.GetOptions{})
+			a.Equal(tc.expectedSecret, err == nil)
+		})
+	}
+}
+
+// getLauncherRoleClient returns a fake clientset which only allows the verbs of the ubuntu-launcher
+// role in bin/create_runner_namespace.sh.
+func getLauncherRoleClient(objects ...k8sruntime.Object) *fake.Clientset {
+	verbs := map[string][]string{
+		"deployments":     {"get", "watch", "list", "create", "update"},
+		"serviceaccounts": {"get", "create"},
+		"secrets":         {"get", "create"},
+		"roles":           {"get", "create", "escalate", "bind"},
+		"rolebindings":    {"get", "create", "escalate", "bind"},
+	}
+
+	client := fake.NewSimpleClientset(objects...)
+	client.PrependReactor("*", "*", func(action k8stesting.Action) (bool, k8sruntime.Object, error) {
+		for _, v := range verbs[action.GetResource().Resource] {
+			if v == action.GetVerb() {
+				return false, nil, nil
+			}
+		}
+
+		return true, nil, k8serr.NewForbidden(
+			action.GetResource().GroupResource(),
+			"",
+			fmt.Errorf("%v is not allowed", action.GetVerb()),
+		)
+	})
+
+	return client
+}
@@ -0,0 +1,66 @@
+package eks
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	appv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	registrationTokenKey = "token"
+	removalTokenKey      = "remove-token"
+)
+
+func getRegistrationSecretName(id uint64) string {
+	return fmt.Sprintf("%v-registration-token", id)
+}
+
+// createRegistrationSecret stores the registration token and the removal token only the runner can
+// use, the secret is owned by the runner deployment so it is garbage collected on termination. A
+// redelivery keeps the secret of the previous delivery instead of issuing new tokens.
+func (l *eksLauncher) createRegistrationSecret(
+	ctx context.Context,
+	input *runner.LaunchInput,
+	owner *appv1.Deployment,
+) error {
+	secrets := l.kubeClient.CoreV1().Secrets(l.config.Namespace)
+	_, gErr := secrets.Get(ctx, getRegistrationSecretName(input.ID), metav1.GetOptions{})
+	if gErr == nil {
+		return nil
+	}
+
+	if !errors.IsNotFound(gErr) {
+		return gErr
+	}
+
+	token, tErr := l.config.RegistrationTokens.RegistrationToken(ctx, input.Owner, input.Repository)
+	if tErr != nil {
+		return tErr
+	}
+
+	removal, rErr := l.config.RegistrationTokens.RemovalToken(ctx, input.Owner, input.Repository)
+	if rErr != nil {
+		return rErr
+	}
+
+	_, err := secrets.Create(ctx, &apiv1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            getRegistrationSecretName(input.ID),
+			Labels:          getRunnerLabels(input.ID),
+			OwnerReferences: getOwnerReferences(owner),
+		},
+		Type:       apiv1.SecretTypeOpaque,
+		StringData: map[string]string{registrationTokenKey: token, removalTokenKey: removal},
+	}, metav1.CreateOptions{})
+
+	if errors.IsAlreadyExists(err) {
+		return nil
+	}
+
+	return err
+}
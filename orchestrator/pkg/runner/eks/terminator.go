@@ -2,16 +2,31 @@ package eks
 
 import (
 	"context"
+	"time"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	apiv1 "k8s.io/api/core/v1"
 	"k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/kubernetes"
 )
 
+const (
+	defaultPollInterval = 2 * time.Second
+	// deadlineMargin leaves time to report the result before the Lambda deadline.
+	deadlineMargin = time.Second
+)
+
 type RunnerTerminationConfig struct {
 	Cluster   string
 	Namespace string
+	// WaitForDeletion waits until the runner deployment and its pods are gone.
+	WaitForDeletion bool
+	PollInterval    time.Duration
+	// GracePeriod is how long to wait before force deleting the runner pods, it defaults to the
+	// termination grace period of the pods.
+	GracePeriod time.Duration
 }
 
 type eksTerminator struct {
@@ -32,15 +47,195 @@ func (t *eksTerminator) Terminate(ctx context.Context, id uint64) error {
 		)
 
 	if errors.IsNotFound(err) {
-		return &runner.NotExistsError{
-			Type: RunnerType,
-			ID:   id,
+		if sErr := t.deleteOrphanedSecret(ctx, id); sErr != nil {
+			return sErr
+		}
+
+		leftover, pErr := t.deleteLeftoverPods(ctx, id)
+		if pErr != nil {
+			return pErr
+		}
+
+		if !leftover {
+			return &runner.NotExistsError{
+				Type: RunnerType,
+				ID:   id,
+			}
 		}
+
+		err = nil
+	}
+
+	if err != nil || !t.config.WaitForDeletion {
+		return err
+	}
+
+	return t.waitForDeletion(ctx, id)
+}
+
+// deleteOrphanedSecret removes the registration secret when the runner deployment which owns it
+// is already gone, e.g. the launcher failed before the owner reference could be set.
+func (t *eksTerminator) deleteOrphanedSecret(ctx context.Context, id uint64) error {
+	err := t.kubeClient.CoreV1().
+		Secrets(t.config.Namespace).
+		Delete(ctx, getRegistrationSecretName(id), metav1.DeleteOptions{})
+
+	if errors.IsNotFound(err) {
+		return nil
 	}
 
 	return err
 }
 
+// deleteLeftoverPods deletes the runner pods which outlived their deployment, with their own grace
+// period, so the runner can still deregister itself.
+func (t *eksTerminator) deleteLeftoverPods(ctx context.Context, id uint64) (bool, error) {
+	pods, err := t.kubeClient.CoreV1().
+		Pods(t.config.Namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: getRunnerSelector(id)})
+
+	if err != nil {
+		return false, err
+	}
+
+	for i := range pods.Items {
+		if pods.Items[i].DeletionTimestamp != nil {
+			continue
+		}
+
+		dErr := t.kubeClient.CoreV1().
+			Pods(t.config.Namespace).
+			Delete(ctx, pods.Items[i].Name, metav1.DeleteOptions{})
+
+		if dErr != nil && !errors.IsNotFound(dErr) {
+			return false, dErr
+		}
+	}
+
+	return len(pods.Items) != 0, nil
+}
+
+func (t *eksTerminator) waitForDeletion(ctx context.Context, id uint64) error {
+	if d, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, d.Add(-deadlineMargin))
+		defer cancel()
+	}
+
+	interval := t.config.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	start := time.Now()
+	forced := false
+
+	for {
+		deleted, err := t.isDeleted(ctx, id)
+		if err != nil && ctx.Err() == nil {
+			return err
+		}
+
+		if deleted {
+			return nil
+		}
+
+		if !forced {
+			if forced, err = t.forceDeleteStuckPods(ctx, id, start); err != nil && ctx.Err() == nil {
+				return err
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return &runner.CleanupNotConfirmedError{
+				Type: RunnerType,
+				ID:   id,
+			}
+		case <-ticker.C:
+		}
+	}
+}
+
+func (t *eksTerminator) isDeleted(ctx context.Context, id uint64) (bool, error) {
+	_, err := t.kubeClient.AppsV1().
+		Deployments(t.config.Namespace).
+		Get(ctx, uint64ToString(id), metav1.GetOptions{})
+
+	if err == nil {
+		return false, nil
+	}
+
+	if !errors.IsNotFound(err) {
+		return false, err
+	}
+
+	pods, pErr := t.kubeClient.CoreV1().
+		Pods(t.config.Namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: getRunnerSelector(id)})
+
+	if pErr != nil {
+		return false, pErr
+	}
+
+	return len(pods.Items) == 0, nil
+}
+
+// forceDeleteStuckPods force deletes the runner pods still there after the grace period, which
+// defaults to the termination grace period of the pods, so the runner has time to deregister.
+func (t *eksTerminator) forceDeleteStuckPods(ctx context.Context, id uint64, since time.Time) (bool, error) {
+	if time.Since(since) < t.config.GracePeriod {
+		return false, nil
+	}
+
+	pods, err := t.kubeClient.CoreV1().
+		Pods(t.config.Namespace).
+		List(ctx, metav1.ListOptions{LabelSelector: getRunnerSelector(id)})
+
+	if err != nil {
+		return false, err
+	}
+
+	if len(pods.Items) == 0 ||
+		(t.config.GracePeriod <= 0 && time.Since(since) < getTerminationGracePeriod(pods.Items)) {
+		return false, nil
+	}
+
+	for i := range pods.Items {
+		dErr := t.kubeClient.CoreV1().
+			Pods(t.config.Namespace).
+			Delete(ctx, pods.Items[i].Name, metav1.DeleteOptions{
+				GracePeriodSeconds: aws.Int64(0),
+			})
+
+		if dErr != nil && !errors.IsNotFound(dErr) {
+			return false, dErr
+		}
+	}
+
+	return true, nil
+}
+
+// getTerminationGracePeriod returns the longest termination grace period of the pods.
+func getTerminationGracePeriod(pods []apiv1.Pod) time.Duration {
+	var period int64
+	for i := range pods {
+		p := pods[i].Spec.TerminationGracePeriodSeconds
+		if p == nil {
+			p = aws.Int64(apiv1.DefaultTerminationGracePeriodSeconds)
+		}
+
+		if *p > period {
+			period = *p
+		}
+	}
+
+	return time.Duration(period) * time.Second
+}
+
 func NewTerminator(
 	kubeClient kubernetes.Interface,
 	config *RunnerTerminationConfig,
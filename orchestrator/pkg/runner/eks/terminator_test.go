@@ -3,9 +3,12 @@ package eks
 import (
 	"context"
 	"testing"
+	"time"
 
 	"github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/stretchr/testify/assert"
+	apiv1 "k8s.io/api/core/v1"
 	k8serr "k8s.io/apimachinery/pkg/api/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
@@ -16,10 +19,14 @@ func TestEksTerminator_Terminate(t *testing.T) {
 		Namespace: "ns",
 	}
 	cases := map[string]struct {
-		id                 uint64
-		deploymentErr      error
-		expectedDeleteName string
-		err                error
+		id                    uint64
+		deploymentErr         error
+		secretErr             error
+		pods                  *mockedPodClient
+		expectedDeleteName    string
+		expectedDeletedSecret string
+		expectedDeletedPods   []string
+		err                   error
 	}{
 		"terminate deployment": {
 			id:                 1,
@@ -30,19 +37,71 @@ func TestEksTerminator_Terminate(t *testing.T) {
 			deploymentErr: &k8serr.StatusError{
 				ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
 			},
-			expectedDeleteName: "1",
+			secretErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+			},
+			expectedDeleteName:    "1",
+			expectedDeletedSecret: "1-registration-token",
+			err: &runner.NotExistsError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+		"delete leftover pods": {
+			id: 1,
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+			},
+			pods: &mockedPodClient{
+				pods: []apiv1.Pod{
+					{ObjectMeta: metav1.ObjectMeta{Name: "1-pod"}},
+					{ObjectMeta: metav1.ObjectMeta{Name: "1-terminating", DeletionTimestamp: &metav1.Time{}}},
+				},
+				podPolls: 1,
+			},
+			expectedDeleteName:    "1",
+			expectedDeletedSecret: "1-registration-token",
+			expectedDeletedPods:   []string{"1-pod"},
+		},
+		"delete orphaned registration secret": {
+			id: 1,
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+			},
+			expectedDeleteName:    "1",
+			expectedDeletedSecret: "1-registration-token",
 			err: &runner.NotExistsError{
 				Type: RunnerType,
 				ID:   1,
 			},
 		},
+		"failed to delete orphaned registration secret": {
+			id: 1,
+			deploymentErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonNotFound},
+			},
+			secretErr: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonForbidden, Message: "forbidden"},
+			},
+			expectedDeleteName:    "1",
+			expectedDeletedSecret: "1-registration-token",
+			err: &k8serr.StatusError{
+				ErrStatus: metav1.Status{Reason: metav1.StatusReasonForbidden, Message: "forbidden"},
+			},
+		},
 	}
 
 	for n, tc := range cases {
 		t.Run(n, func(t *testing.T) {
 			a := assert.New(t)
+			pods := tc.pods
+			if pods == nil {
+				pods = new(mockedPodClient)
+			}
+			pods.secrets = &mockedSecretClient{secretErr: tc.secretErr}
 			client := &mockedKubeClient{
 				deploymentErr: tc.deploymentErr,
+				pods:          pods,
 			}
 			deletePolicy := metav1.DeletePropagationForeground
 
@@ -50,9 +109,126 @@ func TestEksTerminator_Terminate(t *testing.T) {
 
 			a.Equal(tc.err, err)
 			a.Equal(tc.expectedDeleteName, client.deleteDeploymentName)
+			a.Equal(tc.expectedDeletedSecret, client.pods.secrets.deletedSecret)
+			a.Equal(tc.expectedDeletedPods, client.pods.deletedPods)
 			a.EqualValues(metav1.DeleteOptions{
 				PropagationPolicy: &deletePolicy,
 			}, client.deleteOpt)
 		})
 	}
 }
+
+func TestEksTerminator_TerminateAndWait(t *testing.T) {
+	config := &RunnerTerminationConfig{
+		Cluster:         "cluster",
+		Namespace:       "ns",
+		WaitForDeletion: true,
+		PollInterval:    time.Millisecond,
+		GracePeriod:     20 * time.Millisecond,
+	}
+	pods := []apiv1.Pod{
+		{ObjectMeta: metav1.ObjectMeta{Name: "1-pod"}},
+	}
+	cases := map[string]struct {
+		deploymentPolls int
+		pods            *mockedPodClient
+		timeout         time.Duration
+		deletedPods     []string
+		err             error
+	}{
+		"deployment and pods deleted": {
+			deploymentPolls: 2,
+			pods:            &mockedPodClient{pods: pods, podPolls: 2},
+			timeout:         time.Second,
+		},
+		"force delete stuck pods after grace period": {
+			pods:        &mockedPodClient{pods: pods, stuck: true},
+			timeout:     time.Second,
+			deletedPods: []string{"1-pod"},
+		},
+		"pods stuck on finalizers": {
+			pods:        &mockedPodClient{pods: pods, finalizers: true},
+			timeout:     100 * time.Millisecond,
+			deletedPods: []string{"1-pod"},
+			err: &runner.CleanupNotConfirmedError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+		"deployment not deleted before deadline": {
+			deploymentPolls: 1000,
+			pods:            new(mockedPodClient),
+			timeout:         100 * time.Millisecond,
+			err: &runner.CleanupNotConfirmedError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedKubeClient{
+				deploymentPolls: tc.deploymentPolls,
+				pods:            tc.pods,
+			}
+			ctx, cancel := context.WithTimeout(context.TODO(), tc.timeout+deadlineMargin)
+			defer cancel()
+
+			err := NewTerminator(client, config).Terminate(ctx, 1)
+
+			a.Equal(tc.err, err)
+			a.Equal(tc.deletedPods, tc.pods.deletedPods)
+			if len(tc.deletedPods) != 0 {
+				a.Equal("actions-runner-id=1,app=actions-runner", tc.pods.listSelector)
+				a.Equal(metav1.DeleteOptions{GracePeriodSeconds: aws.Int64(0)}, tc.pods.deleteOpt)
+			}
+		})
+	}
+}
+
+func TestEksTerminator_TerminateWithPodGracePeriod(t *testing.T) {
+	config := &RunnerTerminationConfig{
+		Cluster:         "cluster",
+		Namespace:       "ns",
+		WaitForDeletion: true,
+		PollInterval:    time.Millisecond,
+	}
+	cases := map[string]struct {
+		gracePeriod *int64
+		deletedPods []string
+		err         error
+	}{
+		"force delete after the pod grace period": {
+			gracePeriod: aws.Int64(0),
+			deletedPods: []string{"1-pod"},
+		},
+		"wait for the default pod grace period": {
+			err: &runner.CleanupNotConfirmedError{
+				Type: RunnerType,
+				ID:   1,
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			pods := &mockedPodClient{
+				pods: []apiv1.Pod{{
+					ObjectMeta: metav1.ObjectMeta{Name: "1-pod"},
+					Spec:       apiv1.PodSpec{TerminationGracePeriodSeconds: tc.gracePeriod},
+				}},
+				stuck: true,
+			}
+			ctx, cancel := context.WithTimeout(context.TODO(), 100*time.Millisecond+deadlineMargin)
+			defer cancel()
+
+			err := NewTerminator(&mockedKubeClient{pods: pods}, config).Terminate(ctx, 1)
+
+			a.Equal(tc.err, err)
+			a.Equal(tc.deletedPods, pods.deletedPods)
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package eks
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
+	"go.opentelemetry.io/otel"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/orchestrator/pkg/runner/eks")
+
+// tracingTransport records a client span for every request sent to the Kubernetes API server.
+type tracingTransport struct {
+	next http.RoundTripper
+}
+
+func (t *tracingTransport) RoundTrip(req *http.Request) (resp *http.Response, err error) {
+	ctx, span := tracer.Start(req.Context(), fmt.Sprintf("kubernetes %v", req.Method),
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.HTTPMethodKey.String(req.Method),
+			semconv.HTTPTargetKey.String(req.URL.Path),
+		),
+	)
+	defer func() { tracing.End(span, err) }()
+
+	resp, err = t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	span.SetAttributes(semconv.HTTPStatusCodeKey.Int(resp.StatusCode))
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(resp.StatusCode))
+
+	return resp, nil
+}
+
+func wrapTransport(rt http.RoundTripper) http.RoundTripper {
+	return &tracingTransport{next: rt}
+}
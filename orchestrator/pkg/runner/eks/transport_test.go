@@ -0,0 +1,88 @@
+package eks
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
+)
+
+func TestTracingTransport_RoundTrip(t *testing.T) {
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+
+	cases := map[string]struct {
+		status         int
+		err            error
+		expectedStatus codes.Code
+		expectedAttrs  []attribute.KeyValue
+	}{
+		"successful request": {
+			status:         http.StatusCreated,
+			expectedStatus: codes.Unset,
+			expectedAttrs: []attribute.KeyValue{
+				attribute.String("http.method", http.MethodPost),
+				attribute.String("http.target", "/apis/apps/v1/namespaces/ns/deployments"),
+				attribute.Int("http.status_code", http.StatusCreated),
+			},
+		},
+		"server error": {
+			status:         http.StatusInternalServerError,
+			expectedStatus: codes.Error,
+			expectedAttrs: []attribute.KeyValue{
+				attribute.String("http.method", http.MethodPost),
+				attribute.String("http.target", "/apis/apps/v1/namespaces/ns/deployments"),
+				attribute.Int("http.status_code", http.StatusInternalServerError),
+			},
+		},
+		"transport error": {
+			err:            errors.New("connection refused"),
+			expectedStatus: codes.Error,
+			expectedAttrs: []attribute.KeyValue{
+				attribute.String("http.method", http.MethodPost),
+				attribute.String("http.target", "/apis/apps/v1/namespaces/ns/deployments"),
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			next := &mockedRoundTripper{status: tc.status, err: tc.err}
+			req, _ := http.NewRequest(http.MethodPost, "https://cluster/apis/apps/v1/namespaces/ns/deployments", nil)
+
+			_, err := wrapTransport(next).RoundTrip(req)
+			a.Equal(tc.err, err)
+
+			spans := recorder.Ended()
+			span := spans[len(spans)-1]
+			a.Equal("kubernetes POST", span.Name())
+			a.Equal(trace.SpanKindClient, span.SpanKind())
+			a.Equal(tc.expectedStatus, span.Status().Code)
+			a.Equal(tc.expectedAttrs, span.Attributes())
+			a.Equal(span.SpanContext(), trace.SpanContextFromContext(next.req.Context()))
+		})
+	}
+}
+
+type mockedRoundTripper struct {
+	req    *http.Request
+	status int
+	err    error
+}
+
+func (m *mockedRoundTripper) RoundTrip(req *http.Request) (*http.Response, error) {
+	m.req = req
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &http.Response{StatusCode: m.status}, nil
+}
@@ -32,3 +32,77 @@ func IsNotExistsError(err error) bool {
 	e := new(NotExistsError)
 	return errors.As(err, &e)
 }
+
+type CleanupNotConfirmedError struct {
+	ID   uint64
+	Type string
+}
+
+func (e *CleanupNotConfirmedError) Error() string {
+	return fmt.Sprintf(`runner id: %v type: %v cleanup not confirmed`, e.ID, e.Type)
+}
+
+func IsCleanupNotConfirmedError(err error) bool {
+	e := new(CleanupNotConfirmedError)
+	return errors.As(err, &e)
+}
+
+// RetryableError is a transient failure, e.g. throttling or a server error, retrying the same
+// request is expected to succeed.
+type RetryableError struct {
+	Err error
+}
+
+func (e *RetryableError) Error() string {
+	return fmt.Sprintf(`retryable error: %v`, e.Err)
+}
+
+func (e *RetryableError) Unwrap() error {
+	return e.Err
+}
+
+func IsRetryableError(err error) bool {
+	e := new(RetryableError)
+	return errors.As(err, &e)
+}
+
+// PermanentError is a failure which won't succeed without changing the request or configuration.
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf(`permanent error: %v`, e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+func IsPermanentError(err error) bool {
+	e := new(PermanentError)
+	return errors.As(err, &e)
+}
+
+// QuotaError is a failure caused by an exhausted quota or capacity, it may succeed once runners
+// are released, but not within the current attempt.
+type QuotaError struct {
+	Err error
+}
+
+func (e *QuotaError) Error() string {
+	return fmt.Sprintf(`quota error: %v`, e.Err)
+}
+
+func (e *QuotaError) Unwrap() error {
+	return e.Err
+}
+
+func IsQuotaError(err error) bool {
+	e := new(QuotaError)
+	return errors.As(err, &e)
+}
+
+// ErrorClassifier wraps backend errors into RetryableError, PermanentError or QuotaError,
+// errors it can't classify are returned as they are.
+type ErrorClassifier func(err error) error
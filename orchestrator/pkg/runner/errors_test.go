@@ -2,6 +2,7 @@ package runner
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -74,3 +75,96 @@ func TestIsNotExistsError(t *testing.T) {
 		})
 	}
 }
+
+func TestCleanupNotConfirmedError_Error(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("runner id: 1 type: resource cleanup not confirmed", (&CleanupNotConfirmedError{
+		ID:   1,
+		Type: "resource",
+	}).Error())
+}
+
+func TestIsCleanupNotConfirmedError(t *testing.T) {
+	cases := map[string]struct {
+		err      error
+		expected bool
+	}{
+		"CleanupNotConfirmedError": {
+			err: &CleanupNotConfirmedError{
+				ID:   1,
+				Type: "resource",
+			},
+			expected: true,
+		},
+		"errorString": {
+			err:      errors.New("new errorString"),
+			expected: false,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.expected, IsCleanupNotConfirmedError(tc.err))
+		})
+	}
+}
+
+func TestRetryableError_Error(t *testing.T) {
+	a := assert.New(t)
+	err := errors.New("throttled")
+	a.Equal("retryable error: throttled", (&RetryableError{Err: err}).Error())
+	a.ErrorIs(&RetryableError{Err: err}, err)
+}
+
+func TestPermanentError_Error(t *testing.T) {
+	a := assert.New(t)
+	err := errors.New("invalid")
+	a.Equal("permanent error: invalid", (&PermanentError{Err: err}).Error())
+	a.ErrorIs(&PermanentError{Err: err}, err)
+}
+
+func TestQuotaError_Error(t *testing.T) {
+	a := assert.New(t)
+	err := errors.New("limit exceeded")
+	a.Equal("quota error: limit exceeded", (&QuotaError{Err: err}).Error())
+	a.ErrorIs(&QuotaError{Err: err}, err)
+}
+
+func TestErrorCategories(t *testing.T) {
+	cases := map[string]struct {
+		err       error
+		retryable bool
+		permanent bool
+		quota     bool
+	}{
+		"RetryableError": {
+			err:       &RetryableError{Err: errors.New("throttled")},
+			retryable: true,
+		},
+		"PermanentError": {
+			err:       &PermanentError{Err: errors.New("invalid")},
+			permanent: true,
+		},
+		"QuotaError": {
+			err:   &QuotaError{Err: errors.New("limit exceeded")},
+			quota: true,
+		},
+		"wrapped RetryableError": {
+			err:       fmt.Errorf("launch: %w", &RetryableError{Err: errors.New("throttled")}),
+			retryable: true,
+		},
+		"errorString": {
+			err: errors.New("new errorString"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.retryable, IsRetryableError(tc.err))
+			a.Equal(tc.permanent, IsPermanentError(tc.err))
+			a.Equal(tc.quota, IsQuotaError(tc.err))
+		})
+	}
+}
@@ -7,8 +7,18 @@ type LaunchInput struct {
 	Owner      string
 	Repository string
 	Labels     []string
+	// DeliveryID identifies the delivery of the launch message, redeliveries of the message share
+	// it, while a requeued job is a new message with a new one.
+	DeliveryID string `json:"-"`
 }
 
 type Launcher interface {
 	Launch(ctx context.Context, input *LaunchInput) error
 }
+
+// RegistrationTokenProvider issues short-lived runner registration and removal tokens, so runners
+// don't need a token which can register runners across the organisation.
+type RegistrationTokenProvider interface {
+	RegistrationToken(ctx context.Context, owner, repository string) (string, error)
+	RemovalToken(ctx context.Context, owner, repository string) (string, error)
+}
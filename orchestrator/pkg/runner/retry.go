@@ -0,0 +1,129 @@
+package runner
+
+import (
+	"context"
+	"math/rand"
+	"time"
+)
+
+type RetryConfig struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+}
+
+var DefaultRetryConfig = &RetryConfig{
+	MaxAttempts: 5,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+}
+
+type retrier struct {
+	classify ErrorClassifier
+	config   *RetryConfig
+	jitter   func(d time.Duration) time.Duration
+}
+
+// do retries RetryableError with exponential backoff and full jitter, it gives up early when
+// the next attempt can't start before the context deadline, so the caller can still report it.
+func (r *retrier) do(ctx context.Context, op func(ctx context.Context) error) error {
+	for attempt := 1; ; attempt++ {
+		err := op(ctx)
+		if err == nil {
+			return nil
+		}
+
+		if r.classify != nil {
+			err = r.classify(err)
+		}
+
+		if !IsRetryableError(err) || attempt >= r.config.MaxAttempts {
+			return err
+		}
+
+		delay := r.jitter(r.backoff(attempt))
+		if d, ok := ctx.Deadline(); ok && time.Until(d) <= delay {
+			return err
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+func (r *retrier) backoff(attempt int) time.Duration {
+	d := r.config.BaseDelay
+	for i := 1; i < attempt && d < r.config.MaxDelay; i++ {
+		d *= 2
+	}
+
+	if d > r.config.MaxDelay {
+		return r.config.MaxDelay
+	}
+
+	return d
+}
+
+func fullJitter(d time.Duration) time.Duration {
+	if d <= 0 {
+		return 0
+	}
+
+	// nolint:gosec
+	return time.Duration(rand.Int63n(int64(d) + 1))
+}
+
+func newRetrier(classify ErrorClassifier, config *RetryConfig) *retrier {
+	if config == nil {
+		config = DefaultRetryConfig
+	}
+
+	return &retrier{
+		classify: classify,
+		config:   config,
+		jitter:   fullJitter,
+	}
+}
+
+type retryLauncher struct {
+	launcher Launcher
+	retrier  *retrier
+}
+
+func (l *retryLauncher) Launch(ctx context.Context, input *LaunchInput) error {
+	return l.retrier.do(ctx, func(ctx context.Context) error {
+		return l.launcher.Launch(ctx, input)
+	})
+}
+
+// NewRetryLauncher classifies launcher errors and retries the retryable ones.
+func NewRetryLauncher(launcher Launcher, classify ErrorClassifier, config *RetryConfig) Launcher {
+	return &retryLauncher{
+		launcher: launcher,
+		retrier:  newRetrier(classify, config),
+	}
+}
+
+type retryTerminator struct {
+	terminator Terminator
+	retrier    *retrier
+}
+
+func (t *retryTerminator) Terminate(ctx context.Context, id uint64) error {
+	return t.retrier.do(ctx, func(ctx context.Context) error {
+		return t.terminator.Terminate(ctx, id)
+	})
+}
+
+// NewRetryTerminator classifies terminator errors and retries the retryable ones.
+func NewRetryTerminator(terminator Terminator, classify ErrorClassifier, config *RetryConfig) Terminator {
+	return &retryTerminator{
+		terminator: terminator,
+		retrier:    newRetrier(classify, config),
+	}
+}
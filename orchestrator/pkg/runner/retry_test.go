@@ -0,0 +1,165 @@
+package runner
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var errThrottled = errors.New("throttled")
+
+func classifyTestError(err error) error {
+	if errors.Is(err, errThrottled) {
+		return &RetryableError{Err: err}
+	}
+
+	return err
+}
+
+func TestRetryLauncher_Launch(t *testing.T) {
+	config := &RetryConfig{
+		MaxAttempts: 3,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    2 * time.Millisecond,
+	}
+	cases := map[string]struct {
+		errs             []error
+		timeout          time.Duration
+		config           *RetryConfig
+		expectedAttempts int
+		err              error
+	}{
+		"launch without retry": {
+			expectedAttempts: 1,
+		},
+		"retry retryable error": {
+			errs:             []error{errThrottled, errThrottled},
+			expectedAttempts: 3,
+		},
+		"give up after max attempts": {
+			errs:             []error{errThrottled, errThrottled, errThrottled},
+			expectedAttempts: 3,
+			err:              &RetryableError{Err: errThrottled},
+		},
+		"don't retry permanent error": {
+			errs:             []error{&PermanentError{Err: errors.New("invalid")}},
+			expectedAttempts: 1,
+			err:              &PermanentError{Err: errors.New("invalid")},
+		},
+		"don't retry unclassified error": {
+			errs:             []error{errors.New("some error")},
+			expectedAttempts: 1,
+			err:              errors.New("some error"),
+		},
+		"don't retry beyond deadline": {
+			errs:    []error{errThrottled},
+			timeout: 50 * time.Millisecond,
+			config: &RetryConfig{
+				MaxAttempts: 3,
+				BaseDelay:   time.Hour,
+				MaxDelay:    time.Hour,
+			},
+			expectedAttempts: 1,
+			err:              &RetryableError{Err: errThrottled},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			ctx := context.Background()
+			if tc.timeout > 0 {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, tc.timeout)
+				defer cancel()
+			}
+
+			c := config
+			if tc.config != nil {
+				c = tc.config
+			}
+
+			launcher := &mockedLauncher{errs: tc.errs}
+			input := &LaunchInput{ID: 1}
+
+			a.Equal(tc.err, NewRetryLauncher(launcher, classifyTestError, c).Launch(ctx, input))
+			a.Equal(tc.expectedAttempts, launcher.attempts)
+			a.Equal(input, launcher.input)
+		})
+	}
+}
+
+func TestRetryTerminator_Terminate(t *testing.T) {
+	a := assert.New(t)
+	terminator := &mockedTerminator{errs: []error{errThrottled, &NotExistsError{ID: 1, Type: "resource"}}}
+	config := &RetryConfig{
+		MaxAttempts: 5,
+		BaseDelay:   time.Millisecond,
+		MaxDelay:    time.Millisecond,
+	}
+
+	err := NewRetryTerminator(terminator, classifyTestError, config).Terminate(context.TODO(), 1)
+
+	a.True(IsNotExistsError(err))
+	a.Equal(2, terminator.attempts)
+	a.Equal(uint64(1), terminator.id)
+}
+
+func TestRetrier_Backoff(t *testing.T) {
+	a := assert.New(t)
+	r := newRetrier(nil, &RetryConfig{
+		MaxAttempts: 10,
+		BaseDelay:   100 * time.Millisecond,
+		MaxDelay:    time.Second,
+	})
+
+	a.Equal(100*time.Millisecond, r.backoff(1))
+	a.Equal(200*time.Millisecond, r.backoff(2))
+	a.Equal(800*time.Millisecond, r.backoff(4))
+	a.Equal(time.Second, r.backoff(5))
+	a.Equal(time.Second, r.backoff(60))
+
+	for i := 0; i < 100; i++ {
+		d := fullJitter(time.Second)
+		a.True(d >= 0 && d <= time.Second)
+	}
+}
+
+type mockedLauncher struct {
+	errs     []error
+	attempts int
+	input    *LaunchInput
+}
+
+func (m *mockedLauncher) Launch(_ context.Context, input *LaunchInput) error {
+	m.input = input
+	m.attempts++
+	if len(m.errs) == 0 {
+		return nil
+	}
+
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
+
+type mockedTerminator struct {
+	errs     []error
+	attempts int
+	id       uint64
+}
+
+func (m *mockedTerminator) Terminate(_ context.Context, id uint64) error {
+	m.id = id
+	m.attempts++
+	if len(m.errs) == 0 {
+		return nil
+	}
+
+	err := m.errs[0]
+	m.errs = m.errs[1:]
+	return err
+}
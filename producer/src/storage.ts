@@ -54,6 +54,8 @@ export class Storage {
       throw new Error(`no supported OS found in labels (${job.labels})`);
     }
 
+    const now = Date.now().toString();
+
     try {
       await this.client.send(
         new PutItemCommand({
@@ -69,7 +71,8 @@ export class Storage {
             },
             Content: { B: await compressJob(job) },
             Status: { S: Status.Queued },
-            CreatedAt: { N: Date.now().toString() },
+            CreatedAt: { N: now },
+            UpdatedAt: { N: now },
           },
         })
       );
@@ -85,13 +88,14 @@ export class Storage {
       new UpdateItemCommand({
         TableName: this.tableName,
         Key: { ID: { N: id.toString() } },
-        UpdateExpression: 'SET #s = :s',
+        UpdateExpression: 'SET CompletedFrom = if_not_exists(CompletedFrom, #s), #s = :s, UpdatedAt = :now',
         ConditionExpression: 'attribute_exists(ID)',
         ExpressionAttributeNames: {
           '#s': 'Status',
         },
         ExpressionAttributeValues: {
           ':s': { S: Status.Completed },
+          ':now': { N: Date.now().toString() },
         },
       })
     );
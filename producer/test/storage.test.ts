@@ -44,6 +44,7 @@ describe('Storage tests', () => {
             Status: { S: Status.Queued },
             Content: { B: await compressJob(job) },
             CreatedAt: { N: expect.anything() },
+            UpdatedAt: { N: expect.anything() },
           }),
         }),
       })
@@ -82,13 +83,14 @@ describe('Storage tests', () => {
         input: expect.objectContaining({
           TableName: table,
           Key: { ID: { N: id.toString() } },
-          UpdateExpression: 'SET #s = :s',
+          UpdateExpression: 'SET CompletedFrom = if_not_exists(CompletedFrom, #s), #s = :s, UpdatedAt = :now',
           ConditionExpression: 'attribute_exists(ID)',
           ExpressionAttributeNames: {
             '#s': 'Status',
           },
           ExpressionAttributeValues: {
             ':s': { S: Status.Completed },
+            ':now': { N: expect.anything() },
           },
         }),
       })
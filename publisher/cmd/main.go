@@ -2,31 +2,79 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
 	"log"
 	"os"
+	"os/signal"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
+	_ "time/tzdata"
 
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/breaker"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/daemon"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/handler"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/limits"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-lambda-go/lambda"
+	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
 	"go.uber.org/zap"
 )
 
 const (
-	ec2Host             = "ec2"
-	eksHost             = "eks"
-	regionEnv           = "DEFAULT_REGION"
-	tableNameEnv        = "JOBS_TABLE"
-	tableHostIndexEnv   = "JOBS_TABLE_HOST_INDEX"
-	ec2CurrencyLimitEnv = "EC2_CURRENCY_LIMIT"
-	eksCurrencyLimitEnv = "EKS_CURRENCY_LIMIT"
-	publisherTopicEnv   = "PUBLISHER_TOPIC"
-	jobsTopicEnv        = "JOBS_TOPIC"
+	serviceName          = "publisher"
+	ec2Host              = "ec2"
+	eksHost              = "eks"
+	regionEnv            = "DEFAULT_REGION"
+	tableNameEnv         = "JOBS_TABLE"
+	tableHostIndexEnv    = "JOBS_TABLE_HOST_INDEX"
+	ec2CurrencyLimitEnv  = "EC2_CURRENCY_LIMIT"
+	eksCurrencyLimitEnv  = "EKS_CURRENCY_LIMIT"
+	concurrencyLimitEnv  = "CONCURRENCY_LIMITS"
+	limitsParameterEnv   = "LIMITS_PARAMETER"
+	limitsTableEnv       = "LIMITS_TABLE"
+	limitsNameEnv        = "LIMITS_NAME"
+	limitsCacheTTLEnv    = "LIMITS_CACHE_TTL"
+	limitSchedulesEnv    = "LIMIT_SCHEDULES"
+	staleJobThresholdEnv = "STALE_JOB_THRESHOLD"
+	staleJobActionEnv    = "STALE_JOB_ACTION"
+	defaultLimitsName    = "concurrency-limits"
+	publisherTopicEnv    = "PUBLISHER_TOPIC"
+	jobsTopicEnv         = "JOBS_TOPIC"
+	messengerEnv         = "MESSENGER"
+	jobQueuesEnv         = "JOB_QUEUES"
+	publisherQueueEnv    = "PUBLISHER_QUEUE"
+	eventBusEnv          = "EVENT_BUS"
+	sqsMessenger         = "sqs"
+	eventBridgeMessenger = "eventbridge"
+	modeEnv              = "MODE"
+	daemonMode           = "daemon"
+	daemonIntervalEnv    = "DAEMON_INTERVAL"
+	daemonRunTimeoutEnv  = "DAEMON_RUN_TIMEOUT"
+	daemonAddrEnv        = "DAEMON_ADDR"
+	daemonWakeTokenEnv   = "DAEMON_WAKE_TOKEN"
+	defaultDaemonAddr    = ":8080"
+	breakerTableEnv      = "BREAKER_TABLE"
+	breakerCooldownEnv   = "BREAKER_COOLDOWN"
+	schedulerEnv         = "SCHEDULER"
+	fairShareWeightsEnv  = "FAIR_SHARE_WEIGHTS"
+	fairShareCapsEnv     = "FAIR_SHARE_CAPS"
+	fairShareScheduler   = "fair_share"
+	priorityScheduler    = "priority"
+	priorityRulesEnv     = "PRIORITY_RULES"
+	priorityAgingEnv     = "PRIORITY_AGING_INTERVAL"
 )
 
 func main() {
@@ -39,35 +87,350 @@ func main() {
 	)
 	handleError(err)
 
-	ec2Limits, ec2Err := strconv.ParseInt(os.Getenv(ec2CurrencyLimitEnv), 10, 32)
-	handleError(ec2Err)
+	_, tErr := tracing.SetupFromEnv(context.TODO(), serviceName)
+	handleError(tErr)
 
-	eksLimits, eksErr := strconv.ParseInt(os.Getenv(eksCurrencyLimitEnv), 10, 32)
-	handleError(eksErr)
+	hostOptions, hErr := getHostOptions()
+	handleError(hErr)
+
+	recorder := metrics.New(os.Stdout, metrics.DefaultNamespace)
+	options := []publisher.Option{publisher.WithMetrics(recorder)}
+	if table := os.Getenv(breakerTableEnv); table != "" {
+		cooldown, cErr := getBreakerCooldown()
+		handleError(cErr)
+
+		options = append(options, publisher.WithBreaker(breaker.New(dynamodb.NewFromConfig(cfg), table, cooldown)))
+	}
+
+	limitSource, lErr := getLimitSource(cfg, hostOptions, logger)
+	handleError(lErr)
+	if limitSource != nil {
+		options = append(options, publisher.WithLimitSource(limitSource))
+	}
 
-	lambda.Start(handler.SetupPublisherHandler(publisher.New(
+	staleJobs, jErr := getStaleJobsConfig()
+	handleError(jErr)
+	options = append(options, publisher.WithStaleJobs(staleJobs))
+
+	scheduler, sErr := getScheduler()
+	handleError(sErr)
+	options = append(options, publisher.WithScheduler(scheduler))
+
+	m, mErr := getMessenger(cfg, recorder)
+	handleError(mErr)
+
+	if os.Getenv(modeEnv) == daemonMode {
+		m = daemon.NewQuietMessenger(m)
+	}
+
+	p := publisher.New(
 		storage.New(
 			dynamodb.NewFromConfig(cfg),
 			os.Getenv(tableNameEnv),
 			os.Getenv(tableHostIndexEnv),
 		),
-		messenger.New(
+		m,
+		hostOptions,
+		logger,
+		options...,
+	)
+
+	if os.Getenv(modeEnv) == daemonMode {
+		handleError(runDaemon(p, logger))
+		return
+	}
+
+	lambda.Start(handler.SetupPublisherHandler(p))
+}
+
+// runDaemon publishes on a ticker until SIGINT or SIGTERM, SIGUSR1 wakes the daemon up.
+func runDaemon(p publisher.Publisher, logger *zap.Logger) error {
+	config, err := getDaemonConfig()
+	if err != nil {
+		return err
+	}
+
+	d := daemon.New(p, config, logger)
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	wake := make(chan os.Signal, 1)
+	signal.Notify(wake, syscall.SIGUSR1)
+	defer signal.Stop(wake)
+
+	go func() {
+		for range wake {
+			d.Wake()
+		}
+	}()
+
+	logger.Info("starting publisher daemon",
+		zap.Duration("interval", config.Interval),
+		zap.String("addr", config.Addr),
+	)
+
+	return d.Run(ctx)
+}
+
+func getDaemonConfig() (daemon.Config, error) {
+	config := daemon.DefaultConfig
+	config.Addr = defaultDaemonAddr
+	if v, ok := os.LookupEnv(daemonAddrEnv); ok {
+		config.Addr = v
+	}
+
+	config.WakeToken = os.Getenv(daemonWakeTokenEnv)
+
+	for env, d := range map[string]*time.Duration{
+		daemonIntervalEnv:   &config.Interval,
+		daemonRunTimeoutEnv: &config.RunTimeout,
+	} {
+		v := os.Getenv(env)
+		if v == "" {
+			continue
+		}
+
+		duration, err := time.ParseDuration(v)
+		if err != nil || duration <= 0 {
+			return config, fmt.Errorf("invalid %v %q", env, v)
+		}
+
+		*d = duration
+	}
+
+	return config, nil
+}
+
+// getMessenger selects the transport from MESSENGER, the SNS topics by default. The sqs transport
+// routes the jobs with JOB_QUEUES, e.g. [{"Host":"ec2","URL":"..."},{"Host":"ec2","OS":"windows","URL":"..."}].
+func getMessenger(cfg aws.Config, recorder metrics.Recorder) (messenger.Messenger, error) {
+	switch os.Getenv(messengerEnv) {
+	case sqsMessenger:
+		queues := make([]messenger.Queue, 0)
+		if err := json.Unmarshal([]byte(os.Getenv(jobQueuesEnv)), &queues); err != nil {
+			return nil, fmt.Errorf("invalid job queues: %v", err)
+		}
+
+		return messenger.NewSQS(
+			sqs.NewFromConfig(cfg),
+			queues,
+			os.Getenv(publisherQueueEnv),
+			messenger.WithMetrics(recorder),
+		), nil
+	case eventBridgeMessenger:
+		return messenger.NewEventBridge(
+			eventbridge.NewFromConfig(cfg),
+			os.Getenv(eventBusEnv),
+			messenger.WithMetrics(recorder),
+		), nil
+	case "", "sns":
+		return messenger.New(
 			sns.NewFromConfig(cfg),
 			os.Getenv(jobsTopicEnv),
 			os.Getenv(publisherTopicEnv),
-		),
-		[]publisher.HostOption{
-			{
-				Host:  ec2Host,
-				Limit: int32(ec2Limits),
-			},
-			{
-				Host:  eksHost,
-				Limit: int32(eksLimits),
-			},
+			messenger.WithMetrics(recorder),
+		), nil
+	default:
+		return nil, fmt.Errorf("unsupported messenger: %v", os.Getenv(messengerEnv))
+	}
+}
+
+// getHostOptions reads the limits per host, OS and labels from CONCURRENCY_LIMITS, e.g.
+// [{"Host":"ec2","OS":"ubuntu","Limit":20},{"Host":"ec2","OS":"windows","Limit":2}], and falls back
+// to a limit per host from EC2_CURRENCY_LIMIT and EKS_CURRENCY_LIMIT.
+func getHostOptions() ([]publisher.HostOption, error) {
+	if v := os.Getenv(concurrencyLimitEnv); v != "" {
+		opts := make([]publisher.HostOption, 0)
+		if err := json.Unmarshal([]byte(v), &opts); err != nil {
+			return nil, fmt.Errorf("invalid concurrency limits: %v", err)
+		}
+
+		return opts, nil
+	}
+
+	ec2Limits, ec2Err := strconv.ParseInt(os.Getenv(ec2CurrencyLimitEnv), 10, 32)
+	if ec2Err != nil {
+		return nil, ec2Err
+	}
+
+	eksLimits, eksErr := strconv.ParseInt(os.Getenv(eksCurrencyLimitEnv), 10, 32)
+	if eksErr != nil {
+		return nil, eksErr
+	}
+
+	return []publisher.HostOption{
+		{
+			Host:  ec2Host,
+			Limit: int32(ec2Limits),
 		},
-		logger,
-	)))
+		{
+			Host:  eksHost,
+			Limit: int32(eksLimits),
+		},
+	}, nil
+}
+
+// getLimitSource reads the limits at runtime from the LIMITS_PARAMETER SSM parameter, or the
+// LIMITS_NAME item of LIMITS_TABLE, the limits from the environment are used as defaults.
+// LIMIT_SCHEDULES overrides the limits by time of day, e.g.
+// [{"Host":"ec2","Cron":"* 0-6 * * *","Timezone":"Australia/Melbourne","Limit":2}].
+// getLimitSource falls back to the defaults before applying the schedules, so the schedules still
+// apply while the runtime limits are unavailable.
+func getLimitSource(
+	cfg aws.Config,
+	defaults []publisher.HostOption,
+	logger *zap.Logger,
+) (publisher.LimitSource, error) {
+	source, err := getRuntimeLimitSource(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if source != nil {
+		source = limits.NewFallbackSource(source, defaults, logger)
+	}
+
+	v := os.Getenv(limitSchedulesEnv)
+	if v == "" {
+		return source, nil
+	}
+
+	overrides := make([]limits.Override, 0)
+	if err := json.Unmarshal([]byte(v), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid limit schedules: %v", err)
+	}
+
+	if source == nil {
+		source = limits.NewStaticSource(defaults)
+	}
+
+	return limits.NewScheduledSource(source, overrides)
+}
+
+func getRuntimeLimitSource(cfg aws.Config) (publisher.LimitSource, error) {
+	var source publisher.LimitSource
+	switch {
+	case os.Getenv(limitsParameterEnv) != "":
+		source = limits.NewSSMSource(ssm.NewFromConfig(cfg), os.Getenv(limitsParameterEnv))
+	case os.Getenv(limitsTableEnv) != "":
+		name := os.Getenv(limitsNameEnv)
+		if name == "" {
+			name = defaultLimitsName
+		}
+
+		source = limits.NewDynamoDBSource(dynamodb.NewFromConfig(cfg), os.Getenv(limitsTableEnv), name)
+	default:
+		return nil, nil
+	}
+
+	ttl := limits.DefaultTTL
+	if v := os.Getenv(limitsCacheTTLEnv); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, err
+		}
+
+		ttl = d
+	}
+
+	return limits.NewCachedSource(source, ttl), nil
+}
+
+// getStaleJobsConfig requeues, or expires when STALE_JOB_ACTION is expire, the jobs in progress for
+// longer than STALE_JOB_THRESHOLD.
+func getStaleJobsConfig() (publisher.StaleJobsConfig, error) {
+	config := publisher.StaleJobsConfig{Action: publisher.RequeueStaleJobs}
+	if v := os.Getenv(staleJobActionEnv); v != "" {
+		config.Action = publisher.StaleAction(v)
+		if config.Action != publisher.RequeueStaleJobs && config.Action != publisher.ExpireStaleJobs {
+			return config, fmt.Errorf("invalid stale job action %q", v)
+		}
+	}
+
+	if v := os.Getenv(staleJobThresholdEnv); v != "" {
+		threshold, err := time.ParseDuration(v)
+		if err != nil {
+			return config, err
+		}
+
+		config.Threshold = threshold
+	}
+
+	return config, nil
+}
+
+func getBreakerCooldown() (time.Duration, error) {
+	if v := os.Getenv(breakerCooldownEnv); v != "" {
+		return time.ParseDuration(v)
+	}
+
+	return breaker.DefaultCooldown, nil
+}
+
+// getScheduler configures the SCHEDULER, fair_share or priority, jobs are published in index
+// order by default.
+func getScheduler() (publisher.Scheduler, error) {
+	switch os.Getenv(schedulerEnv) {
+	case fairShareScheduler:
+		weights, err := parseShares(os.Getenv(fairShareWeightsEnv))
+		if err != nil {
+			return nil, err
+		}
+
+		caps, err := parseShares(os.Getenv(fairShareCapsEnv))
+		if err != nil {
+			return nil, err
+		}
+
+		return publisher.NewFairShareScheduler(&publisher.FairShareConfig{
+			Weights: weights,
+			Caps:    caps,
+		}), nil
+	case priorityScheduler:
+		config := new(publisher.PriorityConfig)
+		if v := os.Getenv(priorityRulesEnv); v != "" {
+			if err := json.Unmarshal([]byte(v), &config.Rules); err != nil {
+				return nil, fmt.Errorf("invalid priority rules: %v", err)
+			}
+		}
+
+		if v := os.Getenv(priorityAgingEnv); v != "" {
+			interval, err := time.ParseDuration(v)
+			if err != nil {
+				return nil, err
+			}
+
+			config.AgingInterval = interval
+		}
+
+		return publisher.NewPriorityScheduler(config), nil
+	default:
+		return publisher.NewFIFOScheduler(), nil
+	}
+}
+
+// parseShares parses "owner/repository=3,owner=2" into weights or caps.
+func parseShares(v string) (map[string]int, error) {
+	shares := make(map[string]int)
+	if v == "" {
+		return shares, nil
+	}
+
+	for _, pair := range strings.Split(v, ",") {
+		kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+		if len(kv) != 2 {
+			return nil, fmt.Errorf("invalid share %q, expected key=value", pair)
+		}
+
+		n, err := strconv.Atoi(kv[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid share %q: %v", pair, err)
+		}
+
+		shares[kv[0]] = n
+	}
+
+	return shares, nil
 }
 
 func handleError(err error) {
@@ -0,0 +1,144 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+)
+
+// State of a runner type breaker, the orchestrator opens a breaker after consecutive launch
+// failures and closes it after a successful launch.
+type State string
+
+const (
+	Closed   State = "closed"
+	Open     State = "open"
+	HalfOpen State = "half_open"
+
+	// DefaultCooldown is how long an open breaker waits before probing the runner type.
+	DefaultCooldown = 5 * time.Minute
+)
+
+type Breaker interface {
+	// State returns the breaker state of the runner type, an open breaker becomes half-open once the
+	// cooldown has elapsed, and a half-open breaker allows one probe per cooldown.
+	State(ctx context.Context, runnerType string) (State, error)
+}
+
+type DynamoDBAPIClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+	UpdateItem(
+		ctx context.Context,
+		params *dynamodb.UpdateItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+}
+
+type item struct {
+	State    State
+	OpenedAt int64
+	ProbeAt  int64
+}
+
+type dynamoDBBreaker struct {
+	client   DynamoDBAPIClient
+	table    string
+	cooldown time.Duration
+	now      func() time.Time
+}
+
+func (b *dynamoDBBreaker) State(ctx context.Context, runnerType string) (State, error) {
+	o, err := b.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      aws.String(b.table),
+		Key:            getKey(runnerType),
+		ConsistentRead: aws.Bool(true),
+	})
+
+	if err != nil {
+		return Closed, err
+	}
+
+	i := new(item)
+	if err := attributevalue.UnmarshalMap(o.Item, i); err != nil {
+		return Closed, err
+	}
+
+	switch i.State {
+	case Open:
+		if b.now().Before(time.Unix(i.OpenedAt, 0).Add(b.cooldown)) {
+			return Open, nil
+		}
+	case HalfOpen:
+		// the probe is still in flight.
+		if b.now().Before(time.Unix(i.ProbeAt, 0).Add(b.cooldown)) {
+			return Open, nil
+		}
+	default:
+		return Closed, nil
+	}
+
+	return b.probe(ctx, runnerType, i)
+}
+
+// probe half-opens the breaker unless the orchestrator has changed it since it was read.
+func (b *dynamoDBBreaker) probe(ctx context.Context, runnerType string, i *item) (State, error) {
+	_, err := b.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(b.table),
+		Key:                 getKey(runnerType),
+		UpdateExpression:    aws.String("SET #s = :half_open, ProbeAt = :now"),
+		ConditionExpression: aws.String("#s = :s AND OpenedAt = :opened_at"),
+		ExpressionAttributeNames: map[string]string{
+			"#s": "State",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":half_open": &types.AttributeValueMemberS{Value: string(HalfOpen)},
+			":now":       &types.AttributeValueMemberN{Value: strconv.FormatInt(b.now().Unix(), 10)},
+			":s":         &types.AttributeValueMemberS{Value: string(i.State)},
+			":opened_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(i.OpenedAt, 10)},
+		},
+	})
+
+	var e *types.ConditionalCheckFailedException
+	if errors.As(err, &e) {
+		return Open, nil
+	}
+
+	if err != nil {
+		return Open, err
+	}
+
+	return HalfOpen, nil
+}
+
+func getKey(runnerType string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"RunnerType": &types.AttributeValueMemberS{Value: runnerType},
+	}
+}
+
+// New reads the breaker state the orchestrator records per RunnerType.
+func New(client DynamoDBAPIClient, table string, cooldown time.Duration) Breaker {
+	return &dynamoDBBreaker{
+		client:   client,
+		table:    table,
+		cooldown: cooldown,
+		now:      time.Now,
+	}
+}
+
+type nopBreaker struct{}
+
+func (nopBreaker) State(context.Context, string) (State, error) {
+	return Closed, nil
+}
+
+// NewNop returns a breaker which is always closed.
+func NewNop() Breaker {
+	return nopBreaker{}
+}
@@ -0,0 +1,159 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDynamoDBBreaker_State(t *testing.T) {
+	now := time.Unix(1640995200, 0)
+	probeInput := func(state State, openedAt string) *dynamodb.UpdateItemInput {
+		return &dynamodb.UpdateItemInput{
+			TableName:           aws.String("table"),
+			Key:                 getKey("ec2"),
+			UpdateExpression:    aws.String("SET #s = :half_open, ProbeAt = :now"),
+			ConditionExpression: aws.String("#s = :s AND OpenedAt = :opened_at"),
+			ExpressionAttributeNames: map[string]string{
+				"#s": "State",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":half_open": &types.AttributeValueMemberS{Value: string(HalfOpen)},
+				":now":       &types.AttributeValueMemberN{Value: "1640995200"},
+				":s":         &types.AttributeValueMemberS{Value: string(state)},
+				":opened_at": &types.AttributeValueMemberN{Value: openedAt},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		item          map[string]types.AttributeValue
+		getErr        error
+		updateErr     error
+		expectedInput *dynamodb.UpdateItemInput
+		state         State
+		err           error
+	}{
+		"breaker not found": {
+			state: Closed,
+		},
+		"closed breaker": {
+			item:  getItem(Closed, "0", ""),
+			state: Closed,
+		},
+		"open breaker in cooldown": {
+			item:  getItem(Open, "1640995000", ""),
+			state: Open,
+		},
+		"half-open breaker after cooldown": {
+			item:          getItem(Open, "1640994900", ""),
+			expectedInput: probeInput(Open, "1640994900"),
+			state:         HalfOpen,
+		},
+		"half-open breaker with probe in flight": {
+			item:  getItem(HalfOpen, "1640994000", "1640995000"),
+			state: Open,
+		},
+		"probe again after cooldown": {
+			item:          getItem(HalfOpen, "1640994000", "1640994900"),
+			expectedInput: probeInput(HalfOpen, "1640994000"),
+			state:         HalfOpen,
+		},
+		"breaker changed by orchestrator": {
+			item:          getItem(Open, "1640994900", ""),
+			updateErr:     &types.ConditionalCheckFailedException{},
+			expectedInput: probeInput(Open, "1640994900"),
+			state:         Open,
+		},
+		"failed to get breaker": {
+			getErr: errors.New("some error"),
+			state:  Closed,
+			err:    errors.New("some error"),
+		},
+		"failed to half-open breaker": {
+			item:          getItem(Open, "1640994900", ""),
+			updateErr:     errors.New("some error"),
+			expectedInput: probeInput(Open, "1640994900"),
+			state:         Open,
+			err:           errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedDynamoDBClient{item: tc.item, getErr: tc.getErr, updateErr: tc.updateErr}
+			b := New(client, "table", time.Minute*5).(*dynamoDBBreaker)
+			b.now = func() time.Time { return now }
+
+			state, err := b.State(context.TODO(), "ec2")
+
+			a.Equal(tc.state, state)
+			a.Equal(tc.err, err)
+			a.Equal(&dynamodb.GetItemInput{
+				TableName:      aws.String("table"),
+				Key:            getKey("ec2"),
+				ConsistentRead: aws.Bool(true),
+			}, client.getInput)
+			a.Equal(tc.expectedInput, client.updateInput)
+		})
+	}
+}
+
+func TestNopBreaker_State(t *testing.T) {
+	a := assert.New(t)
+	state, err := NewNop().State(context.TODO(), "ec2")
+
+	a.Equal(Closed, state)
+	a.Nil(err)
+}
+
+func getItem(state State, openedAt, probeAt string) map[string]types.AttributeValue {
+	item := map[string]types.AttributeValue{
+		"RunnerType": &types.AttributeValueMemberS{Value: "ec2"},
+		"State":      &types.AttributeValueMemberS{Value: string(state)},
+		"OpenedAt":   &types.AttributeValueMemberN{Value: openedAt},
+	}
+
+	if probeAt != "" {
+		item["ProbeAt"] = &types.AttributeValueMemberN{Value: probeAt}
+	}
+
+	return item
+}
+
+type mockedDynamoDBClient struct {
+	getInput    *dynamodb.GetItemInput
+	updateInput *dynamodb.UpdateItemInput
+	item        map[string]types.AttributeValue
+	getErr      error
+	updateErr   error
+}
+
+func (m *mockedDynamoDBClient) GetItem(
+	_ context.Context,
+	params *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+	m.getInput = params
+	if m.getErr != nil {
+		return nil, m.getErr
+	}
+
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+func (m *mockedDynamoDBClient) UpdateItem(
+	_ context.Context,
+	params *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	m.updateInput = params
+	return new(dynamodb.UpdateItemOutput), m.updateErr
+}
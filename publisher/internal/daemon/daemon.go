@@ -0,0 +1,237 @@
+package daemon
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"go.uber.org/zap"
+)
+
+const (
+	DefaultInterval        = 30 * time.Second
+	DefaultRunTimeout      = 5 * time.Minute
+	DefaultShutdownTimeout = 30 * time.Second
+)
+
+var errNotReady = errors.New("publisher has not run yet")
+
+type Config struct {
+	// Interval between two publish runs.
+	Interval time.Duration
+	// RunTimeout bounds a publish run.
+	RunTimeout time.Duration
+	// ShutdownTimeout bounds the in-flight run once the daemon shuts down, and then the shutdown of the
+	// health server.
+	ShutdownTimeout time.Duration
+	// Addr serves GET /healthz, GET /readyz and POST /wake, the server is disabled if it's empty.
+	Addr string
+	// WakeToken authorises POST /wake as a bearer token, /wake is not served if it's empty.
+	WakeToken string
+}
+
+var DefaultConfig = Config{
+	Interval:        DefaultInterval,
+	RunTimeout:      DefaultRunTimeout,
+	ShutdownTimeout: DefaultShutdownTimeout,
+}
+
+type Daemon interface {
+	// Run publishes on start, on each tick and on each wake-up, until the context is done.
+	Run(ctx context.Context) error
+	// Wake requests a publish run without waiting for the next tick.
+	Wake()
+}
+
+type daemon struct {
+	sync.RWMutex
+	publisher    publisher.Publisher
+	config       Config
+	logger       *zap.Logger
+	wake         chan struct{}
+	shuttingDown int32
+	lastErr      error
+}
+
+// Run publishes in a single loop, so runs never overlap, the wake-ups received during a run are
+// coalesced into one run after it.
+func (d *daemon) Run(ctx context.Context) error {
+	srv, err := d.serve()
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(d.config.Interval)
+	defer ticker.Stop()
+
+	d.publish(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			d.logger.Info("shutting down publisher daemon")
+			return d.shutdown(srv)
+		case <-ticker.C:
+			d.publish(ctx)
+		case <-d.wake:
+			d.publish(ctx)
+		}
+	}
+}
+
+func (d *daemon) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// publish doesn't start a run once the daemon shuts down, and gives the in-flight run ShutdownTimeout
+// to finish before cancelling it, so the process isn't killed in the middle of the run.
+func (d *daemon) publish(ctx context.Context) {
+	if ctx.Err() != nil {
+		return
+	}
+
+	runCtx, cancel := context.WithTimeout(context.Background(), d.config.RunTimeout)
+	defer cancel()
+
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+		case <-done:
+			return
+		}
+
+		t := time.NewTimer(d.config.ShutdownTimeout)
+		defer t.Stop()
+
+		select {
+		case <-t.C:
+			cancel()
+		case <-done:
+		}
+	}()
+
+	err := d.publisher.Publish(runCtx)
+	if err != nil {
+		d.logger.Error("failed to publish jobs", zap.Error(err))
+	}
+
+	d.Lock()
+	defer d.Unlock()
+	d.lastErr = err
+}
+
+func (d *daemon) serve() (*http.Server, error) {
+	if d.config.Addr == "" {
+		return nil, nil
+	}
+
+	l, err := net.Listen("tcp", d.config.Addr)
+	if err != nil {
+		return nil, err
+	}
+
+	srv := &http.Server{Handler: d.handler()}
+	go func() {
+		if sErr := srv.Serve(l); sErr != nil && !errors.Is(sErr, http.ErrServerClosed) {
+			d.logger.Error("health server stopped", zap.Error(sErr))
+		}
+	}()
+
+	return srv, nil
+}
+
+func (d *daemon) shutdown(srv *http.Server) error {
+	atomic.StoreInt32(&d.shuttingDown, 1)
+	if srv == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), d.config.ShutdownTimeout)
+	defer cancel()
+
+	return srv.Shutdown(ctx)
+}
+
+// handler serves the liveness of the daemon on /healthz, its readiness on /readyz, i.e. the last run
+// succeeded, and wakes it up on /wake when a wake token is configured.
+func (d *daemon) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
+		if atomic.LoadInt32(&d.shuttingDown) == 1 {
+			http.Error(w, "shutting down", http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	mux.HandleFunc("/readyz", func(w http.ResponseWriter, _ *http.Request) {
+		d.RLock()
+		err := d.lastErr
+		d.RUnlock()
+
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+
+		_, _ = w.Write([]byte("ok"))
+	})
+
+	if d.config.WakeToken == "" {
+		return mux
+	}
+
+	mux.HandleFunc("/wake", func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+			return
+		}
+
+		token := []byte("Bearer " + d.config.WakeToken)
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), token) != 1 {
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+
+		d.Wake()
+		w.WriteHeader(http.StatusAccepted)
+	})
+
+	return mux
+}
+
+func New(p publisher.Publisher, config Config, logger *zap.Logger) Daemon {
+	return &daemon{
+		publisher: p,
+		config:    config,
+		logger:    logger,
+		wake:      make(chan struct{}, 1),
+		lastErr:   errNotReady,
+	}
+}
+
+type quietMessenger struct {
+	messenger.Messenger
+}
+
+func (quietMessenger) NotifyPublisher(context.Context) error {
+	return nil
+}
+
+// NewQuietMessenger drops the publisher notifications of the messenger, the daemon publishes on its
+// ticker instead of re-triggering itself.
+func NewQuietMessenger(m messenger.Messenger) messenger.Messenger {
+	return quietMessenger{Messenger: m}
+}
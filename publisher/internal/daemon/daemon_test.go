@@ -0,0 +1,306 @@
+package daemon
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestDaemon_Run(t *testing.T) {
+	cases := map[string]struct {
+		interval time.Duration
+		wakes    int
+		expected int
+	}{
+		"publish on start": {
+			interval: time.Hour,
+			expected: 1,
+		},
+		"publish on tick": {
+			interval: 10 * time.Millisecond,
+			expected: 3,
+		},
+		"publish on wake-up": {
+			interval: time.Hour,
+			wakes:    1,
+			expected: 2,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			p := &mockedPublisher{called: make(chan struct{}, 10)}
+			d := New(p, Config{Interval: tc.interval, RunTimeout: time.Second}, zap.NewNop())
+			ctx, cancel := context.WithCancel(context.TODO())
+
+			done := make(chan error)
+			go func() { done <- d.Run(ctx) }()
+
+			<-p.called
+			for i := 0; i < tc.wakes; i++ {
+				d.Wake()
+			}
+
+			for i := 1; i < tc.expected; i++ {
+				<-p.called
+			}
+
+			cancel()
+			a.Nil(<-done)
+			a.GreaterOrEqual(p.calls(), tc.expected)
+			a.Equal(1, p.maxRunning)
+		})
+	}
+}
+
+func TestDaemon_RunWaitsForInFlightRun(t *testing.T) {
+	a := assert.New(t)
+	p := &mockedPublisher{called: make(chan struct{}, 1), block: make(chan struct{})}
+	d := New(p, Config{Interval: time.Hour, RunTimeout: time.Second, ShutdownTimeout: time.Second}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	<-p.called
+	cancel()
+	d.Wake()
+	d.Wake()
+
+	select {
+	case <-done:
+		a.Fail("daemon stopped during a run")
+	case <-time.After(20 * time.Millisecond):
+	}
+
+	close(p.block)
+	a.Nil(<-done)
+	a.Nil(p.err)
+}
+
+func TestDaemon_RunCancelsInFlightRunAfterShutdownTimeout(t *testing.T) {
+	a := assert.New(t)
+	p := &mockedPublisher{called: make(chan struct{}, 1), block: make(chan struct{})}
+	d := New(p, Config{Interval: time.Hour, RunTimeout: time.Minute, ShutdownTimeout: 10 * time.Millisecond}, zap.NewNop())
+	ctx, cancel := context.WithCancel(context.TODO())
+
+	done := make(chan error)
+	go func() { done <- d.Run(ctx) }()
+
+	<-p.called
+	cancel()
+
+	select {
+	case err := <-done:
+		a.Nil(err)
+	case <-time.After(time.Second):
+		a.Fail("in-flight run was not cancelled")
+	}
+
+	a.Equal(context.Canceled, p.err)
+	a.Equal(1, p.calls())
+}
+
+func TestDaemon_Wake(t *testing.T) {
+	a := assert.New(t)
+	d := New(new(mockedPublisher), DefaultConfig, zap.NewNop()).(*daemon)
+
+	d.Wake()
+	d.Wake()
+
+	a.Len(d.wake, 1)
+}
+
+func TestDaemon_Handler(t *testing.T) {
+	cases := map[string]struct {
+		method       string
+		path         string
+		wakeToken    string
+		auth         string
+		lastErr      error
+		shuttingDown bool
+		expectedCode int
+		expectedBody string
+		expectedWake int
+	}{
+		"alive": {
+			method:       http.MethodGet,
+			path:         "/healthz",
+			expectedCode: http.StatusOK,
+			expectedBody: "ok",
+		},
+		"shutting down": {
+			method:       http.MethodGet,
+			path:         "/healthz",
+			shuttingDown: true,
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "shutting down\n",
+		},
+		"ready": {
+			method:       http.MethodGet,
+			path:         "/readyz",
+			expectedCode: http.StatusOK,
+			expectedBody: "ok",
+		},
+		"last run failed": {
+			method:       http.MethodGet,
+			path:         "/readyz",
+			lastErr:      errors.New("some error"),
+			expectedCode: http.StatusServiceUnavailable,
+			expectedBody: "some error\n",
+		},
+		"wake up": {
+			method:       http.MethodPost,
+			path:         "/wake",
+			wakeToken:    "token",
+			auth:         "Bearer token",
+			expectedCode: http.StatusAccepted,
+			expectedWake: 1,
+		},
+		"wake up with get": {
+			method:       http.MethodGet,
+			path:         "/wake",
+			wakeToken:    "token",
+			auth:         "Bearer token",
+			expectedCode: http.StatusMethodNotAllowed,
+			expectedBody: "Method Not Allowed\n",
+		},
+		"wake up with invalid token": {
+			method:       http.MethodPost,
+			path:         "/wake",
+			wakeToken:    "token",
+			auth:         "Bearer other",
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: "Unauthorized\n",
+		},
+		"wake up without token": {
+			method:       http.MethodPost,
+			path:         "/wake",
+			wakeToken:    "token",
+			expectedCode: http.StatusUnauthorized,
+			expectedBody: "Unauthorized\n",
+		},
+		"wake up disabled": {
+			method:       http.MethodPost,
+			path:         "/wake",
+			auth:         "Bearer ",
+			expectedCode: http.StatusNotFound,
+			expectedBody: "404 page not found\n",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			config := DefaultConfig
+			config.WakeToken = tc.wakeToken
+			d := New(new(mockedPublisher), config, zap.NewNop()).(*daemon)
+			d.lastErr = tc.lastErr
+			if tc.shuttingDown {
+				d.shuttingDown = 1
+			}
+
+			r := httptest.NewRequest(tc.method, tc.path, nil)
+			if tc.auth != "" {
+				r.Header.Set("Authorization", tc.auth)
+			}
+
+			w := httptest.NewRecorder()
+			d.handler().ServeHTTP(w, r)
+
+			a.Equal(tc.expectedCode, w.Code)
+			a.Equal(tc.expectedBody, w.Body.String())
+			a.Len(d.wake, tc.expectedWake)
+		})
+	}
+}
+
+func TestDaemon_NotReadyBeforeFirstRun(t *testing.T) {
+	a := assert.New(t)
+	d := New(new(mockedPublisher), DefaultConfig, zap.NewNop()).(*daemon)
+
+	w := httptest.NewRecorder()
+	d.handler().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/readyz", nil))
+
+	a.Equal(http.StatusServiceUnavailable, w.Code)
+	a.Equal("publisher has not run yet\n", w.Body.String())
+}
+
+func TestNewQuietMessenger(t *testing.T) {
+	a := assert.New(t)
+	m := &mockedMessenger{err: errors.New("some error")}
+	q := NewQuietMessenger(m)
+
+	a.Nil(q.NotifyPublisher(context.TODO()))
+	a.Equal(m.err, q.PublishJobs(context.TODO(), nil))
+	a.False(m.notified)
+}
+
+type mockedPublisher struct {
+	sync.Mutex
+	called     chan struct{}
+	block      chan struct{}
+	n          int
+	running    int
+	maxRunning int
+	err        error
+}
+
+func (m *mockedPublisher) Publish(ctx context.Context) error {
+	m.Lock()
+	m.n++
+	m.running++
+	if m.running > m.maxRunning {
+		m.maxRunning = m.running
+	}
+	m.Unlock()
+
+	if m.called != nil {
+		m.called <- struct{}{}
+	}
+
+	if m.block != nil {
+		select {
+		case <-m.block:
+		case <-ctx.Done():
+		}
+
+		m.err = ctx.Err()
+	}
+
+	m.Lock()
+	defer m.Unlock()
+	m.running--
+
+	return nil
+}
+
+func (m *mockedPublisher) calls() int {
+	m.Lock()
+	defer m.Unlock()
+
+	return m.n
+}
+
+type mockedMessenger struct {
+	notified bool
+	err      error
+}
+
+func (m *mockedMessenger) PublishJobs(context.Context, []messenger.Message) error {
+	return m.err
+}
+
+func (m *mockedMessenger) NotifyPublisher(context.Context) error {
+	m.notified = true
+	return m.err
+}
@@ -0,0 +1,115 @@
+package limits
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type cronField struct {
+	min, max int
+}
+
+var cronFields = []cronField{
+	{0, 59}, // minute
+	{0, 23}, // hour
+	{1, 31}, // day of month
+	{1, 12}, // month
+	{0, 7},  // day of week, 0 and 7 are Sunday
+}
+
+// cron matches the minutes of a standard five fields cron expression, fields support *, lists,
+// ranges and steps, e.g. "*/15 9-17 * * 1-5".
+type cron struct {
+	fields [5]uint64
+	// when day of month and day of week are both restricted, either of them matches.
+	anyDay bool
+}
+
+func (c *cron) match(t time.Time) bool {
+	if !has(c.fields[0], t.Minute()) || !has(c.fields[1], t.Hour()) || !has(c.fields[3], int(t.Month())) {
+		return false
+	}
+
+	dom, dow := has(c.fields[2], t.Day()), has(c.fields[4], int(t.Weekday()))
+	if c.anyDay {
+		return dom || dow
+	}
+
+	return dom && dow
+}
+
+func parseCron(expr string) (*cron, error) {
+	parts := strings.Fields(expr)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("invalid cron %q, expected 5 fields", expr)
+	}
+
+	c := new(cron)
+	for i, p := range parts {
+		bits, err := parseCronField(p, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("invalid cron %q: %v", expr, err)
+		}
+
+		c.fields[i] = bits
+	}
+
+	// Sunday is either 0 or 7.
+	if has(c.fields[4], 7) {
+		c.fields[4] |= 1
+	}
+
+	c.anyDay = parts[2] != "*" && parts[4] != "*"
+	return c, nil
+}
+
+func parseCronField(field string, f cronField) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		rng, step := part, 1
+		if i := strings.Index(part, "/"); i >= 0 {
+			s, err := strconv.Atoi(part[i+1:])
+			if err != nil || s <= 0 {
+				return 0, fmt.Errorf("invalid step %q", part)
+			}
+
+			rng, step = part[:i], s
+		}
+
+		start, end := f.min, f.max
+		if rng != "*" {
+			bounds := strings.SplitN(rng, "-", 2)
+			var err error
+			if start, err = strconv.Atoi(bounds[0]); err != nil {
+				return 0, fmt.Errorf("invalid value %q", part)
+			}
+
+			end = start
+			if len(bounds) == 1 && rng != part {
+				end = f.max
+			}
+
+			if len(bounds) == 2 {
+				if end, err = strconv.Atoi(bounds[1]); err != nil {
+					return 0, fmt.Errorf("invalid value %q", part)
+				}
+			}
+		}
+
+		if start < f.min || end > f.max || start > end {
+			return 0, fmt.Errorf("value %q out of range %v-%v", part, f.min, f.max)
+		}
+
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+
+	return bits, nil
+}
+
+func has(bits uint64, v int) bool {
+	return bits&(1<<uint(v)) != 0
+}
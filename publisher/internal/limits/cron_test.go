@@ -0,0 +1,105 @@
+package limits
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCron_Match(t *testing.T) {
+	// Monday 2022-01-03 09:30 UTC.
+	monday := time.Date(2022, 1, 3, 9, 30, 0, 0, time.UTC)
+	cases := map[string]struct {
+		expr     string
+		time     time.Time
+		expected bool
+	}{
+		"every minute": {
+			expr:     "* * * * *",
+			time:     monday,
+			expected: true,
+		},
+		"business hours": {
+			expr:     "* 9-17 * * 1-5",
+			time:     monday,
+			expected: true,
+		},
+		"outside business hours": {
+			expr: "* 9-17 * * 1-5",
+			time: monday.Add(9 * time.Hour),
+		},
+		"weekend": {
+			expr: "* 9-17 * * 1-5",
+			time: monday.AddDate(0, 0, -1),
+		},
+		"sunday as 7": {
+			expr:     "* * * * 6,7",
+			time:     monday.AddDate(0, 0, -1),
+			expected: true,
+		},
+		"steps": {
+			expr:     "*/15 * * * *",
+			time:     monday,
+			expected: true,
+		},
+		"steps from a value": {
+			expr: "10/15 * * * *",
+			time: monday,
+		},
+		"day of month or day of week": {
+			expr:     "* * 15 * 1",
+			time:     monday,
+			expected: true,
+		},
+		"month": {
+			expr: "* * * 2-12 *",
+			time: monday,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			c, err := parseCron(tc.expr)
+
+			a.Nil(err)
+			a.Equal(tc.expected, c.match(tc.time))
+		})
+	}
+}
+
+func TestParseCron_Error(t *testing.T) {
+	cases := map[string]struct {
+		expr string
+		err  error
+	}{
+		"missing fields": {
+			expr: "* * * *",
+			err:  errors.New(`invalid cron "* * * *", expected 5 fields`),
+		},
+		"invalid value": {
+			expr: "* nine * * *",
+			err:  errors.New(`invalid cron "* nine * * *": invalid value "nine"`),
+		},
+		"out of range": {
+			expr: "* 9-24 * * *",
+			err:  errors.New(`invalid cron "* 9-24 * * *": value "9-24" out of range 0-23`),
+		},
+		"invalid step": {
+			expr: "*/0 * * * *",
+			err:  errors.New(`invalid cron "*/0 * * * *": invalid step "*/0"`),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			c, err := parseCron(tc.expr)
+
+			a.Nil(c)
+			a.Equal(tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,191 @@
+package limits
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"go.uber.org/zap"
+)
+
+// DefaultTTL is how long the limits are cached, changes are picked up within the TTL.
+const DefaultTTL = time.Minute
+
+type SSMAPIClient interface {
+	GetParameter(ctx context.Context, params *ssm.GetParameterInput, optFns ...func(*ssm.Options)) (*ssm.GetParameterOutput, error)
+}
+
+type DynamoDBAPIClient interface {
+	GetItem(ctx context.Context, params *dynamodb.GetItemInput, optFns ...func(*dynamodb.Options)) (*dynamodb.GetItemOutput, error)
+}
+
+type ssmSource struct {
+	client SSMAPIClient
+	name   string
+}
+
+func (s *ssmSource) HostOptions(ctx context.Context) ([]publisher.HostOption, error) {
+	o, err := s.client.GetParameter(ctx, &ssm.GetParameterInput{
+		Name: aws.String(s.name),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	if o.Parameter == nil {
+		return nil, nil
+	}
+
+	opts := make([]publisher.HostOption, 0)
+	if err := json.Unmarshal([]byte(aws.ToString(o.Parameter.Value)), &opts); err != nil {
+		return nil, fmt.Errorf("invalid limits parameter %v: %v", s.name, err)
+	}
+
+	if err := validate(opts); err != nil {
+		return nil, err
+	}
+
+	return opts, nil
+}
+
+// NewSSMSource reads the limits from a parameter holding a JSON list of host options, e.g.
+// [{"Host":"ec2","OS":"ubuntu","Limit":20},{"Host":"ec2","OS":"windows","Limit":2}].
+func NewSSMSource(client SSMAPIClient, name string) publisher.LimitSource {
+	return &ssmSource{
+		client: client,
+		name:   name,
+	}
+}
+
+type item struct {
+	Limits []publisher.HostOption
+}
+
+type dynamoDBSource struct {
+	client DynamoDBAPIClient
+	table  string
+	name   string
+}
+
+func (s *dynamoDBSource) HostOptions(ctx context.Context) ([]publisher.HostOption, error) {
+	o, err := s.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName: aws.String(s.table),
+		Key: map[string]types.AttributeValue{
+			"Name": &types.AttributeValueMemberS{Value: s.name},
+		},
+		ConsistentRead: aws.Bool(true),
+	})
+
+	if err != nil {
+		return nil, err
+	}
+
+	i := new(item)
+	if err := attributevalue.UnmarshalMap(o.Item, i); err != nil {
+		return nil, fmt.Errorf("invalid limits item %v: %v", s.name, err)
+	}
+
+	if err := validate(i.Limits); err != nil {
+		return nil, err
+	}
+
+	return i.Limits, nil
+}
+
+// NewDynamoDBSource reads the limits from the Limits list of the item keyed by Name.
+func NewDynamoDBSource(client DynamoDBAPIClient, table, name string) publisher.LimitSource {
+	return &dynamoDBSource{
+		client: client,
+		table:  table,
+		name:   name,
+	}
+}
+
+type cachedSource struct {
+	sync.Mutex
+	source    publisher.LimitSource
+	ttl       time.Duration
+	now       func() time.Time
+	opts      []publisher.HostOption
+	expiredAt time.Time
+}
+
+func (s *cachedSource) HostOptions(ctx context.Context) ([]publisher.HostOption, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	if s.now().Before(s.expiredAt) {
+		return s.opts, nil
+	}
+
+	opts, err := s.source.HostOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	s.opts = opts
+	s.expiredAt = s.now().Add(s.ttl)
+	return opts, nil
+}
+
+// NewCachedSource caches the limits of the source for the TTL, errors are not cached.
+func NewCachedSource(source publisher.LimitSource, ttl time.Duration) publisher.LimitSource {
+	return &cachedSource{
+		source: source,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+type fallbackSource struct {
+	source   publisher.LimitSource
+	defaults []publisher.HostOption
+	logger   *zap.Logger
+}
+
+func (s *fallbackSource) HostOptions(ctx context.Context) ([]publisher.HostOption, error) {
+	opts, err := s.source.HostOptions(ctx)
+	switch {
+	case err != nil:
+		s.logger.Warn("failed to get concurrency limits, using defaults", zap.Error(err))
+	case len(opts) == 0:
+		s.logger.Warn("no concurrency limits configured, using defaults")
+	default:
+		return opts, nil
+	}
+
+	return s.defaults, nil
+}
+
+// NewFallbackSource returns the defaults when the source fails or has no limits, so the limits
+// wrapping it, e.g. the scheduled overrides, still apply while the source is unavailable.
+func NewFallbackSource(source publisher.LimitSource, defaults []publisher.HostOption, logger *zap.Logger) publisher.LimitSource {
+	return &fallbackSource{
+		source:   source,
+		defaults: defaults,
+		logger:   logger,
+	}
+}
+
+func validate(opts []publisher.HostOption) error {
+	for _, o := range opts {
+		if o.Host == "" {
+			return fmt.Errorf("invalid limit %+v, host is required", o)
+		}
+
+		if o.Limit < 0 {
+			return fmt.Errorf("invalid limit %+v, limit must not be negative", o)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,253 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	ssmtypes "github.com/aws/aws-sdk-go-v2/service/ssm/types"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestSSMSource_HostOptions(t *testing.T) {
+	cases := map[string]struct {
+		value    string
+		getErr   error
+		expected []publisher.HostOption
+		err      error
+	}{
+		"limits per host and os": {
+			value: `[{"Host":"ec2","OS":"ubuntu","Limit":20},{"Host":"ec2","OS":"windows","Labels":["gpu"],"Limit":2}]`,
+			expected: []publisher.HostOption{
+				{Host: "ec2", OS: "ubuntu", Limit: 20},
+				{Host: "ec2", OS: "windows", Labels: []string{"gpu"}, Limit: 2},
+			},
+		},
+		"invalid json": {
+			value: `{"Host":"ec2"}`,
+			err: errors.New(
+				"invalid limits parameter limits: json: cannot unmarshal object into Go value of type []publisher.HostOption",
+			),
+		},
+		"missing host": {
+			value: `[{"OS":"ubuntu","Limit":20}]`,
+			err:   errors.New("invalid limit {Host: OS:ubuntu Labels:[] Limit:20}, host is required"),
+		},
+		"negative limit": {
+			value: `[{"Host":"ec2","Limit":-1}]`,
+			err:   errors.New("invalid limit {Host:ec2 OS: Labels:[] Limit:-1}, limit must not be negative"),
+		},
+		"failed to get parameter": {
+			getErr: errors.New("some error"),
+			err:    errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedSSMClient{value: tc.value, err: tc.getErr}
+
+			opts, err := NewSSMSource(client, "limits").HostOptions(context.TODO())
+
+			a.Equal("limits", aws.ToString(client.input.Name))
+			a.Equal(tc.expected, opts)
+			a.Equal(tc.err, err)
+		})
+	}
+}
+
+func TestDynamoDBSource_HostOptions(t *testing.T) {
+	cases := map[string]struct {
+		item     map[string]types.AttributeValue
+		getErr   error
+		expected []publisher.HostOption
+		err      error
+	}{
+		"limits per host and os": {
+			item: map[string]types.AttributeValue{
+				"Name": &types.AttributeValueMemberS{Value: "limits"},
+				"Limits": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+						"Host":  &types.AttributeValueMemberS{Value: "ec2"},
+						"OS":    &types.AttributeValueMemberS{Value: "windows"},
+						"Limit": &types.AttributeValueMemberN{Value: "2"},
+					}},
+				}},
+			},
+			expected: []publisher.HostOption{{Host: "ec2", OS: "windows", Limit: 2}},
+		},
+		"item not found": {},
+		"missing host": {
+			item: map[string]types.AttributeValue{
+				"Limits": &types.AttributeValueMemberL{Value: []types.AttributeValue{
+					&types.AttributeValueMemberM{Value: map[string]types.AttributeValue{
+						"Limit": &types.AttributeValueMemberN{Value: "2"},
+					}},
+				}},
+			},
+			err: errors.New("invalid limit {Host: OS: Labels:[] Limit:2}, host is required"),
+		},
+		"failed to get item": {
+			getErr: errors.New("some error"),
+			err:    errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedDynamoDBClient{item: tc.item, err: tc.getErr}
+
+			opts, err := NewDynamoDBSource(client, "table", "limits").HostOptions(context.TODO())
+
+			a.Equal(&dynamodb.GetItemInput{
+				TableName: aws.String("table"),
+				Key: map[string]types.AttributeValue{
+					"Name": &types.AttributeValueMemberS{Value: "limits"},
+				},
+				ConsistentRead: aws.Bool(true),
+			}, client.input)
+			a.Equal(tc.expected, opts)
+			a.Equal(tc.err, err)
+		})
+	}
+}
+
+func TestCachedSource_HostOptions(t *testing.T) {
+	a := assert.New(t)
+	now := time.Unix(1640995200, 0)
+	source := &mockedSource{opts: []publisher.HostOption{{Host: "ec2", Limit: 1}}}
+	s := &cachedSource{source: source, ttl: time.Minute, now: func() time.Time { return now }}
+
+	opts, err := s.HostOptions(context.TODO())
+	a.Nil(err)
+	a.Equal([]publisher.HostOption{{Host: "ec2", Limit: 1}}, opts)
+
+	source.opts = []publisher.HostOption{{Host: "ec2", Limit: 2}}
+	now = now.Add(30 * time.Second)
+	opts, err = s.HostOptions(context.TODO())
+	a.Nil(err)
+	a.Equal([]publisher.HostOption{{Host: "ec2", Limit: 1}}, opts)
+	a.Equal(1, source.calls)
+
+	now = now.Add(30 * time.Second)
+	source.err = errors.New("some error")
+	opts, err = s.HostOptions(context.TODO())
+	a.Nil(opts)
+	a.Equal(errors.New("some error"), err)
+
+	source.err = nil
+	opts, err = s.HostOptions(context.TODO())
+	a.Nil(err)
+	a.Equal([]publisher.HostOption{{Host: "ec2", Limit: 2}}, opts)
+	a.Equal(3, source.calls)
+}
+
+func TestFallbackSource_HostOptions(t *testing.T) {
+	defaults := []publisher.HostOption{{Host: "ec2", Limit: 1}}
+	cases := map[string]struct {
+		opts         []publisher.HostOption
+		err          error
+		expected     []publisher.HostOption
+		expectedLogs []string
+	}{
+		"limits of source": {
+			opts:         []publisher.HostOption{{Host: "ec2", Limit: 2}},
+			expected:     []publisher.HostOption{{Host: "ec2", Limit: 2}},
+			expectedLogs: []string{},
+		},
+		"failed to get limits": {
+			err:          errors.New("some error"),
+			expected:     defaults,
+			expectedLogs: []string{"failed to get concurrency limits, using defaults"},
+		},
+		"no limits": {
+			expected:     defaults,
+			expectedLogs: []string{"no concurrency limits configured, using defaults"},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			core, logs := observer.New(zap.InfoLevel)
+			s := NewFallbackSource(&mockedSource{opts: tc.opts, err: tc.err}, defaults, zap.New(core))
+
+			opts, err := s.HostOptions(context.TODO())
+
+			a.Nil(err)
+			a.Equal(tc.expected, opts)
+
+			messages := make([]string, 0)
+			for _, l := range logs.All() {
+				messages = append(messages, l.Message)
+			}
+
+			a.Equal(tc.expectedLogs, messages)
+		})
+	}
+}
+
+type mockedSSMClient struct {
+	input *ssm.GetParameterInput
+	value string
+	err   error
+}
+
+func (m *mockedSSMClient) GetParameter(
+	_ context.Context,
+	params *ssm.GetParameterInput,
+	_ ...func(*ssm.Options),
+) (*ssm.GetParameterOutput, error) {
+	m.input = params
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &ssm.GetParameterOutput{
+		Parameter: &ssmtypes.Parameter{Name: params.Name, Value: aws.String(m.value)},
+	}, nil
+}
+
+type mockedDynamoDBClient struct {
+	input *dynamodb.GetItemInput
+	item  map[string]types.AttributeValue
+	err   error
+}
+
+func (m *mockedDynamoDBClient) GetItem(
+	_ context.Context,
+	params *dynamodb.GetItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.GetItemOutput, error) {
+	m.input = params
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return &dynamodb.GetItemOutput{Item: m.item}, nil
+}
+
+type mockedSource struct {
+	opts  []publisher.HostOption
+	err   error
+	calls int
+}
+
+func (m *mockedSource) HostOptions(context.Context) ([]publisher.HostOption, error) {
+	m.calls++
+	if m.err != nil {
+		return nil, m.err
+	}
+
+	return m.opts, nil
+}
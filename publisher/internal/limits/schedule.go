@@ -0,0 +1,115 @@
+package limits
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+)
+
+// Override replaces the limit of the host, or of the host and OS when OS is set, while the cron
+// expression matches the time in the timezone, e.g. "* 9-17 * * 1-5" for business hours.
+type Override struct {
+	Host string
+	OS   string
+	// Cron is a five fields cron expression, minute hour day-of-month month day-of-week.
+	Cron string
+	// Timezone is an IANA timezone, UTC if empty.
+	Timezone string
+	Limit    int32
+}
+
+type schedule struct {
+	override *Override
+	cron     *cron
+	location *time.Location
+}
+
+type scheduledSource struct {
+	source    publisher.LimitSource
+	schedules []schedule
+	now       func() time.Time
+}
+
+func (s *scheduledSource) HostOptions(ctx context.Context) ([]publisher.HostOption, error) {
+	opts, err := s.source.HostOptions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	now := s.now()
+	res := make([]publisher.HostOption, len(opts))
+	for i, o := range opts {
+		res[i] = o
+		for _, sc := range s.schedules {
+			if sc.match(&o, now) {
+				res[i].Limit = sc.override.Limit
+				break
+			}
+		}
+	}
+
+	return res, nil
+}
+
+func (s *schedule) match(o *publisher.HostOption, t time.Time) bool {
+	if s.override.Host != o.Host || (s.override.OS != "" && s.override.OS != o.OS) {
+		return false
+	}
+
+	return s.cron.match(t.In(s.location))
+}
+
+// NewScheduledSource applies the first matching override to the limits of the source on each call.
+func NewScheduledSource(source publisher.LimitSource, overrides []Override) (publisher.LimitSource, error) {
+	s, err := newScheduledSource(source, overrides, time.Now)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func newScheduledSource(
+	source publisher.LimitSource,
+	overrides []Override,
+	now func() time.Time,
+) (*scheduledSource, error) {
+	schedules := make([]schedule, 0)
+	for i := range overrides {
+		o := &overrides[i]
+		if o.Host == "" || o.Limit < 0 {
+			return nil, fmt.Errorf("invalid override %+v, host is required and limit must not be negative", *o)
+		}
+
+		c, err := parseCron(o.Cron)
+		if err != nil {
+			return nil, err
+		}
+
+		loc, err := time.LoadLocation(o.Timezone)
+		if err != nil {
+			return nil, err
+		}
+
+		schedules = append(schedules, schedule{override: o, cron: c, location: loc})
+	}
+
+	return &scheduledSource{
+		source:    source,
+		schedules: schedules,
+		now:       now,
+	}, nil
+}
+
+type staticSource []publisher.HostOption
+
+func (s staticSource) HostOptions(context.Context) ([]publisher.HostOption, error) {
+	return s, nil
+}
+
+// NewStaticSource returns the same limits on each call.
+func NewStaticSource(opts []publisher.HostOption) publisher.LimitSource {
+	return staticSource(opts)
+}
@@ -0,0 +1,123 @@
+package limits
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+)
+
+func TestScheduledSource_HostOptions(t *testing.T) {
+	opts := []publisher.HostOption{
+		{Host: "ec2", OS: "ubuntu", Limit: 10},
+		{Host: "ec2", OS: "windows", Limit: 2},
+		{Host: "eks", Limit: 20},
+	}
+	overrides := []Override{
+		{Host: "ec2", OS: "ubuntu", Cron: "* 9-17 * * 1-5", Timezone: "Australia/Melbourne", Limit: 30},
+		{Host: "ec2", Cron: "* 0-5 * * *", Timezone: "Australia/Melbourne", Limit: 1},
+		{Host: "eks", Cron: "* * * * 0,6", Limit: 5},
+	}
+
+	cases := map[string]struct {
+		now       time.Time
+		sourceErr error
+		expected  []publisher.HostOption
+		err       error
+	}{
+		"business hours in timezone": {
+			// Monday 10:00 in Melbourne, Sunday in UTC.
+			now: time.Date(2022, 1, 2, 23, 0, 0, 0, time.UTC),
+			expected: []publisher.HostOption{
+				{Host: "ec2", OS: "ubuntu", Limit: 30},
+				{Host: "ec2", OS: "windows", Limit: 2},
+				{Host: "eks", Limit: 5},
+			},
+		},
+		"night in timezone": {
+			// Monday 02:00 in Melbourne, Sunday in UTC.
+			now: time.Date(2022, 1, 2, 15, 0, 0, 0, time.UTC),
+			expected: []publisher.HostOption{
+				{Host: "ec2", OS: "ubuntu", Limit: 1},
+				{Host: "ec2", OS: "windows", Limit: 1},
+				{Host: "eks", Limit: 5},
+			},
+		},
+		"no override": {
+			// Monday 20:00 in Melbourne.
+			now:      time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC),
+			expected: opts,
+		},
+		"failed to get limits": {
+			now:       time.Date(2022, 1, 3, 9, 0, 0, 0, time.UTC),
+			sourceErr: errors.New("some error"),
+			err:       errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			source := &mockedSource{opts: opts, err: tc.sourceErr}
+			s, sErr := newScheduledSource(source, overrides, func() time.Time { return tc.now })
+			a.Nil(sErr)
+
+			res, err := s.HostOptions(context.TODO())
+
+			a.Equal(tc.expected, res)
+			a.Equal(tc.err, err)
+			a.Equal(10, int(opts[0].Limit))
+		})
+	}
+}
+
+func TestScheduledSource_HostOptionsWithFallback(t *testing.T) {
+	a := assert.New(t)
+	defaults := []publisher.HostOption{{Host: "ec2", Limit: 10}}
+	source := NewFallbackSource(&mockedSource{err: errors.New("some error")}, defaults, zap.NewNop())
+	s, sErr := newScheduledSource(
+		source,
+		[]Override{{Host: "ec2", Cron: "* 0-5 * * *", Limit: 1}},
+		func() time.Time { return time.Date(2022, 1, 3, 2, 0, 0, 0, time.UTC) },
+	)
+	a.Nil(sErr)
+
+	res, err := s.HostOptions(context.TODO())
+
+	a.Nil(err)
+	a.Equal([]publisher.HostOption{{Host: "ec2", Limit: 1}}, res)
+}
+
+func TestNewScheduledSource_Error(t *testing.T) {
+	cases := map[string]struct {
+		override Override
+		err      error
+	}{
+		"missing host": {
+			override: Override{Cron: "* * * * *", Limit: 1},
+			err:      errors.New("invalid override {Host: OS: Cron:* * * * * Timezone: Limit:1}, host is required and limit must not be negative"),
+		},
+		"invalid cron": {
+			override: Override{Host: "ec2", Cron: "* *", Limit: 1},
+			err:      errors.New(`invalid cron "* *", expected 5 fields`),
+		},
+		"invalid timezone": {
+			override: Override{Host: "ec2", Cron: "* * * * *", Timezone: "Mars/Olympus", Limit: 1},
+			err:      errors.New("unknown time zone Mars/Olympus"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s, err := NewScheduledSource(NewStaticSource(nil), []Override{tc.override})
+
+			a.Nil(s)
+			a.Equal(tc.err, err)
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package messenger
+
+import (
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sns/types"
+)
+
+// messageAttributeCarrier propagates the trace context as SNS message attributes, which are
+// kept in the SNS envelope delivered to the orchestrator queues.
+type messageAttributeCarrier map[string]types.MessageAttributeValue
+
+func (c messageAttributeCarrier) Get(key string) string {
+	v, ok := c[key]
+	if !ok || v.StringValue == nil {
+		return ""
+	}
+
+	return *v.StringValue
+}
+
+func (c messageAttributeCarrier) Set(key, value string) {
+	c[key] = types.MessageAttributeValue{
+		DataType:    aws.String("String"),
+		StringValue: aws.String(value),
+	}
+}
+
+func (c messageAttributeCarrier) Keys() []string {
+	keys := make([]string, 0, len(c))
+	for k := range c {
+		keys = append(keys, k)
+	}
+
+	return keys
+}
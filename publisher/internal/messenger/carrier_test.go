@@ -0,0 +1,20 @@
+package messenger
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMessageAttributeCarrier(t *testing.T) {
+	a := assert.New(t)
+	c := messageAttributeCarrier{}
+
+	a.Equal("", c.Get("traceparent"))
+
+	c.Set("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	a.Equal("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", c.Get("traceparent"))
+	a.Equal("String", *c["traceparent"].DataType)
+	a.Equal([]string{"traceparent"}, c.Keys())
+}
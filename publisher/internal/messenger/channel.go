@@ -0,0 +1,43 @@
+package messenger
+
+import (
+	"context"
+)
+
+type channelMessenger struct {
+	jobs          chan<- Envelope
+	notifications chan<- struct{}
+}
+
+// PublishJobs blocks until the consumer receives every message or the context is done, the messages
+// the consumer didn't receive are reported in a PublishError.
+func (n *channelMessenger) PublishJobs(ctx context.Context, messages []Message) error {
+	for i := range messages {
+		select {
+		case n.jobs <- toEnvelope(ctx, &messages[i]):
+		case <-ctx.Done():
+			return &PublishError{Failed: messages[i:], Err: ctx.Err()}
+		}
+	}
+
+	return nil
+}
+
+// NotifyPublisher doesn't block, a notification is dropped while a previous one is pending, as the
+// pending notification already triggers the next publish.
+func (n *channelMessenger) NotifyPublisher(context.Context) error {
+	select {
+	case n.notifications <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// NewChannel delivers the messages to a consumer in the same process, e.g. for local setups.
+func NewChannel(jobs chan<- Envelope, notifications chan<- struct{}) Messenger {
+	return &channelMessenger{
+		jobs:          jobs,
+		notifications: notifications,
+	}
+}
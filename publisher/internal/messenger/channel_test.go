@@ -0,0 +1,79 @@
+package messenger
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestChannelMessenger_PublishJobs(t *testing.T) {
+	cases := map[string]struct {
+		messages []Message
+		// received is the number of messages the consumer receives before it cancels the context.
+		received int
+		cancel   bool
+		err      error
+	}{
+		"publish jobs": {
+			messages: getTestMessages(2),
+			received: 2,
+		},
+		"context done": {
+			messages: getTestMessages(2),
+			cancel:   true,
+			err:      &PublishError{Failed: getTestMessages(2), Err: context.Canceled},
+		},
+		"context done mid-batch": {
+			messages: getTestMessages(3),
+			received: 1,
+			cancel:   true,
+			err:      &PublishError{Failed: getTestMessages(3)[1:], Err: context.Canceled},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			jobs := make(chan Envelope)
+			ctx, cancel := context.WithCancel(context.TODO())
+			defer cancel()
+			if tc.cancel && tc.received == 0 {
+				cancel()
+			}
+
+			received := make(chan []Envelope)
+			go func() {
+				envelopes := make([]Envelope, 0)
+				for i := 0; i < tc.received; i++ {
+					envelopes = append(envelopes, <-jobs)
+				}
+
+				if tc.cancel {
+					cancel()
+				}
+				received <- envelopes
+			}()
+
+			a.Equal(tc.err, NewChannel(jobs, nil).PublishJobs(ctx, tc.messages))
+
+			envelopes := <-received
+			a.Len(envelopes, tc.received)
+			for _, e := range envelopes {
+				a.Equal("msg", e.Message)
+				a.Equal(EnvelopeAttribute{Type: "String", Value: "ec2"}, e.MessageAttributes[hostAttribute])
+				a.Equal(EnvelopeAttribute{Type: "String", Value: "completed"}, e.MessageAttributes[statusAttribute])
+			}
+		})
+	}
+}
+
+func TestChannelMessenger_NotifyPublisher(t *testing.T) {
+	a := assert.New(t)
+	notifications := make(chan struct{}, 1)
+	m := NewChannel(nil, notifications)
+
+	a.Nil(m.NotifyPublisher(context.TODO()))
+	a.Nil(m.NotifyPublisher(context.TODO()))
+	a.Len(notifications, 1)
+}
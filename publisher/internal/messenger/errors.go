@@ -0,0 +1,43 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+)
+
+// PublishError reports the messages PublishJobs failed to deliver after their retries, the other
+// messages were delivered.
+type PublishError struct {
+	Failed []Message
+	// Err is the first error of a whole batch, nil if only some entries failed.
+	Err error
+}
+
+func (e *PublishError) Error() string {
+	msg := fmt.Sprintf(`failed to publish %v messages`, len(e.Failed))
+	if e.Err != nil {
+		msg += fmt.Sprintf(`: %v`, e.Err.Error())
+	}
+
+	return msg
+}
+
+func (e *PublishError) Unwrap() error {
+	return e.Err
+}
+
+// JobIDs returns the job IDs of the failed messages.
+func (e *PublishError) JobIDs() []uint64 {
+	ids := make([]uint64, 0)
+	for _, m := range e.Failed {
+		ids = append(ids, m.JobID)
+	}
+
+	return ids
+}
+
+func AsPublishError(err error) (*PublishError, bool) {
+	var e *PublishError
+	ok := errors.As(err, &e)
+	return e, ok
+}
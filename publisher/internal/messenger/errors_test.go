@@ -0,0 +1,46 @@
+package messenger
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPublishError(t *testing.T) {
+	cases := map[string]struct {
+		err         *PublishError
+		expectedMsg string
+	}{
+		"failed entries": {
+			err:         &PublishError{Failed: getTestMessages(2)},
+			expectedMsg: "failed to publish 2 messages",
+		},
+		"failed batch": {
+			err:         &PublishError{Failed: getTestMessages(2), Err: errors.New("some error")},
+			expectedMsg: "failed to publish 2 messages: some error",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			e, ok := AsPublishError(fmt.Errorf("wrapped: %w", tc.err))
+
+			a.True(ok)
+			a.Equal(tc.err, e)
+			a.Equal(tc.expectedMsg, e.Error())
+			a.Equal([]uint64{0, 1}, e.JobIDs())
+			a.Equal(tc.err.Err, errors.Unwrap(e))
+		})
+	}
+}
+
+func TestAsPublishError(t *testing.T) {
+	a := assert.New(t)
+	e, ok := AsPublishError(errors.New("some error"))
+
+	a.False(ok)
+	a.Nil(e)
+}
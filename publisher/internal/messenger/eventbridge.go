@@ -0,0 +1,148 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	eventBridgeBatchSize = 10
+	jobDetailType        = "Job"
+	publisherDetailType  = "PublisherNotification"
+)
+
+// retryableEventErrors are the error codes of the failed entries which may succeed when retried.
+var retryableEventErrors = []string{"InternalFailure", "ThrottlingException"}
+
+type PutEventsAPIClient interface {
+	PutEvents(
+		ctx context.Context,
+		params *eventbridge.PutEventsInput,
+		optFns ...func(*eventbridge.Options),
+	) (*eventbridge.PutEventsOutput, error)
+}
+
+// eventDetail has the Host, OS and Status as detail fields for the rule patterns, a rule with the
+// $.detail input path delivers the envelope to the orchestrator queues.
+type eventDetail struct {
+	Host   string
+	OS     string
+	Status string
+	Envelope
+}
+
+type eventBridgeMessenger struct {
+	options
+	client   PutEventsAPIClient
+	eventBus string
+}
+
+func (n *eventBridgeMessenger) PublishJobs(ctx context.Context, messages []Message) (err error) {
+	ctx, span := tracer.Start(ctx, "messenger.PublishJobs", trace.WithAttributes(
+		attribute.Int("messages", len(messages)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	batches := partition(messages, eventBridgeBatchSize)
+	return publishBatches(ctx, n.metrics, batches, func(ctx context.Context, _ int, messages []Message) ([]entryError, error) {
+		bCtx, bSpan := tracer.Start(ctx, "eventbridge.PutEvents", trace.WithAttributes(
+			attribute.Int("entries", len(messages)),
+		))
+		out, err := n.client.PutEvents(bCtx, &eventbridge.PutEventsInput{
+			Entries: n.toPutEventsRequestEntry(ctx, messages),
+		})
+		tracing.End(bSpan, err)
+
+		if err != nil {
+			return nil, err
+		}
+
+		// the result entries are in the order of the request entries.
+		errs := make([]entryError, 0)
+		for i, e := range out.Entries {
+			if e.ErrorCode != nil {
+				errs = append(errs, entryError{id: strconv.Itoa(i), retryable: inSlice(*e.ErrorCode, retryableEventErrors)})
+			}
+		}
+
+		return errs, nil
+	})
+}
+
+func (n *eventBridgeMessenger) NotifyPublisher(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "eventbridge.PutEvents")
+	defer func() { tracing.End(span, err) }()
+
+	return n.putEvents(ctx, []types.PutEventsRequestEntry{
+		n.toEntry(publisherDetailType, Envelope{Message: getMessage(messageSource)}),
+	})
+}
+
+func (n *eventBridgeMessenger) putEvents(ctx context.Context, entries []types.PutEventsRequestEntry) error {
+	out, err := n.client.PutEvents(ctx, &eventbridge.PutEventsInput{Entries: entries})
+	if err != nil {
+		return err
+	}
+
+	if out.FailedEntryCount != 0 {
+		return fmt.Errorf("failed to put %v of %v events to %v", out.FailedEntryCount, len(entries), n.eventBus)
+	}
+
+	return nil
+}
+
+func inSlice(key string, s []string) bool {
+	for _, i := range s {
+		if key == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (n *eventBridgeMessenger) toPutEventsRequestEntry(
+	ctx context.Context,
+	messages []Message,
+) []types.PutEventsRequestEntry {
+	entries := make([]types.PutEventsRequestEntry, 0)
+	for i := range messages {
+		m := &messages[i]
+		entries = append(entries, n.toEntry(jobDetailType, eventDetail{
+			Host:     m.Host,
+			OS:       m.OS,
+			Status:   m.Status,
+			Envelope: toEnvelope(ctx, m),
+		}))
+	}
+
+	return entries
+}
+
+func (n *eventBridgeMessenger) toEntry(detailType string, detail interface{}) types.PutEventsRequestEntry {
+	b, _ := json.Marshal(detail)
+	return types.PutEventsRequestEntry{
+		Detail:       aws.String(string(b)),
+		DetailType:   aws.String(detailType),
+		EventBusName: aws.String(n.eventBus),
+		Source:       aws.String(messageSource),
+	}
+}
+
+// NewEventBridge puts the messages as events on the event bus, rules route them by the detail fields.
+func NewEventBridge(client PutEventsAPIClient, eventBus string, opts ...Option) Messenger {
+	return &eventBridgeMessenger{
+		options:  getOptions(opts),
+		client:   client,
+		eventBus: eventBus,
+	}
+}
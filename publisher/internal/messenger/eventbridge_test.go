@@ -0,0 +1,157 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge"
+	"github.com/aws/aws-sdk-go-v2/service/eventbridge/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEventBridgeMessenger_PublishJobs(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = 0
+
+	eventBus := "jobs"
+	entry := types.PutEventsRequestEntry{
+		Detail: aws.String(`{"Host":"ec2","OS":"ubuntu","Status":"completed","Message":"msg","MessageAttributes":{` +
+			`"Host":{"Type":"String","Value":"ec2"},` +
+			`"OS":{"Type":"String","Value":"ubuntu"},` +
+			`"Status":{"Type":"String","Value":"completed"}}}`),
+		DetailType:   aws.String("Job"),
+		EventBusName: aws.String(eventBus),
+		Source:       aws.String("Publisher"),
+	}
+
+	cases := map[string]struct {
+		messages []Message
+		results  [][]types.PutEventsResultEntry
+		putErr   error
+		expected []int
+		failed   []Message
+		err      error
+	}{
+		"put jobs": {
+			messages: getTestMessages(12),
+			expected: []int{10, 2},
+		},
+		"retry failed entries": {
+			messages: getTestMessages(2),
+			results: [][]types.PutEventsResultEntry{
+				{{EventId: aws.String("0")}, {ErrorCode: aws.String("ThrottlingException")}},
+			},
+			expected: []int{2, 1},
+		},
+		"invalid entries": {
+			messages: getTestMessages(2),
+			results: [][]types.PutEventsResultEntry{
+				{{ErrorCode: aws.String("MalformedDetail")}, {EventId: aws.String("1")}},
+			},
+			expected: []int{2},
+			failed:   getTestMessages(1),
+		},
+		"failed to put jobs": {
+			messages: getTestMessages(2),
+			putErr:   errors.New("failed to put jobs"),
+			expected: []int{2},
+			failed:   getTestMessages(2),
+			err:      errors.New("failed to put jobs"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedPutEventsAPIClient{results: tc.results, putErr: tc.putErr}
+
+			err := NewEventBridge(client, eventBus).PublishJobs(context.TODO(), tc.messages)
+			if tc.failed == nil {
+				a.Nil(err)
+			} else {
+				a.Equal(&PublishError{Failed: tc.failed, Err: tc.err}, err)
+			}
+
+			sizes := make([]int, 0)
+			for _, in := range client.inputs {
+				sizes = append(sizes, len(in.Entries))
+				for _, e := range in.Entries {
+					a.Equal(entry, e)
+				}
+			}
+			a.ElementsMatch(tc.expected, sizes)
+		})
+	}
+}
+
+func TestEventBridgeMessenger_NotifyPublisher(t *testing.T) {
+	cases := map[string]struct {
+		putErr error
+		err    error
+	}{
+		"notify publisher": {},
+		"failed to notify publisher": {
+			putErr: errors.New("failed to notify publisher"),
+			err:    errors.New("failed to notify publisher"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedPutEventsAPIClient{putErr: tc.putErr}
+
+			a.Equal(tc.err, NewEventBridge(client, "jobs").NotifyPublisher(context.TODO()))
+			a.Equal([]eventbridge.PutEventsInput{
+				{
+					Entries: []types.PutEventsRequestEntry{
+						{
+							Detail:       aws.String(`{"Message":"{\"Source\":\"Publisher\"}"}`),
+							DetailType:   aws.String("PublisherNotification"),
+							EventBusName: aws.String("jobs"),
+							Source:       aws.String("Publisher"),
+						},
+					},
+				},
+			}, client.inputs)
+		})
+	}
+}
+
+type mockedPutEventsAPIClient struct {
+	sync.Mutex
+	inputs  []eventbridge.PutEventsInput
+	results [][]types.PutEventsResultEntry
+	putErr  error
+}
+
+func (m *mockedPutEventsAPIClient) PutEvents(
+	_ context.Context,
+	params *eventbridge.PutEventsInput,
+	_ ...func(*eventbridge.Options),
+) (*eventbridge.PutEventsOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.inputs = append(m.inputs, *params)
+	if m.putErr != nil {
+		return nil, m.putErr
+	}
+
+	out := new(eventbridge.PutEventsOutput)
+	if len(m.results) != 0 {
+		out.Entries, m.results = m.results[0], m.results[1:]
+	}
+
+	for _, e := range out.Entries {
+		if e.ErrorCode != nil {
+			out.FailedEntryCount++
+		}
+	}
+
+	return out, nil
+}
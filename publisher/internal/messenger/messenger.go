@@ -5,29 +5,61 @@ import (
 	"encoding/json"
 	"math"
 	"strconv"
+	"sync"
+	"time"
 
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
-	"golang.org/x/sync/errgroup"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger")
+
 const (
 	hostAttribute   = "Host"
 	osAttribute     = "OS"
 	statusAttribute = "Status"
+	hostDimension   = "Host"
 	messageSource   = "Publisher"
 	snsBatchSize    = 10
+
+	stringAttributeType = "String"
+	// maxSendAttempts bounds the attempts of a retryable failed entry.
+	maxSendAttempts = 3
 )
 
+// retryBackoff is the delay before the first retry of failed entries, it grows linearly.
+var retryBackoff = 100 * time.Millisecond
+
 type Message struct {
+	// JobID maps a failed message back to its job, it's not sent.
+	JobID  uint64
 	Host   string
 	OS     string
 	Status string
 	Body   string
 }
 
+// Envelope mirrors the SNS notification delivered to the orchestrator queues, the other
+// transports deliver their messages in the same format, so the orchestrator reads them alike.
+type Envelope struct {
+	Message           string
+	MessageAttributes map[string]EnvelopeAttribute `json:",omitempty"`
+}
+
+type EnvelopeAttribute struct {
+	Type  string
+	Value string
+}
+
 type Messenger interface {
+	// PublishJobs returns a *PublishError listing the messages which were not delivered.
 	PublishJobs(ctx context.Context, messages []Message) error
 	NotifyPublisher(ctx context.Context) error
 }
@@ -37,38 +69,71 @@ type PublishAPIClient interface {
 	PublishBatch(ctx context.Context, params *sns.PublishBatchInput, optFns ...func(*sns.Options)) (*sns.PublishBatchOutput, error)
 }
 
+// Option configures the messengers publishing in batches.
+type Option func(o *options)
+
+type options struct {
+	metrics metrics.Recorder
+}
+
+// WithMetrics records the size and the failed entries of every published batch per host.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(o *options) {
+		o.metrics = r
+	}
+}
+
+func getOptions(opts []Option) options {
+	o := options{metrics: metrics.NewNop()}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return o
+}
+
 type messenger struct {
+	options
 	client         PublishAPIClient
 	jobsTopic      string
 	publisherTopic string
 }
 
-func (n *messenger) PublishJobs(ctx context.Context, messages []Message) error {
-	entriesList := partitionJobs(messages, snsBatchSize)
-	g, ctx := errgroup.WithContext(ctx)
-
-	for i := range entriesList {
-		entries := entriesList[i]
-		g.Go(func() error {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-				_, err := n.client.PublishBatch(ctx, &sns.PublishBatchInput{
-					PublishBatchRequestEntries: entries,
-					TopicArn:                   aws.String(n.jobsTopic),
-				})
+func (n *messenger) PublishJobs(ctx context.Context, messages []Message) (err error) {
+	ctx, span := tracer.Start(ctx, "messenger.PublishJobs", trace.WithAttributes(
+		attribute.Int("messages", len(messages)),
+	))
+	defer func() { tracing.End(span, err) }()
 
-				return err
-			}
+	batches := partition(messages, snsBatchSize)
+	return publishBatches(ctx, n.metrics, batches, func(ctx context.Context, _ int, messages []Message) ([]entryError, error) {
+		bCtx, bSpan := tracer.Start(ctx, "sns.PublishBatch", trace.WithAttributes(
+			attribute.Int("entries", len(messages)),
+		))
+		out, err := n.client.PublishBatch(bCtx, &sns.PublishBatchInput{
+			PublishBatchRequestEntries: toPublishBatchRequestEntry(ctx, messages),
+			TopicArn:                   aws.String(n.jobsTopic),
 		})
-	}
+		tracing.End(bSpan, err)
 
-	return g.Wait()
+		if err != nil {
+			return nil, err
+		}
+
+		errs := make([]entryError, 0)
+		for _, f := range out.Failed {
+			errs = append(errs, entryError{id: aws.ToString(f.Id), retryable: !f.SenderFault})
+		}
+
+		return errs, nil
+	})
 }
 
-func (n *messenger) NotifyPublisher(ctx context.Context) error {
-	_, err := n.client.Publish(ctx, &sns.PublishInput{
+func (n *messenger) NotifyPublisher(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "sns.Publish")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = n.client.Publish(ctx, &sns.PublishInput{
 		TopicArn: aws.String(n.publisherTopic),
 		Message:  aws.String(getMessage(messageSource)),
 	})
@@ -76,38 +141,156 @@ func (n *messenger) NotifyPublisher(ctx context.Context) error {
 	return err
 }
 
-func partitionJobs(messages []Message, batchSize int) [][]types.PublishBatchRequestEntry {
-	jobsNum := len(messages)
-	entries := make([][]types.PublishBatchRequestEntry, 0)
+// partition splits the messages into batches of at most size messages.
+func partition(messages []Message, size int) [][]Message {
+	batches := make([][]Message, 0)
+	for i := 0; i < len(messages); i += size {
+		batches = append(batches, messages[i:int(math.Min(float64(i+size), float64(len(messages))))])
+	}
+
+	return batches
+}
+
+// entryError is a failed entry of a batch, its id is the index of the message in the batch.
+type entryError struct {
+	id        string
+	retryable bool
+}
+
+// sendFunc sends the messages of the batch i, and returns the failed entries.
+type sendFunc func(ctx context.Context, i int, messages []Message) ([]entryError, error)
+
+// publishBatches publishes the batches concurrently, a failed batch doesn't stop the others, so the
+// caller knows which messages were delivered.
+func publishBatches(ctx context.Context, recorder metrics.Recorder, batches [][]Message, send sendFunc) error {
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failed   = make([]Message, 0)
+		firstErr error
+	)
+
+	for i := range batches {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			f, err := sendWithRetries(ctx, i, batches[i], send)
+			recordBatch(recorder, batches[i], f)
 
-	for i := 0; i < jobsNum; i += batchSize {
-		minNum := int(math.Min(float64(i+batchSize), float64(jobsNum)))
-		entries = append(entries, toPublishBatchRequestEntry(messages[i:minNum]))
+			mu.Lock()
+			defer mu.Unlock()
+			failed = append(failed, f...)
+			if firstErr == nil {
+				firstErr = err
+			}
+		}(i)
 	}
 
-	return entries
+	wg.Wait()
+	if len(failed) == 0 {
+		return nil
+	}
+
+	return &PublishError{Failed: failed, Err: firstErr}
+}
+
+// recordBatch records the batch size per host, the messages of a PublishJobs call share the host.
+func recordBatch(recorder metrics.Recorder, batch []Message, failed []Message) {
+	if len(batch) == 0 {
+		return
+	}
+
+	recorder.Put(
+		metrics.Dimensions{hostDimension: batch[0].Host},
+		metrics.Metric{Name: "PublishBatchSize", Value: float64(len(batch)), Unit: metrics.Count},
+		metrics.Metric{Name: "PublishBatchFailures", Value: float64(len(failed)), Unit: metrics.Count},
+	)
 }
 
-func toPublishBatchRequestEntry(messages []Message) []types.PublishBatchRequestEntry {
+// sendWithRetries sends the batch again with its retryable failed entries, and returns the
+// messages which were not delivered. A failed batch isn't retried, the client already retries it.
+func sendWithRetries(ctx context.Context, i int, messages []Message, send sendFunc) ([]Message, error) {
+	failed := make([]Message, 0)
+	for attempt := 1; len(messages) != 0; attempt++ {
+		errs, err := send(ctx, i, messages)
+		if err != nil {
+			return append(failed, messages...), err
+		}
+
+		retry := make([]Message, 0)
+		for _, e := range errs {
+			idx, err := strconv.Atoi(e.id)
+			if err != nil || idx < 0 || idx >= len(messages) {
+				continue
+			}
+
+			if e.retryable && attempt < maxSendAttempts {
+				retry = append(retry, messages[idx])
+				continue
+			}
+
+			failed = append(failed, messages[idx])
+		}
+
+		if len(retry) == 0 {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return append(failed, retry...), ctx.Err()
+		case <-time.After(time.Duration(attempt) * retryBackoff):
+		}
+
+		messages = retry
+	}
+
+	return failed, nil
+}
+
+// toEnvelope sets the Host, OS and Status attributes of the message and injects the trace context,
+// the same attributes the SNS transport sets.
+func toEnvelope(ctx context.Context, m *Message) Envelope {
+	carrier := propagation.MapCarrier{
+		hostAttribute:   m.Host,
+		osAttribute:     m.OS,
+		statusAttribute: m.Status,
+	}
+	otel.GetTextMapPropagator().Inject(ctx, carrier)
+
+	attributes := make(map[string]EnvelopeAttribute, len(carrier))
+	for k, v := range carrier {
+		attributes[k] = EnvelopeAttribute{Type: stringAttributeType, Value: v}
+	}
+
+	return Envelope{Message: m.Body, MessageAttributes: attributes}
+}
+
+// toPublishBatchRequestEntry injects the trace context into the message attributes, so the
+// orchestrator spans join the publisher trace.
+func toPublishBatchRequestEntry(ctx context.Context, messages []Message) []types.PublishBatchRequestEntry {
 	entries := make([]types.PublishBatchRequestEntry, 0)
 	for i, m := range messages {
-		entries = append(entries, types.PublishBatchRequestEntry{
-			Id:      aws.String(strconv.Itoa(i)),
-			Message: aws.String(m.Body),
-			MessageAttributes: map[string]types.MessageAttributeValue{
-				hostAttribute: {
-					DataType:    aws.String("String"),
-					StringValue: aws.String(m.Host),
-				},
-				osAttribute: {
-					DataType:    aws.String("String"),
-					StringValue: aws.String(m.OS),
-				},
-				statusAttribute: {
-					DataType:    aws.String("String"),
-					StringValue: aws.String(m.Status),
-				},
+		attributes := messageAttributeCarrier{
+			hostAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(m.Host),
+			},
+			osAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(m.OS),
 			},
+			statusAttribute: {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(m.Status),
+			},
+		}
+		otel.GetTextMapPropagator().Inject(ctx, attributes)
+
+		entries = append(entries, types.PublishBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			Message:           aws.String(m.Body),
+			MessageAttributes: attributes,
 		})
 	}
 
@@ -128,8 +311,10 @@ func New(
 	client PublishAPIClient,
 	jobsTopic string,
 	publisherTopic string,
+	opts ...Option,
 ) Messenger {
 	return &messenger{
+		options:        getOptions(opts),
 		client:         client,
 		jobsTopic:      jobsTopic,
 		publisherTopic: publisherTopic,
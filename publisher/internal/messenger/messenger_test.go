@@ -3,42 +3,115 @@ package messenger
 import (
 	"context"
 	"errors"
-	"math"
 	"strconv"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/service/sns"
 	"github.com/aws/aws-sdk-go-v2/service/sns/types"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestMessenger_PublishJobs(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = 0
+
 	jobsTopic := "jobs"
+	messages := getTestMessages(12)
 	cases := map[string]struct {
 		messages       []Message
+		failed         [][]types.BatchResultErrorEntry
 		publishJobsErr error
 		expectedJobs   []sns.PublishBatchInput
-		err            error
+		expectedFailed []Message
+		expectedErr    error
 	}{
 		"publish jobs": {
-			messages: getTestMessages(12),
+			messages: messages,
 			expectedJobs: []sns.PublishBatchInput{
 				{
-					PublishBatchRequestEntries: toPublishBatchRequestEntry(getTestMessages(10)),
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:10]),
 					TopicArn:                   aws.String(jobsTopic),
 				},
 				{
-					PublishBatchRequestEntries: toPublishBatchRequestEntry(getTestMessages(2)),
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[10:]),
 					TopicArn:                   aws.String(jobsTopic),
 				},
 			},
 		},
+		"retry failed entries": {
+			messages: messages[:2],
+			failed: [][]types.BatchResultErrorEntry{
+				{{Id: aws.String("1"), Code: aws.String("InternalError")}},
+			},
+			expectedJobs: []sns.PublishBatchInput{
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:2]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[1:2]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+			},
+		},
+		"sender fault entries are not retried": {
+			messages: messages[:2],
+			failed: [][]types.BatchResultErrorEntry{
+				{{Id: aws.String("0"), Code: aws.String("InvalidParameter"), SenderFault: true}},
+			},
+			expectedJobs: []sns.PublishBatchInput{
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:2]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+			},
+			expectedFailed: messages[:1],
+		},
+		"failed entries after retries": {
+			messages: messages[:2],
+			failed: [][]types.BatchResultErrorEntry{
+				{{Id: aws.String("0")}},
+				{{Id: aws.String("0")}},
+				{{Id: aws.String("0")}},
+			},
+			expectedJobs: []sns.PublishBatchInput{
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:2]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:1]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:1]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+			},
+			expectedFailed: messages[:1],
+		},
 		"failed to publish jobs": {
-			messages:       getTestMessages(12),
+			messages:       messages,
 			publishJobsErr: errors.New("failed to publish jobs"),
-			err:            errors.New("failed to publish jobs"),
+			expectedJobs: []sns.PublishBatchInput{
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[:10]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+				{
+					PublishBatchRequestEntries: toPublishBatchRequestEntry(context.TODO(), messages[10:]),
+					TopicArn:                   aws.String(jobsTopic),
+				},
+			},
+			expectedFailed: messages,
+			expectedErr:    errors.New("failed to publish jobs"),
 		},
 	}
 
@@ -46,19 +119,66 @@ func TestMessenger_PublishJobs(t *testing.T) {
 		t.Run(n, func(t *testing.T) {
 			a := assert.New(t)
 			mockedClient := &mockedPublishAPIClient{
+				failed:         tc.failed,
 				publishJobsErr: tc.publishJobsErr,
 			}
 			m := New(mockedClient, jobsTopic, "")
 
-			a.Equal(tc.err, m.PublishJobs(context.TODO(), tc.messages))
+			err := m.PublishJobs(context.TODO(), tc.messages)
 
-			if tc.err == nil {
-				a.ElementsMatch(tc.expectedJobs, mockedClient.jobs)
+			a.ElementsMatch(tc.expectedJobs, mockedClient.jobs)
+			if tc.expectedFailed == nil {
+				a.Nil(err)
 				return
 			}
 
-			a.GreaterOrEqual(len(mockedClient.jobs), 1)
-			a.LessOrEqual(float64(len(mockedClient.jobs)), math.Ceil(float64(len(tc.messages))/snsBatchSize))
+			e, ok := AsPublishError(err)
+			a.True(ok)
+			a.ElementsMatch(tc.expectedFailed, e.Failed)
+			a.Equal(tc.expectedErr, e.Err)
+		})
+	}
+}
+
+func TestMessenger_PublishJobsWithMetrics(t *testing.T) {
+	batch := func(size, failed float64) recordedMetrics {
+		return recordedMetrics{
+			dimensions: metrics.Dimensions{hostDimension: "ec2"},
+			metrics: []metrics.Metric{
+				{Name: "PublishBatchSize", Value: size, Unit: metrics.Count},
+				{Name: "PublishBatchFailures", Value: failed, Unit: metrics.Count},
+			},
+		}
+	}
+
+	cases := map[string]struct {
+		messages []Message
+		failed   [][]types.BatchResultErrorEntry
+		expected []recordedMetrics
+	}{
+		"metrics per batch": {
+			messages: getTestMessages(12),
+			expected: []recordedMetrics{batch(10, 0), batch(2, 0)},
+		},
+		"failed entries": {
+			messages: getTestMessages(2),
+			failed: [][]types.BatchResultErrorEntry{
+				{{Id: aws.String("0"), SenderFault: true}},
+			},
+			expected: []recordedMetrics{batch(2, 1)},
+		},
+		"no messages": {},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			recorder := new(mockedRecorder)
+			m := New(&mockedPublishAPIClient{failed: tc.failed}, "jobs", "", WithMetrics(recorder))
+
+			_ = m.PublishJobs(context.TODO(), tc.messages)
+
+			a.ElementsMatch(tc.expected, recorder.puts)
 		})
 	}
 }
@@ -114,11 +234,35 @@ func TestMessenger_toPublishBatchRequestEntry(t *testing.T) {
 	for n, tc := range cases {
 		t.Run(n, func(t *testing.T) {
 			a := assert.New(t)
-			a.Equal(tc.expectedEntry, toPublishBatchRequestEntry(tc.messages))
+			a.Equal(tc.expectedEntry, toPublishBatchRequestEntry(context.TODO(), tc.messages))
 		})
 	}
 }
 
+func TestMessenger_toPublishBatchRequestEntryWithTraceContext(t *testing.T) {
+	a := assert.New(t)
+	propagator := otel.GetTextMapPropagator()
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+	defer otel.SetTextMapPropagator(propagator)
+
+	ctx := trace.ContextWithSpanContext(context.TODO(), trace.NewSpanContext(trace.SpanContextConfig{
+		TraceID:    trace.TraceID{0x4b, 0xf9, 0x2f, 0x35, 0x77, 0xb3, 0x4d, 0xa6, 0xa3, 0xce, 0x92, 0x9d, 0x0e, 0x0e, 0x47, 0x36},
+		SpanID:     trace.SpanID{0x00, 0xf0, 0x67, 0xaa, 0x0b, 0xa9, 0x02, 0xb7},
+		TraceFlags: trace.FlagsSampled,
+	}))
+
+	entries := toPublishBatchRequestEntry(ctx, getTestMessages(2))
+
+	a.Len(entries, 2)
+	for _, e := range entries {
+		a.Equal(
+			"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+			*e.MessageAttributes["traceparent"].StringValue,
+		)
+		a.Equal("ec2", *e.MessageAttributes[hostAttribute].StringValue)
+	}
+}
+
 func TestMessenger_NotifyPublisher(t *testing.T) {
 	publisherTopic := "publisher"
 	cases := map[string]struct {
@@ -158,6 +302,7 @@ func getTestMessages(n int) []Message {
 	res := make([]Message, 0)
 	for i := 0; i < n; i++ {
 		res = append(res, Message{
+			JobID:  uint64(i),
 			Host:   "ec2",
 			OS:     "ubuntu",
 			Status: "completed",
@@ -171,6 +316,7 @@ func getTestMessages(n int) []Message {
 type mockedPublishAPIClient struct {
 	sync.RWMutex
 	jobs               []sns.PublishBatchInput
+	failed             [][]types.BatchResultErrorEntry
 	notification       *sns.PublishInput
 	publishJobsErr     error
 	notifyPublisherErr error
@@ -197,5 +343,31 @@ func (m *mockedPublishAPIClient) PublishBatch(
 	defer m.Unlock()
 
 	m.jobs = append(m.jobs, *params)
-	return nil, m.publishJobsErr
+	if m.publishJobsErr != nil {
+		return nil, m.publishJobsErr
+	}
+
+	out := new(sns.PublishBatchOutput)
+	if len(m.failed) != 0 {
+		out.Failed, m.failed = m.failed[0], m.failed[1:]
+	}
+
+	return out, nil
+}
+
+type recordedMetrics struct {
+	dimensions metrics.Dimensions
+	metrics    []metrics.Metric
+}
+
+type mockedRecorder struct {
+	sync.Mutex
+	puts []recordedMetrics
+}
+
+func (m *mockedRecorder) Put(dimensions metrics.Dimensions, metrics ...metrics.Metric) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.puts = append(m.puts, recordedMetrics{dimensions: dimensions, metrics: metrics})
 }
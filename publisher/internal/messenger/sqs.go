@@ -0,0 +1,171 @@
+package messenger
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const sqsBatchSize = 10
+
+type SQSAPIClient interface {
+	SendMessage(ctx context.Context, params *sqs.SendMessageInput, optFns ...func(*sqs.Options)) (*sqs.SendMessageOutput, error)
+	SendMessageBatch(
+		ctx context.Context,
+		params *sqs.SendMessageBatchInput,
+		optFns ...func(*sqs.Options),
+	) (*sqs.SendMessageBatchOutput, error)
+}
+
+// Queue receives the messages of the host, or of the host and OS when OS is set.
+type Queue struct {
+	Host string
+	OS   string
+	URL  string
+}
+
+type sqsMessenger struct {
+	options
+	client         SQSAPIClient
+	queues         []Queue
+	publisherQueue string
+}
+
+// PublishJobs sends the messages to the queues of their host and OS, it fails without sending any
+// message if a message has no queue.
+func (n *sqsMessenger) PublishJobs(ctx context.Context, messages []Message) (err error) {
+	ctx, span := tracer.Start(ctx, "messenger.PublishJobs", trace.WithAttributes(
+		attribute.Int("messages", len(messages)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	routed := make(map[string][]Message)
+	queues := make([]string, 0)
+	for _, m := range messages {
+		q, qErr := n.getQueue(&m)
+		if qErr != nil {
+			return qErr
+		}
+
+		if _, ok := routed[q]; !ok {
+			queues = append(queues, q)
+		}
+
+		routed[q] = append(routed[q], m)
+	}
+
+	batches, batchQueues := make([][]Message, 0), make([]string, 0)
+	for _, q := range queues {
+		for _, b := range partition(routed[q], sqsBatchSize) {
+			batches = append(batches, b)
+			batchQueues = append(batchQueues, q)
+		}
+	}
+
+	return publishBatches(ctx, n.metrics, batches, func(ctx context.Context, i int, messages []Message) ([]entryError, error) {
+		queue := batchQueues[i]
+		bCtx, bSpan := tracer.Start(ctx, "sqs.SendMessageBatch", trace.WithAttributes(
+			attribute.String("queue", queue),
+			attribute.Int("entries", len(messages)),
+		))
+		out, err := n.client.SendMessageBatch(bCtx, &sqs.SendMessageBatchInput{
+			Entries:  toSendMessageBatchRequestEntry(ctx, messages),
+			QueueUrl: aws.String(queue),
+		})
+		tracing.End(bSpan, err)
+
+		if err != nil {
+			return nil, err
+		}
+
+		errs := make([]entryError, 0)
+		for _, f := range out.Failed {
+			errs = append(errs, entryError{id: aws.ToString(f.Id), retryable: !f.SenderFault})
+		}
+
+		return errs, nil
+	})
+}
+
+func (n *sqsMessenger) NotifyPublisher(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "sqs.SendMessage")
+	defer func() { tracing.End(span, err) }()
+
+	_, err = n.client.SendMessage(ctx, &sqs.SendMessageInput{
+		QueueUrl:    aws.String(n.publisherQueue),
+		MessageBody: aws.String(getEnvelopeBody(Envelope{Message: getMessage(messageSource)})),
+	})
+
+	return err
+}
+
+// getQueue prefers the queue of the host and OS over the queue of the host.
+func (n *sqsMessenger) getQueue(m *Message) (string, error) {
+	url := ""
+	for _, q := range n.queues {
+		if q.Host != m.Host {
+			continue
+		}
+
+		if q.OS == m.OS {
+			return q.URL, nil
+		}
+
+		if q.OS == "" {
+			url = q.URL
+		}
+	}
+
+	if url == "" {
+		return "", fmt.Errorf("no queue for host %v and os %v", m.Host, m.OS)
+	}
+
+	return url, nil
+}
+
+// toSendMessageBatchRequestEntry sends the envelope as the message body, as SNS does for its
+// subscribed queues, and sets the same message attributes, so queue filters can use them.
+func toSendMessageBatchRequestEntry(ctx context.Context, messages []Message) []types.SendMessageBatchRequestEntry {
+	entries := make([]types.SendMessageBatchRequestEntry, 0)
+	for i := range messages {
+		e := toEnvelope(ctx, &messages[i])
+		attributes := make(map[string]types.MessageAttributeValue, len(e.MessageAttributes))
+		for k, v := range e.MessageAttributes {
+			attributes[k] = types.MessageAttributeValue{
+				DataType:    aws.String(v.Type),
+				StringValue: aws.String(v.Value),
+			}
+		}
+
+		entries = append(entries, types.SendMessageBatchRequestEntry{
+			Id:                aws.String(strconv.Itoa(i)),
+			MessageBody:       aws.String(getEnvelopeBody(e)),
+			MessageAttributes: attributes,
+		})
+	}
+
+	return entries
+}
+
+func getEnvelopeBody(e Envelope) string {
+	b, _ := json.Marshal(e)
+	return string(b)
+}
+
+// NewSQS sends the messages to SQS queues directly, without the SNS topics.
+func NewSQS(client SQSAPIClient, queues []Queue, publisherQueue string, opts ...Option) Messenger {
+	return &sqsMessenger{
+		options:        getOptions(opts),
+		client:         client,
+		queues:         queues,
+		publisherQueue: publisherQueue,
+	}
+}
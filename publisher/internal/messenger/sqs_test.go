@@ -0,0 +1,194 @@
+package messenger
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sqs"
+	"github.com/aws/aws-sdk-go-v2/service/sqs/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSQSMessenger_PublishJobs(t *testing.T) {
+	defer func(d time.Duration) { retryBackoff = d }(retryBackoff)
+	retryBackoff = 0
+
+	queues := []Queue{
+		{Host: "ec2", URL: "ec2"},
+		{Host: "ec2", OS: "windows", URL: "ec2-windows"},
+		{Host: "eks", OS: "ubuntu", URL: "eks-ubuntu"},
+	}
+	windows := Message{Host: "ec2", OS: "windows", Status: "queued", Body: "msg"}
+	eks := Message{Host: "eks", OS: "ubuntu", Status: "queued", Body: "msg"}
+
+	cases := map[string]struct {
+		messages []Message
+		failed   [][]types.BatchResultErrorEntry
+		sendErr  error
+		expected []sqs.SendMessageBatchInput
+		err      error
+	}{
+		"send jobs to the queues of their host and os": {
+			messages: append(append(getTestMessages(12), windows), eks),
+			expected: []sqs.SendMessageBatchInput{
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(10)),
+					QueueUrl: aws.String("ec2"),
+				},
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(2)),
+					QueueUrl: aws.String("ec2"),
+				},
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), []Message{windows}),
+					QueueUrl: aws.String("ec2-windows"),
+				},
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), []Message{eks}),
+					QueueUrl: aws.String("eks-ubuntu"),
+				},
+			},
+		},
+		"no queue for message": {
+			messages: []Message{{Host: "eks", OS: "windows"}},
+			err:      errors.New("no queue for host eks and os windows"),
+		},
+		"retry failed entries": {
+			messages: getTestMessages(2),
+			failed:   [][]types.BatchResultErrorEntry{{{Id: aws.String("1")}}},
+			expected: []sqs.SendMessageBatchInput{
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(2)),
+					QueueUrl: aws.String("ec2"),
+				},
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(2)[1:]),
+					QueueUrl: aws.String("ec2"),
+				},
+			},
+		},
+		"sender fault entries": {
+			messages: getTestMessages(2),
+			failed:   [][]types.BatchResultErrorEntry{{{Id: aws.String("1"), SenderFault: true}}},
+			expected: []sqs.SendMessageBatchInput{
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(2)),
+					QueueUrl: aws.String("ec2"),
+				},
+			},
+			err: &PublishError{Failed: getTestMessages(2)[1:]},
+		},
+		"failed to send jobs": {
+			messages: getTestMessages(2),
+			sendErr:  errors.New("failed to send jobs"),
+			expected: []sqs.SendMessageBatchInput{
+				{
+					Entries:  toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(2)),
+					QueueUrl: aws.String("ec2"),
+				},
+			},
+			err: &PublishError{Failed: getTestMessages(2), Err: errors.New("failed to send jobs")},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedSQSAPIClient{failed: tc.failed, sendErr: tc.sendErr}
+
+			a.Equal(tc.err, NewSQS(client, queues, "").PublishJobs(context.TODO(), tc.messages))
+			a.ElementsMatch(tc.expected, client.batches)
+		})
+	}
+}
+
+func TestSQSMessenger_toSendMessageBatchRequestEntry(t *testing.T) {
+	a := assert.New(t)
+	entries := toSendMessageBatchRequestEntry(context.TODO(), getTestMessages(1))
+
+	a.Equal([]types.SendMessageBatchRequestEntry{
+		{
+			Id: aws.String("0"),
+			MessageBody: aws.String(`{"Message":"msg","MessageAttributes":{` +
+				`"Host":{"Type":"String","Value":"ec2"},` +
+				`"OS":{"Type":"String","Value":"ubuntu"},` +
+				`"Status":{"Type":"String","Value":"completed"}}}`),
+			MessageAttributes: map[string]types.MessageAttributeValue{
+				hostAttribute:   {DataType: aws.String("String"), StringValue: aws.String("ec2")},
+				osAttribute:     {DataType: aws.String("String"), StringValue: aws.String("ubuntu")},
+				statusAttribute: {DataType: aws.String("String"), StringValue: aws.String("completed")},
+			},
+		},
+	}, entries)
+}
+
+func TestSQSMessenger_NotifyPublisher(t *testing.T) {
+	cases := map[string]struct {
+		sendErr error
+		err     error
+	}{
+		"notify publisher": {},
+		"failed to notify publisher": {
+			sendErr: errors.New("failed to notify publisher"),
+			err:     errors.New("failed to notify publisher"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &mockedSQSAPIClient{sendErr: tc.sendErr}
+
+			a.Equal(tc.err, NewSQS(client, nil, "publisher").NotifyPublisher(context.TODO()))
+			a.Equal(&sqs.SendMessageInput{
+				QueueUrl:    aws.String("publisher"),
+				MessageBody: aws.String(`{"Message":"{\"Source\":\"Publisher\"}"}`),
+			}, client.notification)
+		})
+	}
+}
+
+type mockedSQSAPIClient struct {
+	sync.Mutex
+	batches      []sqs.SendMessageBatchInput
+	notification *sqs.SendMessageInput
+	failed       [][]types.BatchResultErrorEntry
+	sendErr      error
+}
+
+func (m *mockedSQSAPIClient) SendMessage(
+	_ context.Context,
+	params *sqs.SendMessageInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.notification = params
+	return new(sqs.SendMessageOutput), m.sendErr
+}
+
+func (m *mockedSQSAPIClient) SendMessageBatch(
+	_ context.Context,
+	params *sqs.SendMessageBatchInput,
+	_ ...func(*sqs.Options),
+) (*sqs.SendMessageBatchOutput, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	m.batches = append(m.batches, *params)
+	if m.sendErr != nil {
+		return nil, m.sendErr
+	}
+
+	out := new(sqs.SendMessageBatchOutput)
+	if len(m.failed) != 0 {
+		out.Failed, m.failed = m.failed[0], m.failed[1:]
+	}
+
+	return out, nil
+}
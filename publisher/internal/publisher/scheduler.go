@@ -0,0 +1,314 @@
+package publisher
+
+import (
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+)
+
+const (
+	// DefaultWindowFactor is how many queued jobs per free slot the fair share scheduler considers.
+	DefaultWindowFactor = 10
+
+	// maxWindows bounds the windows of queued jobs read for the free slots of a host.
+	maxWindows = 10
+)
+
+// Scheduler picks the queued jobs which are published into the free slots of a host.
+type Scheduler interface {
+	// Window returns how many queued jobs, in index order, are read at a time for the free slots.
+	Window(free int32) int32
+	// Satisfied reports whether the queued jobs read so far, in index order, already contain the
+	// jobs scheduled into the free slots, otherwise the next window is read.
+	Satisfied(queued, inProgress []storage.Job, free int32) bool
+	// Schedule picks at most free jobs from queued, in-progress jobs are the running share of each
+	// owner and repository.
+	Schedule(queued, inProgress []storage.Job, free int32) []storage.Job
+}
+
+type fifoScheduler struct{}
+
+func (fifoScheduler) Window(free int32) int32 {
+	return free
+}
+
+func (fifoScheduler) Satisfied(queued, _ []storage.Job, free int32) bool {
+	return int32(len(queued)) >= free
+}
+
+func (fifoScheduler) Schedule(queued, _ []storage.Job, free int32) []storage.Job {
+	if int32(len(queued)) > free {
+		return queued[:free]
+	}
+
+	return queued
+}
+
+// NewFIFOScheduler publishes queued jobs in index order, it's the default scheduler.
+func NewFIFOScheduler() Scheduler {
+	return fifoScheduler{}
+}
+
+// FairShareConfig sets weights and caps by "owner/repository" or by "owner", an owner setting
+// applies to each of its repositories, and a repository setting takes precedence over its owner.
+type FairShareConfig struct {
+	// WindowFactor is how many queued jobs per free slot are considered, DefaultWindowFactor if 0.
+	WindowFactor int32
+	// Weights of the slots share, 1 if not set.
+	Weights map[string]int
+	// Caps limit the running jobs, in-progress and scheduled, 0 or not set means no cap.
+	Caps map[string]int
+}
+
+type share struct {
+	queued  []storage.Job
+	running int
+	weight  int
+	cap     int
+}
+
+type fairShareScheduler struct {
+	config *FairShareConfig
+}
+
+func (s *fairShareScheduler) Window(free int32) int32 {
+	factor := s.config.WindowFactor
+	if factor <= 0 {
+		factor = DefaultWindowFactor
+	}
+
+	return free * factor
+}
+
+// Satisfied holds once every free slot goes to a repository without running jobs, a repository
+// beyond the queued jobs read so far can't take a slot from those, as ties go to index order.
+func (s *fairShareScheduler) Satisfied(queued, inProgress []storage.Job, free int32) bool {
+	scheduled, settled := s.schedule(queued, inProgress, free)
+	return int32(len(scheduled)) >= free && settled
+}
+
+// Schedule gives each slot to the repository with the lowest running jobs to weight ratio, so
+// repositories with equal weights are served round-robin.
+func (s *fairShareScheduler) Schedule(queued, inProgress []storage.Job, free int32) []storage.Job {
+	scheduled, _ := s.schedule(queued, inProgress, free)
+	return scheduled
+}
+
+// schedule also reports whether every slot went to a repository without running jobs.
+func (s *fairShareScheduler) schedule(queued, inProgress []storage.Job, free int32) ([]storage.Job, bool) {
+	shares := make(map[string]*share)
+	order := make([]string, 0)
+	get := func(j *storage.Job) *share {
+		key := getShareKey(j)
+		sh, ok := shares[key]
+		if !ok {
+			sh = &share{
+				weight: lookup(s.config.Weights, j, 1),
+				cap:    lookup(s.config.Caps, j, 0),
+			}
+			if sh.weight <= 0 {
+				sh.weight = 1
+			}
+
+			shares[key] = sh
+			order = append(order, key)
+		}
+
+		return sh
+	}
+
+	for i := range queued {
+		sh := get(&queued[i])
+		sh.queued = append(sh.queued, queued[i])
+	}
+
+	for i := range inProgress {
+		get(&inProgress[i]).running++
+	}
+
+	scheduled := make([]storage.Job, 0)
+	settled := true
+	for int32(len(scheduled)) < free {
+		var next *share
+		for _, key := range order {
+			sh := shares[key]
+			if len(sh.queued) == 0 || (sh.cap > 0 && sh.running >= sh.cap) {
+				continue
+			}
+
+			// compare running/weight ratios, ties go to the repository seen first in index order.
+			if next == nil || sh.running*next.weight < next.running*sh.weight {
+				next = sh
+			}
+		}
+
+		if next == nil {
+			break
+		}
+
+		settled = settled && next.running == 0
+		scheduled = append(scheduled, next.queued[0])
+		next.queued = next.queued[1:]
+		next.running++
+	}
+
+	return scheduled, settled
+}
+
+// NewFairShareScheduler allocates free slots across repositories by weighted share.
+func NewFairShareScheduler(config *FairShareConfig) Scheduler {
+	return &fairShareScheduler{config: config}
+}
+
+func getShareKey(j *storage.Job) string {
+	return fmt.Sprintf("%v/%v", j.Content.Owner, j.Content.Repository)
+}
+
+func lookup(values map[string]int, j *storage.Job, fallback int) int {
+	if v, ok := values[getShareKey(j)]; ok {
+		return v
+	}
+
+	if v, ok := values[j.Content.Owner]; ok {
+		return v
+	}
+
+	return fallback
+}
+
+// PriorityRule matches queued jobs which have all the labels, and the owner and repository when
+// they are set.
+type PriorityRule struct {
+	Labels     []string
+	Owner      string
+	Repository string
+	Priority   int
+}
+
+func (r *PriorityRule) match(j *storage.Job) bool {
+	if r.Owner != "" && r.Owner != j.Content.Owner {
+		return false
+	}
+
+	if r.Repository != "" && r.Repository != j.Content.Repository {
+		return false
+	}
+
+	for _, l := range r.Labels {
+		if !inSlice(l, j.Content.Labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type PriorityConfig struct {
+	// WindowFactor is how many queued jobs per free slot are considered, DefaultWindowFactor if 0.
+	WindowFactor int32
+	// Rules set the priority of matching jobs, the highest matching priority is used.
+	Rules []PriorityRule
+	// DefaultPriority is the priority of jobs which match no rule.
+	DefaultPriority int
+	// AgingInterval raises the priority of a queued job by one for every interval it has waited,
+	// so low priority jobs eventually run, 0 disables aging.
+	AgingInterval time.Duration
+}
+
+type priorityScheduler struct {
+	config *PriorityConfig
+	now    func() time.Time
+}
+
+func (s *priorityScheduler) Window(free int32) int32 {
+	factor := s.config.WindowFactor
+	if factor <= 0 {
+		factor = DefaultWindowFactor
+	}
+
+	return free * factor
+}
+
+// Satisfied holds once the lowest scheduled priority reaches the highest priority a job beyond the
+// queued jobs read so far could have, those jobs were created later, so they aged less.
+func (s *priorityScheduler) Satisfied(queued, inProgress []storage.Job, free int32) bool {
+	if free <= 0 {
+		return true
+	}
+
+	scheduled := s.Schedule(queued, inProgress, free)
+	if int32(len(scheduled)) < free {
+		return false
+	}
+
+	highest := s.config.DefaultPriority
+	for _, r := range s.config.Rules {
+		if r.Priority > highest {
+			highest = r.Priority
+		}
+	}
+
+	return s.priority(&scheduled[len(scheduled)-1]) >= highest+s.age(&queued[len(queued)-1])
+}
+
+// Schedule picks the highest priority jobs, jobs with the same priority keep the index order.
+func (s *priorityScheduler) Schedule(queued, _ []storage.Job, free int32) []storage.Job {
+	jobs := append([]storage.Job{}, queued...)
+	priorities := make(map[uint64]int, len(jobs))
+	for i := range jobs {
+		priorities[jobs[i].ID] = s.priority(&jobs[i])
+	}
+
+	sort.SliceStable(jobs, func(i, j int) bool {
+		return priorities[jobs[i].ID] > priorities[jobs[j].ID]
+	})
+
+	if int32(len(jobs)) > free {
+		return jobs[:free]
+	}
+
+	return jobs
+}
+
+func (s *priorityScheduler) priority(j *storage.Job) int {
+	p := s.config.DefaultPriority
+	matched := false
+	for i := range s.config.Rules {
+		r := &s.config.Rules[i]
+		if r.match(j) && (!matched || r.Priority > p) {
+			p = r.Priority
+			matched = true
+		}
+	}
+
+	return p + s.age(j)
+}
+
+// age is the priority a queued job gained by waiting.
+func (s *priorityScheduler) age(j *storage.Job) int {
+	if s.config.AgingInterval <= 0 || j.CreatedAt <= 0 {
+		return 0
+	}
+
+	return int(s.now().Sub(time.UnixMilli(j.CreatedAt)) / s.config.AgingInterval)
+}
+
+// NewPriorityScheduler publishes queued jobs by the priority of the rules they match.
+func NewPriorityScheduler(config *PriorityConfig) Scheduler {
+	return &priorityScheduler{
+		config: config,
+		now:    time.Now,
+	}
+}
+
+func inSlice(key string, s []string) bool {
+	for _, i := range s {
+		if key == i {
+			return true
+		}
+	}
+
+	return false
+}
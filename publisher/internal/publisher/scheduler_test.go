@@ -0,0 +1,319 @@
+package publisher
+
+import (
+	"testing"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFIFOScheduler(t *testing.T) {
+	a := assert.New(t)
+	s := NewFIFOScheduler()
+	queued := []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "b")}
+
+	a.Equal(int32(2), s.Window(2))
+	a.Equal([]uint64{1, 2}, getJobIDs(s.Schedule(queued, nil, 2)))
+	a.Equal([]uint64{1, 2, 3}, getJobIDs(s.Schedule(queued, nil, 5)))
+	a.True(s.Satisfied(queued, nil, 3))
+	a.False(s.Satisfied(queued, nil, 4))
+}
+
+func TestScheduler_Window(t *testing.T) {
+	a := assert.New(t)
+
+	a.Equal(int32(20), NewFairShareScheduler(new(FairShareConfig)).Window(2))
+	a.Equal(int32(6), NewFairShareScheduler(&FairShareConfig{WindowFactor: 3}).Window(2))
+	a.Equal(int32(20), NewPriorityScheduler(new(PriorityConfig)).Window(2))
+	a.Equal(int32(6), NewPriorityScheduler(&PriorityConfig{WindowFactor: 3}).Window(2))
+}
+
+func TestFairShareScheduler_Schedule(t *testing.T) {
+	cases := map[string]struct {
+		config      *FairShareConfig
+		queued      []storage.Job
+		inProgress  []storage.Job
+		free        int32
+		expectedIDs []uint64
+	}{
+		"round-robin across repositories": {
+			config: new(FairShareConfig),
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a"), getRepoJob(4, "b"), getRepoJob(5, "c"),
+			},
+			free:        3,
+			expectedIDs: []uint64{1, 4, 5},
+		},
+		"in-progress jobs count toward the share": {
+			config:      new(FairShareConfig),
+			queued:      []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "b"), getRepoJob(4, "b")},
+			inProgress:  []storage.Job{getRepoJob(10, "a"), getRepoJob(11, "a")},
+			free:        2,
+			expectedIDs: []uint64{3, 4},
+		},
+		"weighted share": {
+			config: &FairShareConfig{Weights: map[string]int{"owner/a": 2}},
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a"),
+				getRepoJob(4, "b"), getRepoJob(5, "b"), getRepoJob(6, "b"),
+			},
+			free:        3,
+			expectedIDs: []uint64{1, 4, 2},
+		},
+		"owner weight applies to its repositories": {
+			config: &FairShareConfig{Weights: map[string]int{"owner": 3, "owner/b": 1}},
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a"),
+				getRepoJob(4, "b"), getRepoJob(5, "b"),
+			},
+			free:        4,
+			expectedIDs: []uint64{1, 4, 2, 3},
+		},
+		"capped repository": {
+			config:      &FairShareConfig{Caps: map[string]int{"owner/a": 1}},
+			queued:      []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "b"), getRepoJob(4, "b")},
+			free:        3,
+			expectedIDs: []uint64{1, 3, 4},
+		},
+		"capped repository with in-progress jobs": {
+			config:      &FairShareConfig{Caps: map[string]int{"owner/a": 1}},
+			queued:      []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a")},
+			inProgress:  []storage.Job{getRepoJob(10, "a")},
+			free:        2,
+			expectedIDs: []uint64{},
+		},
+		"fewer queued jobs than free slots": {
+			config:      new(FairShareConfig),
+			queued:      []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "b")},
+			free:        5,
+			expectedIDs: []uint64{1, 2},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.expectedIDs, getJobIDs(NewFairShareScheduler(tc.config).Schedule(tc.queued, tc.inProgress, tc.free)))
+		})
+	}
+}
+
+func TestFairShareScheduler_Satisfied(t *testing.T) {
+	cases := map[string]struct {
+		config     *FairShareConfig
+		queued     []storage.Job
+		inProgress []storage.Job
+		free       int32
+		expected   bool
+	}{
+		"a repository for each slot": {
+			config:   new(FairShareConfig),
+			queued:   []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "b")},
+			free:     2,
+			expected: true,
+		},
+		"one repository fills the window": {
+			config:   new(FairShareConfig),
+			queued:   []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a")},
+			free:     2,
+			expected: false,
+		},
+		"repository with running jobs": {
+			config:     new(FairShareConfig),
+			queued:     []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "b")},
+			inProgress: []storage.Job{getRepoJob(10, "b")},
+			free:       2,
+			expected:   false,
+		},
+		"capped repository": {
+			config:   &FairShareConfig{Caps: map[string]int{"owner/a": 1}},
+			queued:   []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "b")},
+			free:     2,
+			expected: true,
+		},
+		"not enough queued jobs": {
+			config:   new(FairShareConfig),
+			queued:   []storage.Job{getRepoJob(1, "a")},
+			free:     2,
+			expected: false,
+		},
+		"no free slots": {
+			config:   new(FairShareConfig),
+			expected: true,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.expected, NewFairShareScheduler(tc.config).Satisfied(tc.queued, tc.inProgress, tc.free))
+		})
+	}
+}
+
+func TestPriorityScheduler_Schedule(t *testing.T) {
+	now := time.UnixMilli(1640995200000)
+	cases := map[string]struct {
+		config      *PriorityConfig
+		queued      []storage.Job
+		free        int32
+		expectedIDs []uint64
+	}{
+		"keep index order without rules": {
+			config:      new(PriorityConfig),
+			queued:      []storage.Job{getLabelledJob(1, 0, "nightly"), getLabelledJob(2, 0, "release")},
+			free:        1,
+			expectedIDs: []uint64{1},
+		},
+		"publish highest priority jobs first": {
+			config: &PriorityConfig{Rules: []PriorityRule{
+				{Labels: []string{"release"}, Priority: 10},
+				{Labels: []string{"hotfix"}, Priority: 20},
+			}},
+			queued: []storage.Job{
+				getLabelledJob(1, 0, "nightly"),
+				getLabelledJob(2, 0, "release"),
+				getLabelledJob(3, 0, "hotfix"),
+				getLabelledJob(4, 0, "release"),
+			},
+			free:        3,
+			expectedIDs: []uint64{3, 2, 4},
+		},
+		"highest matching rule wins": {
+			config: &PriorityConfig{Rules: []PriorityRule{
+				{Labels: []string{"release"}, Priority: 10},
+				{Labels: []string{"release", "ubuntu"}, Priority: 30},
+				{Labels: []string{"hotfix"}, Priority: 20},
+			}},
+			queued: []storage.Job{
+				getLabelledJob(1, 0, "hotfix"),
+				getLabelledJob(2, 0, "release", "ubuntu"),
+			},
+			free:        1,
+			expectedIDs: []uint64{2},
+		},
+		"match owner and repository": {
+			config: &PriorityConfig{
+				Rules:           []PriorityRule{{Owner: "owner", Repository: "b", Priority: 5}},
+				DefaultPriority: 1,
+			},
+			queued:      []storage.Job{getRepoJob(1, "a"), getRepoJob(2, "b")},
+			free:        1,
+			expectedIDs: []uint64{2},
+		},
+		"negative priority below default": {
+			config: &PriorityConfig{Rules: []PriorityRule{{Labels: []string{"nightly"}, Priority: -5}}},
+			queued: []storage.Job{
+				getLabelledJob(1, 0, "nightly"),
+				getLabelledJob(2, 0, "lint"),
+			},
+			free:        1,
+			expectedIDs: []uint64{2},
+		},
+		"aged low priority job runs first": {
+			config: &PriorityConfig{
+				Rules:         []PriorityRule{{Labels: []string{"release"}, Priority: 2}},
+				AgingInterval: time.Minute,
+			},
+			queued: []storage.Job{
+				getLabelledJob(1, now.Add(-time.Minute*3).UnixMilli(), "nightly"),
+				getLabelledJob(2, now.Add(-time.Minute).UnixMilli(), "nightly"),
+				getLabelledJob(3, now.UnixMilli(), "release"),
+			},
+			free:        2,
+			expectedIDs: []uint64{1, 3},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := NewPriorityScheduler(tc.config).(*priorityScheduler)
+			s.now = func() time.Time { return now }
+
+			a.Equal(tc.expectedIDs, getJobIDs(s.Schedule(tc.queued, nil, tc.free)))
+		})
+	}
+}
+
+func TestPriorityScheduler_Satisfied(t *testing.T) {
+	now := time.UnixMilli(1640995200000)
+	rules := []PriorityRule{{Labels: []string{"release"}, Priority: 10}}
+	cases := map[string]struct {
+		config   *PriorityConfig
+		queued   []storage.Job
+		free     int32
+		expected bool
+	}{
+		"highest priority jobs": {
+			config:   &PriorityConfig{Rules: rules},
+			queued:   []storage.Job{getLabelledJob(1, 0, "release"), getLabelledJob(2, 0, "nightly")},
+			free:     1,
+			expected: true,
+		},
+		"later jobs may have a higher priority": {
+			config:   &PriorityConfig{Rules: rules},
+			queued:   []storage.Job{getLabelledJob(1, 0, "release"), getLabelledJob(2, 0, "nightly")},
+			free:     2,
+			expected: false,
+		},
+		"aged jobs outrank later jobs": {
+			config: &PriorityConfig{Rules: rules, AgingInterval: time.Minute},
+			queued: []storage.Job{
+				getLabelledJob(1, now.Add(-time.Minute*20).UnixMilli(), "nightly"),
+				getLabelledJob(2, now.UnixMilli(), "nightly"),
+			},
+			free:     1,
+			expected: true,
+		},
+		"not enough queued jobs": {
+			config:   new(PriorityConfig),
+			queued:   []storage.Job{getLabelledJob(1, 0, "nightly")},
+			free:     2,
+			expected: false,
+		},
+		"no free slots": {
+			config:   new(PriorityConfig),
+			expected: true,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := NewPriorityScheduler(tc.config).(*priorityScheduler)
+			s.now = func() time.Time { return now }
+
+			a.Equal(tc.expected, s.Satisfied(tc.queued, nil, tc.free))
+		})
+	}
+}
+
+func getLabelledJob(id uint64, createdAt int64, labels ...string) storage.Job {
+	return storage.Job{
+		ID:        id,
+		Host:      "ec2",
+		Status:    queuedStatus,
+		CreatedAt: createdAt,
+		Content: storage.JobContent{
+			ID:         id,
+			Owner:      "owner",
+			Repository: "repo",
+			Labels:     labels,
+		},
+	}
+}
+
+func getRepoJob(id uint64, repository string) storage.Job {
+	return storage.Job{
+		ID:     id,
+		Host:   "ec2",
+		Status: queuedStatus,
+		Content: storage.JobContent{
+			ID:         id,
+			Owner:      "owner",
+			Repository: repository,
+		},
+	}
+}
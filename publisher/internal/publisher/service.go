@@ -2,10 +2,19 @@ package publisher
 
 import (
 	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"time"
 
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/breaker"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"golang.org/x/sync/errgroup"
 )
@@ -14,17 +23,57 @@ const (
 	queuedStatus     = "queued"
 	inProgressStatus = "in_progress"
 	completedStatus  = "completed"
+
+	hostDimension = "Host"
+	osDimension   = "OS"
+
+	// runningJobsLimit bounds the completed and in-progress jobs read for a host option. It doesn't
+	// follow the option limit, runners launched before the limit was lowered, or set to 0 to drain
+	// the host, are still terminated.
+	runningJobsLimit = 1000
 )
 
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher")
+
+// HostOption limits the runners of a host, or of an OS and labels of the host when they are set.
+// The options of a host should select disjoint jobs, e.g. one option per OS, as they are processed
+// concurrently and overlapping options would publish the same queued jobs.
 type HostOption struct {
-	Host  string
-	Limit int32
+	Host   string
+	OS     string
+	Labels []string
+	Limit  int32
+}
+
+// LimitSource returns the host options of each Publish call, so limits can be changed without a
+// redeployment.
+type LimitSource interface {
+	HostOptions(ctx context.Context) ([]HostOption, error)
 }
 
 type Jobs struct {
 	Queued     []storage.Job
 	InProgress []storage.Job
 	Completed  []storage.Job
+	// Stale are in-progress jobs whose runner never launched or whose completed webhook was lost.
+	Stale []storage.Job
+	// Cancelled are jobs completed before they were claimed, no runner was launched for them.
+	Cancelled []storage.Job
+}
+
+type StaleAction string
+
+const (
+	// RequeueStaleJobs publishes stale jobs again once their runners are terminated.
+	RequeueStaleJobs StaleAction = "requeue"
+	// ExpireStaleJobs deletes stale jobs once their runners are terminated.
+	ExpireStaleJobs StaleAction = "expire"
+)
+
+type StaleJobsConfig struct {
+	// Threshold is how long a job may stay in progress, 0 disables stale job detection.
+	Threshold time.Duration
+	Action    StaleAction
 }
 
 type Publisher interface {
@@ -35,13 +84,63 @@ type publisher struct {
 	hostOptions []HostOption
 	messenger   messenger.Messenger
 	storage     storage.Storage
+	metrics     metrics.Recorder
+	breaker     breaker.Breaker
+	scheduler   Scheduler
+	limits      LimitSource
+	staleJobs   StaleJobsConfig
+	now         func() time.Time
 	logger      *zap.Logger
 }
 
-func (p *publisher) Publish(ctx context.Context) error {
+type Option func(p *publisher)
+
+// WithMetrics records job counts per host and OS, and the published jobs per host.
+func WithMetrics(r metrics.Recorder) Option {
+	return func(p *publisher) {
+		p.metrics = r
+	}
+}
+
+// WithBreaker holds back the queued jobs of hosts whose breaker is open, and publishes a single queued job to
+// probe a half-open host.
+func WithBreaker(b breaker.Breaker) Option {
+	return func(p *publisher) {
+		p.breaker = b
+	}
+}
+
+// WithScheduler picks the queued jobs published into the free slots, jobs are published in index
+// order by default.
+func WithScheduler(s Scheduler) Option {
+	return func(p *publisher) {
+		p.scheduler = s
+	}
+}
+
+// WithLimitSource reads the host options from the source on each Publish, the host options passed to
+// New are used when the source fails or has none.
+func WithLimitSource(s LimitSource) Option {
+	return func(p *publisher) {
+		p.limits = s
+	}
+}
+
+// WithStaleJobs terminates the runners of jobs in progress for longer than the threshold, and then
+// requeues or expires the jobs.
+func WithStaleJobs(config StaleJobsConfig) Option {
+	return func(p *publisher) {
+		p.staleJobs = config
+	}
+}
+
+func (p *publisher) Publish(ctx context.Context) (err error) {
+	ctx, span := tracer.Start(ctx, "publisher.Publish")
+	defer func() { tracing.End(span, err) }()
+
 	g, gCtx := errgroup.WithContext(ctx)
 
-	for _, i := range p.hostOptions {
+	for _, i := range p.getHostOptions(ctx) {
 		opt := i
 		g.Go(func() error {
 			select {
@@ -56,25 +155,106 @@ func (p *publisher) Publish(ctx context.Context) error {
 	return g.Wait()
 }
 
-func (p *publisher) process(ctx context.Context, opt HostOption) error {
+func (p *publisher) getHostOptions(ctx context.Context) []HostOption {
+	opts := p.hostOptions
+	if p.limits != nil {
+		o, err := p.limits.HostOptions(ctx)
+		switch {
+		case err != nil:
+			p.logger.Warn("failed to get concurrency limits, using defaults", zap.Error(err))
+		case len(o) == 0:
+			p.logger.Warn("no concurrency limits configured, using defaults")
+		default:
+			opts = o
+		}
+	}
+
+	p.logger.Info("using concurrency limits", zap.Any("limits", opts))
+	return opts
+}
+
+func (p *publisher) process(ctx context.Context, opt HostOption) (err error) {
+	ctx, span := tracer.Start(ctx, "publisher.process", trace.WithAttributes(
+		attribute.String("host", opt.Host),
+		attribute.String("os", opt.OS),
+		attribute.StringSlice("labels", opt.Labels),
+		attribute.Int("limit", int(opt.Limit)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	state, bErr := p.breaker.State(ctx, opt.Host)
+	if bErr != nil {
+		p.logger.Warn("failed to get circuit breaker state",
+			zap.String("host", opt.Host),
+			zap.Error(bErr),
+		)
+	}
+
+	span.SetAttributes(attribute.String("breaker", string(state)))
+
+	switch state {
+	case breaker.Open:
+		p.logger.Info("circuit breaker is open, skipping queued jobs", zap.String("host", opt.Host))
+	case breaker.HalfOpen:
+		p.logger.Info("circuit breaker is half-open, probing host", zap.String("host", opt.Host))
+	}
+
 	p.logger.Info("retrieving jobs",
 		zap.String("host", opt.Host),
+		zap.String("os", opt.OS),
+		zap.Strings("labels", opt.Labels),
 		zap.Int32("limit", opt.Limit),
 	)
 
-	jobs, jErr := p.getJobs(ctx, opt)
+	// an open breaker only holds back the queued jobs, runners of completed, stale and cancelled jobs
+	// are still terminated.
+	jobs, jErr := p.getJobs(ctx, opt, state != breaker.Open)
 
 	if jErr != nil {
 		return jErr
 	}
 
+	if state == breaker.HalfOpen && len(jobs.Queued) > 1 {
+		jobs.Queued = jobs.Queued[:1]
+	}
+
+	token, cErr := p.claimJobs(ctx, jobs)
+	if cErr != nil {
+		return cErr
+	}
+
 	p.logger.Info("processing jobs",
 		zap.Uint64s("queued", getJobIDs(jobs.Queued)),
 		zap.Uint64s("in_progress", getJobIDs(jobs.InProgress)),
 		zap.Uint64s("completed", getJobIDs(jobs.Completed)),
 	)
 
-	if len(jobs.Queued) != 0 || len(jobs.InProgress) != 0 || len(jobs.Completed) != 0 {
+	if len(jobs.Stale) != 0 {
+		p.logger.Warn("terminating runners of stale jobs",
+			zap.Uint64s("stale", getJobIDs(jobs.Stale)),
+			zap.String("action", string(p.staleJobs.Action)),
+		)
+
+		p.metrics.Put(
+			metrics.Dimensions{hostDimension: opt.Host},
+			metrics.Metric{Name: "StaleJobs", Value: float64(len(jobs.Stale)), Unit: metrics.Count},
+		)
+	}
+
+	if len(jobs.Cancelled) != 0 {
+		p.logger.Info("deleting jobs cancelled before they were claimed",
+			zap.Uint64s("cancelled", getJobIDs(jobs.Cancelled)),
+		)
+
+		p.metrics.Put(
+			metrics.Dimensions{hostDimension: opt.Host},
+			metrics.Metric{Name: "CancelledJobs", Value: float64(len(jobs.Cancelled)), Unit: metrics.Count},
+		)
+	}
+
+	p.recordJobs(opt.Host, jobs)
+
+	if len(jobs.Queued) != 0 || len(jobs.InProgress) != 0 || len(jobs.Completed) != 0 || len(jobs.Stale) != 0 {
 		defer func() {
 			p.logger.Info(
 				"notify publisher",
@@ -83,74 +263,327 @@ func (p *publisher) process(ctx context.Context, opt HostOption) error {
 		}()
 	}
 
-	if len(jobs.Queued) == 0 && len(jobs.Completed) == 0 {
-		return nil
+	msg := append(toMessage(jobs.Queued), toMessage(jobs.Completed)...)
+	msg = append(msg, toTerminateMessage(jobs.Stale)...)
+	if len(msg) == 0 {
+		return p.updateJobs(ctx, *jobs)
 	}
 
-	msg := append(toMessage(jobs.Queued), toMessage(jobs.Completed)...)
 	nErr := p.messenger.PublishJobs(ctx, msg)
-	if nErr != nil {
+	e, ok := messenger.AsPublishError(nErr)
+	if nErr != nil && !ok {
+		p.releaseJobs(ctx, token, jobs.Queued)
 		return nErr
 	}
 
-	return p.updateJobs(ctx, *jobs)
+	failed := make([]uint64, 0)
+	if ok {
+		failed = e.JobIDs()
+		p.logger.Error("failed to publish jobs",
+			zap.String("host", opt.Host),
+			zap.Uint64s("failed", failed),
+			zap.Error(nErr),
+		)
+
+		p.metrics.Put(
+			metrics.Dimensions{hostDimension: opt.Host},
+			metrics.Metric{Name: "FailedJobs", Value: float64(len(failed)), Unit: metrics.Count},
+		)
+	}
+
+	p.metrics.Put(
+		metrics.Dimensions{hostDimension: opt.Host},
+		metrics.Metric{Name: "PublishedJobs", Value: float64(len(msg) - len(failed)), Unit: metrics.Count},
+	)
+
+	// only the delivered jobs are updated, the failed queued jobs are released for the next run.
+	delivered := splitFailedJobs(jobs, failed)
+	p.releaseJobs(ctx, token, jobs.Queued)
+	if uErr := p.updateJobs(ctx, *delivered); uErr != nil {
+		return uErr
+	}
+
+	return nErr
+}
+
+// splitFailedJobs returns the jobs whose messages were delivered, and keeps the failed ones in jobs.
+func splitFailedJobs(jobs *Jobs, failed []uint64) *Jobs {
+	delivered := &Jobs{InProgress: jobs.InProgress, Cancelled: jobs.Cancelled}
+	split := func(list []storage.Job) (ok, ko []storage.Job) {
+		ok, ko = make([]storage.Job, 0), make([]storage.Job, 0)
+		for _, j := range list {
+			if inUint64Slice(j.ID, failed) {
+				ko = append(ko, j)
+				continue
+			}
+
+			ok = append(ok, j)
+		}
+
+		return ok, ko
+	}
+
+	delivered.Queued, jobs.Queued = split(jobs.Queued)
+	delivered.Completed, jobs.Completed = split(jobs.Completed)
+	delivered.Stale, jobs.Stale = split(jobs.Stale)
+
+	return delivered
 }
 
-func (p *publisher) getJobs(ctx context.Context, opt HostOption) (*Jobs, error) {
-	completed, err := p.storage.GetJobs(ctx, &storage.GetJobsInput{
+// getJobs publishes only as many queued jobs as the host has free slots. Runners of completed jobs
+// are running until their termination is delivered, so free = limit - in_progress - completed, where
+// both are counted up to runningJobsLimit. Free is negative when the host runs more jobs than its
+// limit, e.g. the limit was lowered, and no queued jobs are published until enough of them finish.
+func (p *publisher) getJobs(ctx context.Context, opt HostOption, withQueued bool) (*Jobs, error) {
+	completed, err := p.queryJobs(ctx, &storage.GetJobsInput{
 		Host:     opt.Host,
 		Statuses: []string{completedStatus},
-		Limit:    opt.Limit,
+		OS:       opt.OS,
+		Labels:   opt.Labels,
+		Limit:    runningJobsLimit,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	jobs, err := p.storage.GetJobs(ctx, &storage.GetJobsInput{
+	inProgress, err := p.queryJobs(ctx, &storage.GetJobsInput{
 		Host:     opt.Host,
-		Statuses: []string{queuedStatus, inProgressStatus},
-		Limit:    opt.Limit + int32(len(completed)),
+		Statuses: []string{inProgressStatus},
+		OS:       opt.OS,
+		Labels:   opt.Labels,
+		Limit:    runningJobsLimit,
 	})
 
 	if err != nil {
 		return nil, err
 	}
 
-	queued := make([]storage.Job, 0)
-	inProgress := make([]storage.Job, 0)
+	// runners of stale jobs hold their slots until the termination is delivered, like completed jobs,
+	// cancelled jobs never had a runner.
+	completed, cancelled := splitCancelledJobs(completed)
+	free := opt.Limit - int32(len(inProgress)) - int32(len(completed))
+	inProgress, stale := p.splitStaleJobs(inProgress)
+	p.logger.Info("computed free slots",
+		zap.String("host", opt.Host),
+		zap.String("os", opt.OS),
+		zap.Int32("limit", opt.Limit),
+		zap.Int("in_progress", len(inProgress)),
+		zap.Int("completed", len(completed)),
+		zap.Int32("free", free),
+	)
 
-	for i := range jobs {
-		tmp := jobs[i]
-		if tmp.Status == queuedStatus {
-			queued = append(queued, tmp)
-			continue
+	queued := make([]storage.Job, 0)
+	if free > 0 && withQueued {
+		queued, err = p.getQueuedJobs(ctx, opt, inProgress, free)
+		if err != nil {
+			return nil, err
 		}
 
-		if tmp.Status == inProgressStatus {
-			inProgress = append(inProgress, tmp)
-		}
+		queued = p.scheduler.Schedule(queued, inProgress, free)
 	}
 
 	return &Jobs{
 		Queued:     queued,
 		InProgress: inProgress,
 		Completed:  completed,
+		Stale:      stale,
+		Cancelled:  cancelled,
 	}, nil
 }
 
+// splitCancelledJobs splits the completed jobs the producer completed while they were queued, e.g. the
+// workflow was cancelled before they were claimed. Jobs completed without the recorded status keep
+// their runners terminated, a runner which doesn't exist is skipped by the orchestrator.
+func splitCancelledJobs(jobs []storage.Job) (completed, cancelled []storage.Job) {
+	completed, cancelled = make([]storage.Job, 0), make([]storage.Job, 0)
+	for _, j := range jobs {
+		if j.CompletedFrom == queuedStatus {
+			cancelled = append(cancelled, j)
+			continue
+		}
+
+		completed = append(completed, j)
+	}
+
+	return completed, cancelled
+}
+
+// splitStaleJobs splits the in-progress jobs whose status was last updated by the publisher before
+// the stale threshold.
+func (p *publisher) splitStaleJobs(jobs []storage.Job) (inProgress, stale []storage.Job) {
+	inProgress, stale = make([]storage.Job, 0), make([]storage.Job, 0)
+	if p.staleJobs.Threshold <= 0 {
+		return jobs, stale
+	}
+
+	deadline := p.now().Add(-p.staleJobs.Threshold).UnixMilli()
+	for _, j := range jobs {
+		if j.UpdatedAt > 0 && j.UpdatedAt < deadline {
+			stale = append(stale, j)
+			continue
+		}
+
+		inProgress = append(inProgress, j)
+	}
+
+	return inProgress, stale
+}
+
+// getQueuedJobs reads the queued jobs window by window, until the scheduler is satisfied, the index is
+// exhausted or maxWindows windows are read, so a repository with many queued jobs doesn't hide the
+// other repositories behind it.
+func (p *publisher) getQueuedJobs(
+	ctx context.Context,
+	opt HostOption,
+	inProgress []storage.Job,
+	free int32,
+) ([]storage.Job, error) {
+	window := p.scheduler.Window(free)
+	queued := make([]storage.Job, 0)
+	var after *storage.Job
+
+	for i := 0; i < maxWindows; i++ {
+		jobs, err := p.queryJobs(ctx, &storage.GetJobsInput{
+			Host:     opt.Host,
+			Statuses: []string{queuedStatus},
+			OS:       opt.OS,
+			Labels:   opt.Labels,
+			Limit:    window,
+			After:    after,
+		})
+
+		if err != nil {
+			return nil, err
+		}
+
+		queued = append(queued, jobs...)
+		if int32(len(jobs)) < window || p.scheduler.Satisfied(queued, inProgress, free) {
+			break
+		}
+
+		after = &queued[len(queued)-1]
+	}
+
+	return queued, nil
+}
+
+// queryJobs keeps processing the healthy jobs of a host when some of its items are corrupt, the
+// storage quarantines the corrupt items.
+func (p *publisher) queryJobs(ctx context.Context, input *storage.GetJobsInput) ([]storage.Job, error) {
+	jobs, err := p.storage.GetJobs(ctx, input)
+	e, ok := storage.AsCorruptJobsError(err)
+	if !ok {
+		return jobs, err
+	}
+
+	ids, types := make([]uint64, 0), make([]string, 0)
+	for _, j := range e.Jobs {
+		ids = append(ids, j.ID)
+		types = append(types, j.Type)
+	}
+
+	fields := []zap.Field{
+		zap.String("host", input.Host),
+		zap.Uint64s("corrupt", ids),
+		zap.Strings("types", types),
+	}
+	if e.QuarantineErr != nil {
+		fields = append(fields, zap.Error(e.QuarantineErr))
+	}
+
+	p.logger.Warn("skipped corrupt jobs", fields...)
+	p.metrics.Put(
+		metrics.Dimensions{hostDimension: input.Host},
+		metrics.Metric{Name: "CorruptJobs", Value: float64(len(e.Jobs)), Unit: metrics.Count},
+	)
+
+	return jobs, nil
+}
+
+// claimJobs moves the queued jobs to in_progress before they are published, so concurrent
+// invocations never publish the same job. Jobs claimed by another invocation are dropped.
+func (p *publisher) claimJobs(ctx context.Context, jobs *Jobs) (string, error) {
+	if len(jobs.Queued) == 0 {
+		return "", nil
+	}
+
+	token, err := newClaimToken()
+	if err != nil {
+		return "", err
+	}
+
+	claimed, err := p.storage.ClaimJobs(ctx, &storage.ClaimJobsInput{
+		IDs:   getJobIDs(jobs.Queued),
+		Token: token,
+	})
+
+	if err != nil {
+		// jobs claimed before the error are released, so they are not held until they become stale.
+		p.releaseJobs(ctx, token, jobs.Queued)
+		return "", err
+	}
+
+	queued, skipped := make([]storage.Job, 0), make([]uint64, 0)
+	for _, j := range jobs.Queued {
+		if inUint64Slice(j.ID, claimed) {
+			queued = append(queued, j)
+			continue
+		}
+
+		skipped = append(skipped, j.ID)
+	}
+
+	if len(skipped) != 0 {
+		p.logger.Info("skipped jobs claimed by another invocation", zap.Uint64s("skipped", skipped))
+	}
+
+	jobs.Queued = queued
+	return token, nil
+}
+
+// releaseJobs moves the claimed jobs back to queued when they couldn't be published.
+func (p *publisher) releaseJobs(ctx context.Context, token string, jobs []storage.Job) {
+	if len(jobs) == 0 {
+		return
+	}
+
+	if err := p.storage.ReleaseJobs(ctx, &storage.ReleaseJobsInput{
+		IDs:   getJobIDs(jobs),
+		Token: token,
+	}); err != nil {
+		p.logger.Error("failed to release claimed jobs",
+			zap.Uint64s("jobs", getJobIDs(jobs)),
+			zap.Error(err),
+		)
+	}
+}
+
+// updateJobs deletes completed and cancelled jobs, and requeues or expires stale jobs, queued jobs
+// have been moved to in_progress when they were claimed.
 func (p *publisher) updateJobs(ctx context.Context, jobs Jobs) error {
 	u := make([]storage.UpdateJob, 0)
-	for _, i := range jobs.Queued {
+	d := make([]uint64, 0)
+	for _, i := range append(jobs.Completed, jobs.Cancelled...) {
+		d = append(d, i.ID)
+	}
+
+	for _, i := range jobs.Stale {
+		if p.staleJobs.Action == ExpireStaleJobs {
+			d = append(d, i.ID)
+			continue
+		}
+
+		// the job is left alone if it was completed or claimed again since it was read.
 		u = append(u, storage.UpdateJob{
 			ID:     i.ID,
-			Status: inProgressStatus,
+			Status: queuedStatus,
+			If:     &storage.UpdateCondition{Status: inProgressStatus, UpdatedAt: i.UpdatedAt},
 		})
 	}
 
-	d := make([]uint64, 0)
-	for _, i := range jobs.Completed {
-		d = append(d, i.ID)
+	if len(u) == 0 && len(d) == 0 {
+		return nil
 	}
 
 	return p.storage.UpdateJobs(ctx, &storage.UpdateJobsInput{
@@ -159,11 +592,55 @@ func (p *publisher) updateJobs(ctx context.Context, jobs Jobs) error {
 	})
 }
 
+func (p *publisher) recordJobs(host string, jobs *Jobs) {
+	p.metrics.Put(metrics.Dimensions{hostDimension: host}, getJobMetrics(jobs.Queued, jobs.InProgress, jobs.Completed)...)
+
+	byOS := make(map[string]*Jobs)
+	for status, list := range map[string][]storage.Job{
+		queuedStatus:     jobs.Queued,
+		inProgressStatus: jobs.InProgress,
+		completedStatus:  jobs.Completed,
+	} {
+		for i := range list {
+			j, ok := byOS[list[i].OS]
+			if !ok {
+				j = new(Jobs)
+				byOS[list[i].OS] = j
+			}
+
+			switch status {
+			case queuedStatus:
+				j.Queued = append(j.Queued, list[i])
+			case inProgressStatus:
+				j.InProgress = append(j.InProgress, list[i])
+			default:
+				j.Completed = append(j.Completed, list[i])
+			}
+		}
+	}
+
+	for os, j := range byOS {
+		p.metrics.Put(
+			metrics.Dimensions{hostDimension: host, osDimension: os},
+			getJobMetrics(j.Queued, j.InProgress, j.Completed)...,
+		)
+	}
+}
+
+func getJobMetrics(queued, inProgress, completed []storage.Job) []metrics.Metric {
+	return []metrics.Metric{
+		{Name: "QueuedJobs", Value: float64(len(queued)), Unit: metrics.Count},
+		{Name: "InProgressJobs", Value: float64(len(inProgress)), Unit: metrics.Count},
+		{Name: "CompletedJobs", Value: float64(len(completed)), Unit: metrics.Count},
+	}
+}
+
 func toMessage(jobs []storage.Job) []messenger.Message {
 	res := make([]messenger.Message, 0)
 	for _, i := range jobs {
 		b, _ := json.Marshal(i.Content)
 		res = append(res, messenger.Message{
+			JobID:  i.ID,
 			Host:   i.Host,
 			OS:     i.OS,
 			Status: i.Status,
@@ -174,6 +651,35 @@ func toMessage(jobs []storage.Job) []messenger.Message {
 	return res
 }
 
+// toTerminateMessage publishes stale jobs as completed, so the orchestrator terminates their runners.
+func toTerminateMessage(jobs []storage.Job) []messenger.Message {
+	msg := toMessage(jobs)
+	for i := range msg {
+		msg[i].Status = completedStatus
+	}
+
+	return msg
+}
+
+func newClaimToken() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+func inUint64Slice(key uint64, s []uint64) bool {
+	for _, i := range s {
+		if key == i {
+			return true
+		}
+	}
+
+	return false
+}
+
 func getJobIDs(jobs []storage.Job) []uint64 {
 	ids := make([]uint64, 0)
 	for _, i := range jobs {
@@ -188,11 +694,22 @@ func New(
 	m messenger.Messenger,
 	opts []HostOption,
 	logger *zap.Logger,
+	options ...Option,
 ) Publisher {
-	return &publisher{
+	p := &publisher{
 		hostOptions: opts,
 		storage:     s,
 		messenger:   m,
+		metrics:     metrics.NewNop(),
+		breaker:     breaker.NewNop(),
+		scheduler:   NewFIFOScheduler(),
+		now:         time.Now,
 		logger:      logger,
 	}
+
+	for _, o := range options {
+		o(p)
+	}
+
+	return p
 }
@@ -2,13 +2,22 @@ package publisher
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"sync"
 	"testing"
+	"time"
 
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/breaker"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
 	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/metrics"
 	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zaptest/observer"
 )
@@ -29,20 +38,39 @@ func TestPublisher_Publish(t *testing.T) {
 				{Host: "eks", Limit: 2},
 			},
 			expectedLogs: []map[string]interface{}{
-				{"msg": "retrieving jobs", "host": "ec2", "limit": int32(2)},
+				{"msg": "retrieving jobs", "host": "ec2", "os": "", "labels": []interface{}{}, "limit": int32(2)},
+				{"msg": "computed free slots", "host": "ec2", "os": "", "limit": int32(2), "in_progress": int64(1), "completed": int64(0), "free": int32(1)},
 				{"msg": "processing jobs", "queued": []interface{}{uint64(1)}, "in_progress": []interface{}{uint64(2)}, "completed": []interface{}{}},
 				{"msg": "notify publisher"},
-				{"msg": "retrieving jobs", "host": "eks", "limit": int32(2)},
+				{"msg": "retrieving jobs", "host": "eks", "os": "", "labels": []interface{}{}, "limit": int32(2)},
+				{"msg": "computed free slots", "host": "eks", "os": "", "limit": int32(2), "in_progress": int64(0), "completed": int64(1), "free": int32(1)},
 				{"msg": "processing jobs", "queued": []interface{}{uint64(4)}, "in_progress": []interface{}{}, "completed": []interface{}{uint64(5)}},
 				{"msg": "notify publisher"},
 			},
 		},
-		"not jobs found": {
+		"zero limit drains the host": {
 			opt: []HostOption{
 				{Host: "ec2", Limit: 0},
+				{Host: "eks", Limit: 0},
+			},
+			expectedLogs: []map[string]interface{}{
+				{"msg": "retrieving jobs", "host": "ec2", "os": "", "labels": []interface{}{}, "limit": int32(0)},
+				{"msg": "computed free slots", "host": "ec2", "os": "", "limit": int32(0), "in_progress": int64(1), "completed": int64(0), "free": int32(-1)},
+				{"msg": "processing jobs", "queued": []interface{}{}, "in_progress": []interface{}{uint64(2)}, "completed": []interface{}{}},
+				{"msg": "notify publisher"},
+				{"msg": "retrieving jobs", "host": "eks", "os": "", "labels": []interface{}{}, "limit": int32(0)},
+				{"msg": "computed free slots", "host": "eks", "os": "", "limit": int32(0), "in_progress": int64(0), "completed": int64(1), "free": int32(-1)},
+				{"msg": "processing jobs", "queued": []interface{}{}, "in_progress": []interface{}{}, "completed": []interface{}{uint64(5)}},
+				{"msg": "notify publisher"},
+			},
+		},
+		"not jobs found": {
+			opt: []HostOption{
+				{Host: "gce", Limit: 2},
 			},
 			expectedLogs: []map[string]interface{}{
-				{"msg": "retrieving jobs", "host": "ec2", "limit": int32(0)},
+				{"msg": "retrieving jobs", "host": "gce", "os": "", "labels": []interface{}{}, "limit": int32(2)},
+				{"msg": "computed free slots", "host": "gce", "os": "", "limit": int32(2), "in_progress": int64(0), "completed": int64(0), "free": int32(2)},
 				{"msg": "processing jobs", "queued": []interface{}{}, "in_progress": []interface{}{}, "completed": []interface{}{}},
 			},
 		},
@@ -101,11 +129,634 @@ func TestPublisher_Publish(t *testing.T) {
 				lm["msg"] = i.Message
 				l = append(l, lm)
 			}
-			a.ElementsMatch(tc.expectedLogs, l)
+			a.ElementsMatch(append([]map[string]interface{}{{"msg": "using concurrency limits", "limits": tc.opt}}, tc.expectedLogs...), l)
+		})
+	}
+}
+
+func TestPublisher_PublishMetrics(t *testing.T) {
+	a := assert.New(t)
+	s := &mockedStorage{
+		jobs: map[string][]storage.Job{
+			"ec2": {
+				{ID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus},
+				{ID: 2, Host: "ec2", OS: "windows", Status: inProgressStatus},
+				{ID: 3, Host: "ec2", OS: "ubuntu", Status: completedStatus, ClaimToken: "token"},
+			},
+		},
+	}
+	r := new(mockedRecorder)
+
+	err := New(s, new(mockedMessenger), []HostOption{{Host: "ec2", Limit: 3}}, zap.NewNop(), WithMetrics(r)).
+		Publish(context.TODO())
+
+	a.Nil(err)
+	a.ElementsMatch([]recordedMetrics{
+		{
+			dimensions: metrics.Dimensions{"Host": "ec2"},
+			metrics:    getTestJobMetrics(1, 1, 1),
+		},
+		{
+			dimensions: metrics.Dimensions{"Host": "ec2", "OS": "ubuntu"},
+			metrics:    getTestJobMetrics(1, 0, 1),
+		},
+		{
+			dimensions: metrics.Dimensions{"Host": "ec2", "OS": "windows"},
+			metrics:    getTestJobMetrics(0, 1, 0),
+		},
+		{
+			dimensions: metrics.Dimensions{"Host": "ec2"},
+			metrics:    []metrics.Metric{{Name: "PublishedJobs", Value: 2, Unit: metrics.Count}},
+		},
+	}, r.puts)
+}
+
+func TestPublisher_PublishFreeSlots(t *testing.T) {
+	cases := map[string]struct {
+		limit              int32
+		inProgress         int
+		completed          int
+		expectedPublished  []uint64
+		expectedGetJobsNum int
+	}{
+		"publish queued jobs up to free slots": {
+			limit:              3,
+			inProgress:         1,
+			expectedPublished:  []uint64{2, 3},
+			expectedGetJobsNum: 3,
+		},
+		"no free slots": {
+			limit:              2,
+			inProgress:         2,
+			expectedGetJobsNum: 2,
+		},
+		"in-progress jobs over the limit": {
+			limit:              1,
+			inProgress:         2,
+			expectedGetJobsNum: 2,
+		},
+		"runners of completed jobs hold slots": {
+			limit:              3,
+			inProgress:         1,
+			completed:          1,
+			expectedPublished:  []uint64{2},
+			expectedGetJobsNum: 3,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			jobs := make([]storage.Job, 0)
+			for i := 0; i < tc.inProgress; i++ {
+				jobs = append(jobs, storage.Job{ID: uint64(100 + i), Host: "ec2", Status: inProgressStatus})
+			}
+			for i := 0; i < tc.completed; i++ {
+				jobs = append(jobs, storage.Job{
+					ID:         uint64(200 + i),
+					Host:       "ec2",
+					Status:     completedStatus,
+					ClaimToken: "token",
+					Content:    storage.JobContent{ID: uint64(200 + i)},
+				})
+			}
+			for i := uint64(1); i <= 3; i++ {
+				jobs = append(jobs, storage.Job{ID: i + 1, Host: "ec2", Status: queuedStatus, Content: storage.JobContent{ID: i + 1}})
+			}
+
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": jobs}}
+			m := new(mockedMessenger)
+
+			a.Nil(New(s, m, []HostOption{{Host: "ec2", Limit: tc.limit}}, zap.NewNop()).Publish(context.TODO()))
+			a.Equal(tc.expectedGetJobsNum, s.getJobsNum)
+
+			ids := make([]uint64, 0)
+			for _, i := range m.messages {
+				job := new(storage.JobContent)
+				a.Nil(json.Unmarshal([]byte(i.Body), job))
+				if i.Status == queuedStatus {
+					ids = append(ids, job.ID)
+				}
+			}
+			a.ElementsMatch(tc.expectedPublished, ids)
+		})
+	}
+}
+
+func TestPublisher_PublishQueuedWindows(t *testing.T) {
+	cases := map[string]struct {
+		scheduler          Scheduler
+		queued             []storage.Job
+		expectedClaimed    []uint64
+		expectedGetJobsNum int
+	}{
+		"read past a repository filling the window": {
+			scheduler: NewFairShareScheduler(&FairShareConfig{WindowFactor: 1}),
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a"), getRepoJob(4, "a"), getRepoJob(5, "b"),
+			},
+			expectedClaimed:    []uint64{1, 5},
+			expectedGetJobsNum: 5,
+		},
+		"stop once every slot has a repository": {
+			scheduler: NewFairShareScheduler(&FairShareConfig{WindowFactor: 1}),
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "b"), getRepoJob(3, "a"), getRepoJob(4, "c"),
+			},
+			expectedClaimed:    []uint64{1, 2},
+			expectedGetJobsNum: 3,
+		},
+		"fifo reads a single window": {
+			scheduler: NewFIFOScheduler(),
+			queued: []storage.Job{
+				getRepoJob(1, "a"), getRepoJob(2, "a"), getRepoJob(3, "a"), getRepoJob(4, "a"), getRepoJob(5, "b"),
+			},
+			expectedClaimed:    []uint64{1, 2},
+			expectedGetJobsNum: 3,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": tc.queued}}
+
+			err := New(s, new(mockedMessenger), []HostOption{{Host: "ec2", Limit: 2}}, zap.NewNop(), WithScheduler(tc.scheduler)).
+				Publish(context.TODO())
+
+			a.Nil(err)
+			a.Equal(tc.expectedClaimed, s.claimed)
+			a.Equal(tc.expectedGetJobsNum, s.getJobsNum)
+		})
+	}
+}
+
+func TestPublisher_PublishPerOS(t *testing.T) {
+	cases := map[string]struct {
+		opt               []HostOption
+		expectedPublished []uint64
+	}{
+		"limits per os": {
+			opt: []HostOption{
+				{Host: "ec2", OS: "ubuntu", Limit: 2},
+				{Host: "ec2", OS: "windows", Limit: 2},
+			},
+			expectedPublished: []uint64{1, 2, 11},
+		},
+		"limits per os and labels": {
+			opt: []HostOption{
+				{Host: "ec2", OS: "ubuntu", Limit: 3},
+				{Host: "ec2", OS: "windows", Labels: []string{"gpu"}, Limit: 1},
+			},
+			expectedPublished: []uint64{1, 2, 3, 12},
+		},
+		"no free slots for os": {
+			opt: []HostOption{
+				{Host: "ec2", OS: "windows", Limit: 1},
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": {
+				{ID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 1}},
+				{ID: 2, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 2}},
+				{ID: 3, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 3}},
+				{ID: 10, Host: "ec2", OS: "windows", Status: inProgressStatus, Content: storage.JobContent{ID: 10}},
+				{ID: 11, Host: "ec2", OS: "windows", Status: queuedStatus, Content: storage.JobContent{ID: 11}},
+				{ID: 12, Host: "ec2", OS: "windows", Status: queuedStatus, Content: storage.JobContent{
+					ID:     12,
+					Labels: []string{"windows", "gpu"},
+				}},
+			}}}
+			m := new(mockedMessenger)
+
+			a.Nil(New(s, m, tc.opt, zap.NewNop()).Publish(context.TODO()))
+
+			ids := make([]uint64, 0)
+			for _, i := range m.messages {
+				job := new(storage.JobContent)
+				a.Nil(json.Unmarshal([]byte(i.Body), job))
+				ids = append(ids, job.ID)
+			}
+			a.ElementsMatch(tc.expectedPublished, ids)
+		})
+	}
+}
+
+func TestPublisher_PublishWithLimitSource(t *testing.T) {
+	defaults := []HostOption{{Host: "ec2", Limit: 1}}
+	cases := map[string]struct {
+		limits            []HostOption
+		limitsErr         error
+		expectedPublished []uint64
+		expectedLogs      []string
+	}{
+		"use limits of the source": {
+			limits:            []HostOption{{Host: "ec2", Limit: 3}},
+			expectedPublished: []uint64{1, 3},
+			expectedLogs:      []string{"using concurrency limits"},
+		},
+		"fall back to defaults on error": {
+			limitsErr:         errors.New("some error"),
+			expectedPublished: []uint64{},
+			expectedLogs:      []string{"failed to get concurrency limits, using defaults", "using concurrency limits"},
+		},
+		"fall back to defaults without limits": {
+			limits:            []HostOption{},
+			expectedPublished: []uint64{},
+			expectedLogs:      []string{"no concurrency limits configured, using defaults", "using concurrency limits"},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			m := new(mockedMessenger)
+			core, logs := observer.New(zap.InfoLevel)
+
+			err := New(
+				&mockedStorage{jobs: getTestJobs()},
+				m,
+				defaults,
+				zap.New(core),
+				WithLimitSource(&mockedLimitSource{opts: tc.limits, err: tc.limitsErr}),
+			).Publish(context.TODO())
+
+			a.Nil(err)
+
+			ids := make([]uint64, 0)
+			for _, i := range m.messages {
+				job := new(storage.JobContent)
+				a.Nil(json.Unmarshal([]byte(i.Body), job))
+				if i.Status == queuedStatus {
+					ids = append(ids, job.ID)
+				}
+			}
+			a.ElementsMatch(tc.expectedPublished, ids)
+
+			l := make([]string, 0)
+			for _, i := range logs.FilterMessageSnippet("concurrency limits").All() {
+				l = append(l, i.Message)
+			}
+			a.Equal(tc.expectedLogs, l)
+		})
+	}
+}
+
+func TestPublisher_PublishStaleJobs(t *testing.T) {
+	now := time.Unix(1640995200, 0)
+	cases := map[string]struct {
+		config            StaleJobsConfig
+		expectedMessages  []messenger.Message
+		expectedUpdate    *storage.UpdateJobsInput
+		expectedStaleLogs int
+	}{
+		"requeue stale jobs": {
+			config: StaleJobsConfig{Threshold: time.Hour, Action: RequeueStaleJobs},
+			expectedMessages: []messenger.Message{
+				{JobID: 1, Host: "ec2", OS: "ubuntu", Status: completedStatus, Body: `{"ID":1,"Owner":"","Repository":"","Labels":null}`},
+			},
+			expectedUpdate: &storage.UpdateJobsInput{
+				Update: []storage.UpdateJob{{
+					ID:     1,
+					Status: queuedStatus,
+					If:     &storage.UpdateCondition{Status: inProgressStatus, UpdatedAt: now.Add(-2 * time.Hour).UnixMilli()},
+				}},
+				Delete: []uint64{},
+			},
+			expectedStaleLogs: 1,
+		},
+		"expire stale jobs": {
+			config: StaleJobsConfig{Threshold: time.Hour, Action: ExpireStaleJobs},
+			expectedMessages: []messenger.Message{
+				{JobID: 1, Host: "ec2", OS: "ubuntu", Status: completedStatus, Body: `{"ID":1,"Owner":"","Repository":"","Labels":null}`},
+			},
+			expectedUpdate: &storage.UpdateJobsInput{
+				Update: []storage.UpdateJob{},
+				Delete: []uint64{1},
+			},
+			expectedStaleLogs: 1,
+		},
+		"stale job detection disabled": {},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": {
+				{
+					ID:        1,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    inProgressStatus,
+					UpdatedAt: now.Add(-2 * time.Hour).UnixMilli(),
+					Content:   storage.JobContent{ID: 1},
+				},
+				{
+					ID:        2,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    inProgressStatus,
+					UpdatedAt: now.Add(-30 * time.Minute).UnixMilli(),
+					Content:   storage.JobContent{ID: 2},
+				},
+				{ID: 3, Host: "ec2", OS: "ubuntu", Status: inProgressStatus, Content: storage.JobContent{ID: 3}},
+				{ID: 4, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 4}},
+			}}}
+			m := new(mockedMessenger)
+			core, logs := observer.New(zap.InfoLevel)
+			svc := New(s, m, []HostOption{{Host: "ec2", Limit: 3}}, zap.New(core), WithStaleJobs(tc.config))
+			svc.(*publisher).now = func() time.Time { return now }
+
+			a.Nil(svc.Publish(context.TODO()))
+			a.Equal(tc.expectedMessages, m.messages)
+			a.Equal(tc.expectedUpdate, s.updateJobsInput)
+			a.Equal(tc.expectedStaleLogs, logs.FilterMessage("terminating runners of stale jobs").Len())
+		})
+	}
+}
+
+func TestPublisher_PublishCorruptJobs(t *testing.T) {
+	cases := map[string]struct {
+		err            *storage.CorruptJobsError
+		expectedFields map[string]interface{}
+	}{
+		"skip quarantined jobs": {
+			err: &storage.CorruptJobsError{Jobs: []storage.CorruptJob{{ID: 10, Type: storage.InvalidGZIPType}}},
+			expectedFields: map[string]interface{}{
+				"host":    "ec2",
+				"corrupt": []interface{}{uint64(10)},
+				"types":   []interface{}{storage.InvalidGZIPType},
+			},
+		},
+		"skip jobs failed to quarantine": {
+			err: &storage.CorruptJobsError{
+				Jobs:          []storage.CorruptJob{{ID: 10, Type: storage.InvalidJSONType}},
+				QuarantineErr: errors.New("some error"),
+			},
+			expectedFields: map[string]interface{}{
+				"host":    "ec2",
+				"corrupt": []interface{}{uint64(10)},
+				"types":   []interface{}{storage.InvalidJSONType},
+				"error":   "some error",
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := &mockedStorage{jobs: getTestJobs(), getJobsErr: tc.err}
+			m := new(mockedMessenger)
+			core, logs := observer.New(zap.WarnLevel)
+
+			err := New(s, m, []HostOption{{Host: "ec2", Limit: 3}}, zap.New(core)).Publish(context.TODO())
+
+			a.Nil(err)
+			a.Len(m.messages, 2)
+			a.Equal([]uint64{1, 3}, s.claimed)
+
+			skipped := logs.FilterMessage("skipped corrupt jobs").All()
+			a.Len(skipped, 3)
+			a.Equal(tc.expectedFields, skipped[0].ContextMap())
 		})
 	}
 }
 
+func TestPublisher_PublishClaims(t *testing.T) {
+	cases := map[string]struct {
+		claimedByOthers   []uint64
+		claimJobsErr      error
+		publishJobsErr    error
+		expectedPublished []uint64
+		expectedReleased  []uint64
+		err               error
+	}{
+		"publish claimed jobs": {
+			expectedPublished: []uint64{1, 3},
+		},
+		"skip jobs claimed by another invocation": {
+			claimedByOthers:   []uint64{1},
+			expectedPublished: []uint64{3},
+		},
+		"release claims when publish failed": {
+			publishJobsErr:   errors.New("failed to send jobs"),
+			expectedReleased: []uint64{1, 3},
+			err:              errors.New("failed to send jobs"),
+		},
+		"release claims when claim failed": {
+			claimJobsErr:     errors.New("failed to claim jobs"),
+			expectedReleased: []uint64{1, 3},
+			err:              errors.New("failed to claim jobs"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := &mockedStorage{jobs: getTestJobs(), claimedByOthers: tc.claimedByOthers, claimJobsErr: tc.claimJobsErr}
+			m := &mockedMessenger{publishJobsErr: tc.publishJobsErr}
+
+			err := New(s, m, []HostOption{{Host: "ec2", Limit: 3}}, zap.NewNop()).Publish(context.TODO())
+
+			a.Equal(tc.err, err)
+			a.Equal(tc.expectedReleased, s.released)
+
+			if tc.err != nil {
+				return
+			}
+
+			ids := make([]uint64, 0)
+			for _, i := range m.messages {
+				job := new(storage.JobContent)
+				a.Nil(json.Unmarshal([]byte(i.Body), job))
+				ids = append(ids, job.ID)
+			}
+			a.Equal(tc.expectedPublished, ids)
+		})
+	}
+}
+
+func TestPublisher_PublishCancelledJobs(t *testing.T) {
+	cases := map[string]struct {
+		jobs              []storage.Job
+		expectedMessages  []messenger.Message
+		expectedUpdate    *storage.UpdateJobsInput
+		expectedFree      int32
+		expectedCancelled []interface{}
+	}{
+		"delete cancelled jobs without publishing them": {
+			jobs: []storage.Job{
+				{ID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 1}},
+				{ID: 2, Host: "ec2", OS: "ubuntu", Status: completedStatus, CompletedFrom: queuedStatus, Content: storage.JobContent{ID: 2}},
+				{ID: 3, Host: "ec2", OS: "ubuntu", Status: completedStatus, ClaimToken: "token", Content: storage.JobContent{ID: 3}},
+			},
+			expectedMessages: []messenger.Message{
+				{JobID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Body: `{"ID":1,"Owner":"","Repository":"","Labels":null}`},
+				{JobID: 3, Host: "ec2", OS: "ubuntu", Status: completedStatus, Body: `{"ID":3,"Owner":"","Repository":"","Labels":null}`},
+			},
+			expectedUpdate:    &storage.UpdateJobsInput{Update: []storage.UpdateJob{}, Delete: []uint64{3, 2}},
+			expectedFree:      1,
+			expectedCancelled: []interface{}{uint64(2)},
+		},
+		"only cancelled jobs": {
+			jobs: []storage.Job{
+				{ID: 2, Host: "ec2", OS: "ubuntu", Status: completedStatus, CompletedFrom: queuedStatus, Content: storage.JobContent{ID: 2}},
+			},
+			expectedUpdate:    &storage.UpdateJobsInput{Update: []storage.UpdateJob{}, Delete: []uint64{2}},
+			expectedFree:      2,
+			expectedCancelled: []interface{}{uint64(2)},
+		},
+		"terminate jobs completed without the recorded status": {
+			jobs: []storage.Job{
+				{ID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 1}},
+				{ID: 2, Host: "ec2", OS: "ubuntu", Status: completedStatus, Content: storage.JobContent{ID: 2}},
+			},
+			expectedMessages: []messenger.Message{
+				{JobID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Body: `{"ID":1,"Owner":"","Repository":"","Labels":null}`},
+				{JobID: 2, Host: "ec2", OS: "ubuntu", Status: completedStatus, Body: `{"ID":2,"Owner":"","Repository":"","Labels":null}`},
+			},
+			expectedUpdate: &storage.UpdateJobsInput{Update: []storage.UpdateJob{}, Delete: []uint64{2}},
+			expectedFree:   1,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			core, logs := observer.New(zap.InfoLevel)
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": tc.jobs}}
+			m := new(mockedMessenger)
+
+			a.Nil(New(s, m, []HostOption{{Host: "ec2", Limit: 2}}, zap.New(core)).Publish(context.TODO()))
+
+			a.Equal(tc.expectedMessages, m.messages)
+			a.Equal(tc.expectedUpdate, s.updateJobsInput)
+			a.Equal(tc.expectedFree, logs.FilterMessage("computed free slots").All()[0].ContextMap()["free"])
+
+			cancelled := logs.FilterMessage("deleting jobs cancelled before they were claimed").All()
+			if tc.expectedCancelled == nil {
+				a.Empty(cancelled)
+				return
+			}
+
+			a.Equal(tc.expectedCancelled, cancelled[0].ContextMap()["cancelled"])
+		})
+	}
+}
+
+func TestPublisher_PublishWithBreaker(t *testing.T) {
+	cases := map[string]struct {
+		state            breaker.State
+		breakerErr       error
+		completed        bool
+		expectedMessages []uint64
+		expectedClaimed  []uint64
+		expectedUpdate   *storage.UpdateJobsInput
+		expectedLogs     []string
+	}{
+		"publish jobs to closed host": {
+			state:            breaker.Closed,
+			expectedMessages: []uint64{1, 3},
+			expectedClaimed:  []uint64{1, 3},
+			expectedLogs:     []string{"retrieving jobs", "computed free slots", "processing jobs", "notify publisher"},
+		},
+		"hold back queued jobs of open host": {
+			state:            breaker.Open,
+			completed:        true,
+			expectedMessages: []uint64{5},
+			expectedUpdate:   &storage.UpdateJobsInput{Update: []storage.UpdateJob{}, Delete: []uint64{5}},
+			expectedLogs:     []string{"circuit breaker is open, skipping queued jobs", "retrieving jobs", "computed free slots", "processing jobs", "notify publisher"},
+		},
+		"probe half-open host with one job": {
+			state:            breaker.HalfOpen,
+			expectedMessages: []uint64{1},
+			expectedClaimed:  []uint64{1},
+			expectedLogs:     []string{"circuit breaker is half-open, probing host", "retrieving jobs", "computed free slots", "processing jobs", "notify publisher"},
+		},
+		"publish jobs when breaker state is unavailable": {
+			state:            breaker.Closed,
+			breakerErr:       errors.New("some error"),
+			expectedMessages: []uint64{1, 3},
+			expectedClaimed:  []uint64{1, 3},
+			expectedLogs:     []string{"failed to get circuit breaker state", "retrieving jobs", "computed free slots", "processing jobs", "notify publisher"},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			jobs := getTestJobs()
+			if tc.completed {
+				jobs["ec2"] = append(jobs["ec2"], storage.Job{
+					ID:         5,
+					Host:       "ec2",
+					Status:     completedStatus,
+					ClaimToken: "token",
+					Content:    storage.JobContent{ID: 5, Owner: "owner_5", Repository: "repo_5"},
+				})
+			}
+
+			s := &mockedStorage{jobs: jobs}
+			m := new(mockedMessenger)
+			b := &mockedBreaker{state: tc.state, err: tc.breakerErr}
+			core, logs := observer.New(zap.DebugLevel)
+
+			err := New(s, m, []HostOption{{Host: "ec2", Limit: 3}}, zap.New(core), WithBreaker(b)).
+				Publish(context.TODO())
+
+			a.Nil(err)
+			a.Equal("ec2", b.runnerType)
+			a.Equal(tc.expectedClaimed, s.claimed)
+			a.Equal(tc.expectedUpdate, s.updateJobsInput)
+
+			ids := make([]uint64, 0)
+			for _, i := range m.messages {
+				job := new(storage.JobContent)
+				a.Nil(json.Unmarshal([]byte(i.Body), job))
+				ids = append(ids, job.ID)
+			}
+			a.ElementsMatch(tc.expectedMessages, ids)
+
+			l := make([]string, 0)
+			for _, i := range logs.All() {
+				l = append(l, i.Message)
+			}
+			a.Equal(append([]string{"using concurrency limits"}, tc.expectedLogs...), l)
+		})
+	}
+}
+
+func TestPublisher_PublishSpans(t *testing.T) {
+	a := assert.New(t)
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	defer otel.SetTracerProvider(trace.NewNoopTracerProvider())
+
+	err := New(&mockedStorage{jobs: getTestJobs()}, new(mockedMessenger), []HostOption{{Host: "ec2", Limit: 2}}, zap.NewNop()).
+		Publish(context.TODO())
+
+	a.Nil(err)
+
+	spans := recorder.Ended()
+	a.Len(spans, 2)
+	a.Equal("publisher.process", spans[0].Name())
+	a.Contains(spans[0].Attributes(), attribute.String("host", "ec2"))
+	a.Equal("publisher.Publish", spans[1].Name())
+	a.Equal(spans[1].SpanContext().SpanID(), spans[0].Parent().SpanID())
+}
+
+func getTestJobMetrics(queued, inProgress, completed float64) []metrics.Metric {
+	return []metrics.Metric{
+		{Name: "QueuedJobs", Value: queued, Unit: metrics.Count},
+		{Name: "InProgressJobs", Value: inProgress, Unit: metrics.Count},
+		{Name: "CompletedJobs", Value: completed, Unit: metrics.Count},
+	}
+}
+
 func getTestJobs() map[string][]storage.Job {
 	return map[string][]storage.Job{
 		"ec2": {
@@ -156,9 +807,10 @@ func getTestJobs() map[string][]storage.Job {
 				},
 			},
 			{
-				ID:     5,
-				Host:   "eks",
-				Status: completedStatus,
+				ID:         5,
+				Host:       "eks",
+				Status:     completedStatus,
+				ClaimToken: "token",
 				Content: storage.JobContent{
 					ID:         5,
 					Owner:      "owner_5",
@@ -170,20 +822,101 @@ func getTestJobs() map[string][]storage.Job {
 	}
 }
 
+func TestPublisher_PublishPartialFailure(t *testing.T) {
+	jobs := []storage.Job{
+		{ID: 1, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 1}},
+		{ID: 2, Host: "ec2", OS: "ubuntu", Status: queuedStatus, Content: storage.JobContent{ID: 2}},
+		{ID: 3, Host: "ec2", OS: "ubuntu", Status: completedStatus, ClaimToken: "token", Content: storage.JobContent{ID: 3}},
+		{ID: 4, Host: "ec2", OS: "ubuntu", Status: completedStatus, ClaimToken: "token", Content: storage.JobContent{ID: 4}},
+	}
+
+	cases := map[string]struct {
+		failed           []uint64
+		expectedReleased []uint64
+		expectedUpdate   *storage.UpdateJobsInput
+	}{
+		"update delivered jobs and release failed jobs": {
+			failed:           []uint64{2, 4},
+			expectedReleased: []uint64{2},
+			expectedUpdate:   &storage.UpdateJobsInput{Update: []storage.UpdateJob{}, Delete: []uint64{3}},
+		},
+		"all jobs failed": {
+			failed:           []uint64{1, 2, 3, 4},
+			expectedReleased: []uint64{1, 2},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			core, logs := observer.New(zap.ErrorLevel)
+			failed := make([]messenger.Message, 0)
+			for _, id := range tc.failed {
+				failed = append(failed, messenger.Message{JobID: id})
+			}
+
+			publishErr := &messenger.PublishError{Failed: failed}
+			s := &mockedStorage{jobs: map[string][]storage.Job{"ec2": jobs}}
+			m := &mockedMessenger{publishJobsErr: publishErr}
+
+			err := New(s, m, []HostOption{{Host: "ec2", Limit: 4}}, zap.New(core)).Publish(context.TODO())
+
+			a.Equal(publishErr, err)
+			a.Len(m.messages, 4)
+			a.Equal(tc.expectedReleased, s.released)
+			a.Equal(tc.expectedUpdate, s.updateJobsInput)
+
+			failedLogs := logs.FilterMessage("failed to publish jobs").All()
+			a.Len(failedLogs, 1)
+			a.Equal(toInterfaces(tc.failed), failedLogs[0].ContextMap()["failed"])
+		})
+	}
+}
+
+func toInterfaces(ids []uint64) []interface{} {
+	res := make([]interface{}, 0)
+	for _, id := range ids {
+		res = append(res, id)
+	}
+
+	return res
+}
+
 type mockedStorage struct {
 	sync.RWMutex
 	updateJobsInput *storage.UpdateJobsInput
+	getJobsNum      int
 	jobs            map[string][]storage.Job
 	getJobsErr      error
 	updateJobsErr   error
+	claimed         []uint64
+	claimedByOthers []uint64
+	claimJobsErr    error
+	released        []uint64
 }
 
 func (m *mockedStorage) GetJobs(_ context.Context, input *storage.GetJobsInput) ([]storage.Job, error) {
+	m.Lock()
+	m.getJobsNum++
+	m.Unlock()
+
 	jobs := m.jobs[input.Host]
+	if input.After != nil {
+		for i := range jobs {
+			if jobs[i].ID == input.After.ID {
+				jobs = jobs[i+1:]
+				break
+			}
+		}
+	}
 
 	res := make([]storage.Job, 0)
-	for i, v := range jobs {
-		if inSlice(v.Status, input.Statuses) && int32(i) < input.Limit {
+	for _, v := range jobs {
+		if !inSlice(v.Status, input.Statuses) || (input.OS != "" && v.OS != input.OS) {
+			continue
+		}
+
+		if (&PriorityRule{Labels: input.Labels}).match(&v) && int32(len(res)) < input.Limit {
 			res = append(res, v)
 		}
 	}
@@ -199,6 +932,29 @@ func (m *mockedStorage) UpdateJobs(_ context.Context, input *storage.UpdateJobsI
 	return m.updateJobsErr
 }
 
+func (m *mockedStorage) ClaimJobs(_ context.Context, input *storage.ClaimJobsInput) ([]uint64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	claimed := make([]uint64, 0)
+	for _, id := range input.IDs {
+		if !inUint64Slice(id, m.claimedByOthers) {
+			claimed = append(claimed, id)
+		}
+	}
+
+	m.claimed = append(m.claimed, claimed...)
+	return claimed, m.claimJobsErr
+}
+
+func (m *mockedStorage) ReleaseJobs(_ context.Context, input *storage.ReleaseJobsInput) error {
+	m.Lock()
+	defer m.Unlock()
+
+	m.released = append(m.released, input.IDs...)
+	return nil
+}
+
 type mockedMessenger struct {
 	sync.RWMutex
 	messages           []messenger.Message
@@ -218,12 +974,39 @@ func (m *mockedMessenger) NotifyPublisher(_ context.Context) error {
 	return m.notifyPublisherErr
 }
 
-func inSlice(key string, s []string) bool {
-	for _, i := range s {
-		if key == i {
-			return true
-		}
-	}
+type mockedLimitSource struct {
+	opts []HostOption
+	err  error
+}
+
+func (m *mockedLimitSource) HostOptions(context.Context) ([]HostOption, error) {
+	return m.opts, m.err
+}
+
+type mockedBreaker struct {
+	runnerType string
+	state      breaker.State
+	err        error
+}
+
+func (m *mockedBreaker) State(_ context.Context, runnerType string) (breaker.State, error) {
+	m.runnerType = runnerType
+	return m.state, m.err
+}
+
+type recordedMetrics struct {
+	dimensions metrics.Dimensions
+	metrics    []metrics.Metric
+}
+
+type mockedRecorder struct {
+	sync.Mutex
+	puts []recordedMetrics
+}
+
+func (m *mockedRecorder) Put(dimensions metrics.Dimensions, metrics ...metrics.Metric) {
+	m.Lock()
+	defer m.Unlock()
 
-	return false
+	m.puts = append(m.puts, recordedMetrics{dimensions: dimensions, metrics: metrics})
 }
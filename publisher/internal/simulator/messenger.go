@@ -0,0 +1,233 @@
+package simulator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
+)
+
+const (
+	hostAttribute   = "Host"
+	osAttribute     = "OS"
+	statusAttribute = "Status"
+	queueSize       = 1024
+)
+
+// FilterPolicy mirrors an SNS subscription filter policy, each attribute has an allow list
+// and a message is routed only when all attributes in the policy match.
+type FilterPolicy map[string][]string
+
+func (p FilterPolicy) Match(m messenger.Message) bool {
+	attributes := map[string]string{
+		hostAttribute:   m.Host,
+		osAttribute:     m.OS,
+		statusAttribute: m.Status,
+	}
+
+	for k, v := range p {
+		if !inSlice(attributes[k], v) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func inSlice(key string, s []string) bool {
+	for _, i := range s {
+		if key == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+type Handler func(ctx context.Context, body string) error
+
+// Subscription mirrors an SQS queue subscribed to the jobs topic with a Lambda consumer.
+type Subscription struct {
+	Name    string
+	Policy  FilterPolicy
+	Handler Handler
+}
+
+type queue struct {
+	Subscription
+	messages chan messenger.Message
+}
+
+// Messenger is a channel backed messenger.Messenger which routes published jobs to
+// subscriptions by their filter policy.
+type Messenger struct {
+	mu       sync.RWMutex
+	queues   []*queue
+	notified int
+	unrouted []messenger.Message
+	dropped  []messenger.Message
+
+	// Drop simulates lost events, messages it returns true for are never delivered.
+	Drop func(m messenger.Message) bool
+}
+
+// PublishJobs never blocks on a full queue, the messages which did not fit are returned in a
+// *messenger.PublishError, the same as the entries SNS fails to publish. Like SNS fan-out, a message
+// is delivered to all its subscriptions or to none of them.
+func (m *Messenger) PublishJobs(ctx context.Context, messages []messenger.Message) error {
+	failed := make([]messenger.Message, 0)
+	var qErr error
+	for _, msg := range messages {
+		if err := m.route(ctx, msg); err != nil {
+			if qErr == nil {
+				qErr = err
+			}
+
+			failed = append(failed, msg)
+		}
+	}
+
+	if len(failed) != 0 {
+		return &messenger.PublishError{Failed: failed, Err: qErr}
+	}
+
+	return nil
+}
+
+// route puts the message on every matching queue once all of them have room for it.
+func (m *Messenger) route(ctx context.Context, msg messenger.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.Drop != nil && m.Drop(msg) {
+		m.dropped = append(m.dropped, msg)
+		return nil
+	}
+
+	matched := make([]*queue, 0)
+	for _, q := range m.queues {
+		if q.Policy.Match(msg) {
+			matched = append(matched, q)
+		}
+	}
+
+	if len(matched) == 0 {
+		m.unrouted = append(m.unrouted, msg)
+		return nil
+	}
+
+	for _, q := range matched {
+		if len(q.messages) == cap(q.messages) {
+			return fmt.Errorf("queue %v is full", q.Name)
+		}
+	}
+
+	for _, q := range matched {
+		if err := q.put(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (m *Messenger) NotifyPublisher(_ context.Context) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.notified++
+	return nil
+}
+
+// Deliver drains every subscription queue and invokes its handler, messages whose handler
+// failed are put back on the queue, the same as SQS redelivery.
+func (m *Messenger) Deliver(ctx context.Context) (int, error) {
+	delivered := 0
+	for _, q := range m.queues {
+		failed := make([]messenger.Message, 0)
+		for drained := false; !drained; {
+			select {
+			case <-ctx.Done():
+				return delivered, ctx.Err()
+			case msg := <-q.messages:
+				if err := q.Handler(ctx, msg.Body); err != nil {
+					failed = append(failed, msg)
+					continue
+				}
+
+				delivered++
+			default:
+				drained = true
+			}
+		}
+
+		if err := m.requeue(ctx, q, failed); err != nil {
+			return delivered, err
+		}
+	}
+
+	return delivered, nil
+}
+
+func (m *Messenger) requeue(ctx context.Context, q *queue, messages []messenger.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, msg := range messages {
+		if err := q.put(ctx, msg); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (q *queue) put(ctx context.Context, msg messenger.Message) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case q.messages <- msg:
+		return nil
+	default:
+		return fmt.Errorf("queue %v is full", q.Name)
+	}
+}
+
+// Notified returns the number of publisher notifications since the last call.
+func (m *Messenger) Notified() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n := m.notified
+	m.notified = 0
+	return n
+}
+
+// Unrouted returns messages which did not match any subscription.
+func (m *Messenger) Unrouted() []messenger.Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]messenger.Message{}, m.unrouted...)
+}
+
+// Dropped returns messages which were lost by Drop.
+func (m *Messenger) Dropped() []messenger.Message {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]messenger.Message{}, m.dropped...)
+}
+
+func NewMessenger(subscriptions []Subscription) *Messenger {
+	queues := make([]*queue, 0)
+	for _, s := range subscriptions {
+		queues = append(queues, &queue{
+			Subscription: s,
+			messages:     make(chan messenger.Message, queueSize),
+		})
+	}
+
+	return &Messenger{queues: queues}
+}
@@ -0,0 +1,111 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFilterPolicy_Match(t *testing.T) {
+	msg := messenger.Message{Host: "ec2", OS: "ubuntu", Status: "queued"}
+	cases := map[string]struct {
+		policy   FilterPolicy
+		expected bool
+	}{
+		"all attributes match": {
+			policy: FilterPolicy{
+				hostAttribute:   {"ec2"},
+				osAttribute:     {"ubuntu"},
+				statusAttribute: {"queued"},
+			},
+			expected: true,
+		},
+		"attribute in allow list": {
+			policy:   FilterPolicy{osAttribute: {"windows", "ubuntu"}},
+			expected: true,
+		},
+		"attribute not in allow list": {
+			policy: FilterPolicy{
+				hostAttribute:   {"ec2"},
+				statusAttribute: {"completed"},
+			},
+		},
+		"empty policy": {
+			policy:   FilterPolicy{},
+			expected: true,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.expected, tc.policy.Match(msg))
+		})
+	}
+}
+
+func TestMessenger_PublishJobs(t *testing.T) {
+	messages := []messenger.Message{{JobID: 1, Host: "ec2"}, {JobID: 2, Host: "ec2"}}
+	cases := map[string]struct {
+		size     int
+		expected int
+		err      error
+	}{
+		"route messages": {
+			size:     2,
+			expected: 2,
+		},
+		"queue is full": {
+			size:     1,
+			expected: 1,
+			err:      &messenger.PublishError{Failed: messages[1:], Err: errors.New("queue ec2 is full")},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			m := NewMessenger([]Subscription{{Name: "ec2", Policy: FilterPolicy{hostAttribute: {"ec2"}}}})
+			m.queues[0].messages = make(chan messenger.Message, tc.size)
+
+			a.Equal(tc.err, m.PublishJobs(context.TODO(), messages))
+			a.Len(m.queues[0].messages, tc.expected)
+		})
+	}
+}
+
+func TestMessenger_PublishJobsFanOut(t *testing.T) {
+	a := assert.New(t)
+	m := NewMessenger([]Subscription{
+		{Name: "ec2", Policy: FilterPolicy{hostAttribute: {"ec2"}}},
+		{Name: "ubuntu", Policy: FilterPolicy{osAttribute: {"ubuntu"}}},
+	})
+	m.queues[1].messages = make(chan messenger.Message, 1)
+	messages := []messenger.Message{{JobID: 1, Host: "ec2", OS: "ubuntu"}, {JobID: 2, Host: "ec2", OS: "ubuntu"}}
+
+	a.Equal(
+		&messenger.PublishError{Failed: messages[1:], Err: errors.New("queue ubuntu is full")},
+		m.PublishJobs(context.TODO(), messages),
+	)
+	a.Len(m.queues[0].messages, 1)
+	a.Len(m.queues[1].messages, 1)
+}
+
+func TestMessenger_Deliver(t *testing.T) {
+	a := assert.New(t)
+	m := NewMessenger([]Subscription{{
+		Name:    "ec2",
+		Handler: func(context.Context, string) error { return errors.New("failed to handle") },
+	}})
+	m.queues[0].messages = make(chan messenger.Message, 1)
+
+	a.Nil(m.PublishJobs(context.TODO(), []messenger.Message{{JobID: 1}}))
+	n, err := m.Deliver(context.TODO())
+
+	a.Nil(err)
+	a.Equal(0, n)
+	a.Len(m.queues[0].messages, 1)
+}
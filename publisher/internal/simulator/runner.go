@@ -0,0 +1,135 @@
+package simulator
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+)
+
+// Launcher and Terminator mirror the orchestrator runner interfaces.
+type Launcher interface {
+	Launch(ctx context.Context, job *storage.JobContent) error
+}
+
+type Terminator interface {
+	Terminate(ctx context.Context, id uint64) error
+}
+
+func LauncherHandler(l Launcher) Handler {
+	return func(ctx context.Context, body string) error {
+		job := new(storage.JobContent)
+		if err := json.Unmarshal([]byte(body), job); err != nil {
+			return err
+		}
+
+		return l.Launch(ctx, job)
+	}
+}
+
+func TerminatorHandler(t Terminator) Handler {
+	return func(ctx context.Context, body string) error {
+		job := new(storage.JobContent)
+		if err := json.Unmarshal([]byte(body), job); err != nil {
+			return err
+		}
+
+		return t.Terminate(ctx, job.ID)
+	}
+}
+
+// Runners is a fake runner backend implementing both Launcher and Terminator. Like the
+// orchestrator handlers, launching an existing runner or terminating a missing one is not an error.
+type Runners struct {
+	mu         sync.RWMutex
+	running    map[uint64]struct{}
+	launched   []uint64
+	terminated []uint64
+	maxRunning int
+
+	// LaunchErr and TerminateErr inject backend failures.
+	LaunchErr    func(id uint64) error
+	TerminateErr func(id uint64) error
+}
+
+func (r *Runners) Launch(_ context.Context, job *storage.JobContent) error {
+	if r.LaunchErr != nil {
+		if err := r.LaunchErr(job.ID); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.running[job.ID]; ok {
+		return nil
+	}
+
+	r.running[job.ID] = struct{}{}
+	r.launched = append(r.launched, job.ID)
+	if len(r.running) > r.maxRunning {
+		r.maxRunning = len(r.running)
+	}
+
+	return nil
+}
+
+func (r *Runners) Terminate(_ context.Context, id uint64) error {
+	if r.TerminateErr != nil {
+		if err := r.TerminateErr(id); err != nil {
+			return err
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, ok := r.running[id]; !ok {
+		return nil
+	}
+
+	delete(r.running, id)
+	r.terminated = append(r.terminated, id)
+	return nil
+}
+
+// Running returns IDs of runners which are currently running.
+func (r *Runners) Running() []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	ids := make([]uint64, 0)
+	for id := range r.running {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+func (r *Runners) Launched() []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]uint64{}, r.launched...)
+}
+
+func (r *Runners) Terminated() []uint64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return append([]uint64{}, r.terminated...)
+}
+
+// MaxRunning returns the highest number of runners running at the same time.
+func (r *Runners) MaxRunning() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return r.maxRunning
+}
+
+func NewRunners() *Runners {
+	return &Runners{running: make(map[uint64]struct{})}
+}
@@ -0,0 +1,101 @@
+package simulator
+
+import (
+	"context"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"go.uber.org/zap"
+)
+
+// Simulator wires the publisher with in-memory storage, a channel backed messenger and fake
+// runner backends, so the publisher -> SNS -> SQS -> orchestrator flow can be scripted in tests.
+type Simulator struct {
+	Storage   *Storage
+	Messenger *Messenger
+	Publisher publisher.Publisher
+}
+
+type StepResult struct {
+	Delivered int
+	Notified  bool
+}
+
+// Step runs the publisher once and delivers every published message to its subscribers.
+func (s *Simulator) Step(ctx context.Context) (*StepResult, error) {
+	if err := s.Publisher.Publish(ctx); err != nil {
+		return nil, err
+	}
+
+	n, err := s.Messenger.Deliver(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &StepResult{
+		Delivered: n,
+		Notified:  s.Messenger.Notified() != 0,
+	}, nil
+}
+
+// Queue simulates workflow_job.queued webhooks.
+func (s *Simulator) Queue(jobs ...storage.Job) {
+	s.Storage.Put(jobs...)
+}
+
+// Complete simulates workflow_job.completed webhooks.
+func (s *Simulator) Complete(ids ...uint64) error {
+	for _, id := range ids {
+		if err := s.Storage.SetJobCompleted(id); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Subscriptions returns the launcher and terminator subscriptions the orchestrator stack
+// creates for a host, a launcher per OS and one terminator for the host.
+func Subscriptions(host string, runners *Runners, oses ...string) []Subscription {
+	subscriptions := make([]Subscription, 0)
+	for _, os := range oses {
+		subscriptions = append(subscriptions, Subscription{
+			Name: host + "-" + os + "-launcher",
+			Policy: FilterPolicy{
+				hostAttribute:   {host},
+				statusAttribute: {queuedStatus},
+				osAttribute:     {os},
+			},
+			Handler: LauncherHandler(runners),
+		})
+	}
+
+	return append(subscriptions, Subscription{
+		Name: host + "-terminator",
+		Policy: FilterPolicy{
+			hostAttribute:   {host},
+			statusAttribute: {completedStatus},
+		},
+		Handler: TerminatorHandler(runners),
+	})
+}
+
+func New(
+	opts []publisher.HostOption,
+	subscriptions []Subscription,
+	logger *zap.Logger,
+	options ...publisher.Option,
+) *Simulator {
+	if logger == nil {
+		logger = zap.NewNop()
+	}
+
+	s := NewStorage()
+	m := NewMessenger(subscriptions)
+
+	return &Simulator{
+		Storage:   s,
+		Messenger: m,
+		Publisher: publisher.New(s, m, opts, logger, options...),
+	}
+}
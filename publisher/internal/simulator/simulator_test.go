@@ -0,0 +1,263 @@
+package simulator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/messenger"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/publisher"
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+	"github.com/stretchr/testify/assert"
+)
+
+const maxSteps = 100
+
+func TestSimulator_Burst(t *testing.T) {
+	a := assert.New(t)
+	runners := NewRunners()
+	sim := New(
+		[]publisher.HostOption{{Host: "ec2", Limit: 5}},
+		Subscriptions("ec2", runners, "ubuntu"),
+		nil,
+	)
+
+	sim.Queue(getTestJobs(1, 20, "ec2", "ubuntu")...)
+
+	steps := runUntilIdle(t, sim, runners)
+
+	a.Less(steps, maxSteps)
+	a.Empty(sim.Storage.Jobs())
+	a.Empty(runners.Running())
+	a.LessOrEqual(runners.MaxRunning(), 5)
+	a.ElementsMatch(getIDs(1, 20), runners.Launched())
+	a.ElementsMatch(getIDs(1, 20), runners.Terminated())
+}
+
+func TestSimulator_LostEvents(t *testing.T) {
+	ctx := context.TODO()
+
+	t.Run("lost termination message leaks the runner", func(t *testing.T) {
+		a := assert.New(t)
+		runners := NewRunners()
+		sim := New(
+			[]publisher.HostOption{{Host: "ec2", Limit: 5}},
+			Subscriptions("ec2", runners, "ubuntu"),
+			nil,
+		)
+		sim.Messenger.Drop = func(m messenger.Message) bool {
+			return m.Status == completedStatus
+		}
+
+		sim.Queue(getTestJobs(1, 2, "ec2", "ubuntu")...)
+		runUntilIdle(t, sim, runners)
+
+		a.Empty(sim.Storage.Jobs())
+		a.ElementsMatch(getIDs(1, 2), runners.Running())
+		a.Len(sim.Messenger.Dropped(), 2)
+	})
+
+	t.Run("lost completed webhook holds the slot", func(t *testing.T) {
+		a := assert.New(t)
+		runners := NewRunners()
+		sim := New(
+			[]publisher.HostOption{{Host: "ec2", Limit: 1}},
+			Subscriptions("ec2", runners, "ubuntu"),
+			nil,
+		)
+
+		sim.Queue(getTestJobs(1, 2, "ec2", "ubuntu")...)
+		for i := 0; i < 5; i++ {
+			res, err := sim.Step(ctx)
+			a.Nil(err)
+			a.True(res.Notified)
+		}
+
+		a.Equal([]uint64{1}, runners.Launched())
+		a.Equal(
+			[]string{"in_progress", "queued"},
+			[]string{sim.Storage.Jobs()[0].Status, sim.Storage.Jobs()[1].Status},
+		)
+	})
+}
+
+func TestSimulator_Limits(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.TODO()
+	ec2Runners, eksRunners := NewRunners(), NewRunners()
+	sim := New(
+		[]publisher.HostOption{
+			{Host: "ec2", Limit: 2},
+			{Host: "eks", Limit: 0},
+		},
+		append(
+			Subscriptions("ec2", ec2Runners, "ubuntu"),
+			Subscriptions("eks", eksRunners, "ubuntu")...,
+		),
+		nil,
+	)
+
+	sim.Queue(getTestJobs(1, 3, "ec2", "ubuntu")...)
+	sim.Queue(getTestJobs(4, 5, "eks", "ubuntu")...)
+
+	res, err := sim.Step(ctx)
+
+	a.Nil(err)
+	a.Equal(2, res.Delivered)
+	a.ElementsMatch([]uint64{1, 2}, ec2Runners.Running())
+	a.Empty(eksRunners.Launched())
+}
+
+func TestSimulator_FairShare(t *testing.T) {
+	cases := map[string]struct {
+		options     []publisher.Option
+		expectedIDs []uint64
+	}{
+		"matrix job starves other repositories": {
+			expectedIDs: getIDs(1, 4),
+		},
+		"fair share serves every repository": {
+			options:     []publisher.Option{publisher.WithScheduler(publisher.NewFairShareScheduler(new(publisher.FairShareConfig)))},
+			expectedIDs: []uint64{1, 2, 201, 202},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			runners := NewRunners()
+			sim := New(
+				[]publisher.HostOption{{Host: "ec2", Limit: 4}},
+				Subscriptions("ec2", runners, "ubuntu"),
+				nil,
+				tc.options...,
+			)
+
+			matrix := getTestJobs(1, 30, "ec2", "ubuntu")
+			for i := range matrix {
+				matrix[i].Content.Owner = "owner"
+				matrix[i].Content.Repository = "matrix"
+			}
+			sim.Queue(matrix...)
+			sim.Queue(getTestJobs(201, 202, "ec2", "ubuntu")...)
+
+			_, err := sim.Step(context.TODO())
+
+			a.Nil(err)
+			a.ElementsMatch(tc.expectedIDs, runners.Launched())
+		})
+	}
+}
+
+func TestSimulator_Routing(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.TODO()
+	runners := NewRunners()
+	sim := New(
+		[]publisher.HostOption{{Host: "ec2", Limit: 5}},
+		Subscriptions("ec2", runners, "ubuntu"),
+		nil,
+	)
+
+	sim.Queue(getTestJobs(1, 1, "ec2", "ubuntu")...)
+	sim.Queue(getTestJobs(2, 2, "ec2", "windows")...)
+
+	_, err := sim.Step(ctx)
+
+	a.Nil(err)
+	a.Equal([]uint64{1}, runners.Launched())
+	a.Len(sim.Messenger.Unrouted(), 1)
+	a.Equal("windows", sim.Messenger.Unrouted()[0].OS)
+}
+
+func TestSimulator_FailedLaunchIsRedelivered(t *testing.T) {
+	a := assert.New(t)
+	ctx := context.TODO()
+	runners := NewRunners()
+	attempts := 0
+	runners.LaunchErr = func(_ uint64) error {
+		attempts++
+		if attempts < 3 {
+			return errors.New("insufficient capacity")
+		}
+
+		return nil
+	}
+	sim := New(
+		[]publisher.HostOption{{Host: "ec2", Limit: 1}},
+		Subscriptions("ec2", runners, "ubuntu"),
+		nil,
+	)
+
+	sim.Queue(getTestJobs(1, 1, "ec2", "ubuntu")...)
+	for i := 0; i < 3; i++ {
+		_, err := sim.Step(ctx)
+		a.Nil(err)
+	}
+
+	a.Equal(3, attempts)
+	a.Equal([]uint64{1}, runners.Running())
+}
+
+// runUntilIdle steps the simulator and completes every running job until the publisher stops
+// notifying itself.
+func runUntilIdle(t *testing.T, sim *Simulator, runners *Runners) int {
+	ctx := context.TODO()
+	for i := 1; i <= maxSteps; i++ {
+		res, err := sim.Step(ctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !res.Notified {
+			return i
+		}
+
+		for _, j := range sim.Storage.Jobs() {
+			if j.Status == "in_progress" && inRunning(j.ID, runners.Running()) {
+				_ = sim.Complete(j.ID)
+			}
+		}
+	}
+
+	return maxSteps
+}
+
+func inRunning(id uint64, running []uint64) bool {
+	for _, i := range running {
+		if i == id {
+			return true
+		}
+	}
+
+	return false
+}
+
+func getTestJobs(from, to uint64, host, os string) []storage.Job {
+	jobs := make([]storage.Job, 0)
+	for i := from; i <= to; i++ {
+		jobs = append(jobs, storage.Job{
+			ID:   i,
+			Host: host,
+			OS:   os,
+			Content: storage.JobContent{
+				ID:         i,
+				Owner:      fmt.Sprintf("owner_%v", i),
+				Repository: fmt.Sprintf("repo_%v", i),
+				Labels:     []string{host, os},
+			},
+		})
+	}
+
+	return jobs
+}
+
+func getIDs(from, to uint64) []uint64 {
+	ids := make([]uint64, 0)
+	for i := from; i <= to; i++ {
+		ids = append(ids, i)
+	}
+
+	return ids
+}
@@ -0,0 +1,36 @@
+package simulator
+
+import (
+	"github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage"
+)
+
+const (
+	queuedStatus    = "queued"
+	completedStatus = "completed"
+)
+
+// Storage is the in-memory storage.Storage fed the same way as the producer feeds the Jobs table.
+type Storage struct {
+	*storage.Memory
+}
+
+// Put stores queued jobs the same way as the producer, existing jobs are left untouched.
+func (s *Storage) Put(jobs ...storage.Job) {
+	for _, j := range jobs {
+		if _, ok := s.Get(j.ID); ok {
+			continue
+		}
+
+		j.Status = queuedStatus
+		s.Memory.Put(j)
+	}
+}
+
+// SetJobCompleted marks the job as completed, as the producer does on workflow_job.completed.
+func (s *Storage) SetJobCompleted(id uint64) error {
+	return s.Complete(id)
+}
+
+func NewStorage() *Storage {
+	return &Storage{Memory: storage.NewMemory()}
+}
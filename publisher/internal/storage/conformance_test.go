@@ -0,0 +1,229 @@
+package storage
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// conformanceSetup returns a Storage holding only the given jobs.
+type conformanceSetup func(t *testing.T, jobs []Job) Storage
+
+// testConformance checks the semantics every Storage implementation shares, the test jobs are
+// queued 1, 5, 7, completed 2, 4, 8 and in progress 0, 3, 6, 9.
+func testConformance(t *testing.T, setup conformanceSetup) {
+	jobs := getTestJobs(testJobsNum)
+	cases := map[string]struct {
+		run func(t *testing.T, s Storage)
+	}{
+		"get jobs in creation order": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued", "completed"},
+					Limit:    3,
+				})
+
+				a.Nil(err)
+				a.Equal([]Job{jobs[1], jobs[2], jobs[4]}, res)
+			},
+		},
+		"get jobs after a job": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				a.Equal([]uint64{5, 7, 8}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued", "completed"},
+					Limit:    3,
+					After:    &jobs[4],
+				}))
+			},
+		},
+		"get jobs of unknown host": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				a.Empty(getConformanceIDs(a, s, &GetJobsInput{Host: "eks", Statuses: []string{"queued"}, Limit: 10}))
+			},
+		},
+		"get jobs by os and labels": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				a.Equal([]uint64{1, 5, 7}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					OS:       "ubuntu",
+					Labels:   []string{"ubuntu"},
+					Limit:    10,
+				}))
+				a.Empty(getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					OS:       "windows",
+					Limit:    10,
+				}))
+				a.Empty(getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Labels:   []string{"gpu"},
+					Limit:    10,
+				}))
+			},
+		},
+		"update and delete jobs": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				a.Nil(s.UpdateJobs(context.TODO(), &UpdateJobsInput{
+					Update: []UpdateJob{{ID: 1, Status: "completed"}},
+					Delete: []uint64{2},
+				}))
+
+				res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"completed"},
+					Limit:    10,
+				})
+
+				a.Nil(err)
+				require.Len(t, res, 3)
+				a.Equal([]uint64{1, 4, 8}, getIDs(res))
+				a.Greater(res[0].UpdatedAt, int64(0))
+			},
+		},
+		"update missing job": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				a.NotNil(s.UpdateJobs(context.TODO(), &UpdateJobsInput{
+					Update: []UpdateJob{{ID: 1, Status: "completed"}, {ID: 100, Status: "completed"}},
+					Delete: []uint64{5},
+				}))
+
+				a.Equal([]uint64{1, 5, 7}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Limit:    10,
+				}))
+			},
+		},
+		"update jobs only if they match": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"in_progress"},
+					Limit:    2,
+				})
+				a.Nil(err)
+				require.Len(t, res, 2)
+
+				a.Nil(s.UpdateJobs(context.TODO(), &UpdateJobsInput{
+					Update: []UpdateJob{
+						{ID: 0, Status: "queued", If: &UpdateCondition{Status: "in_progress", UpdatedAt: res[0].UpdatedAt}},
+						{ID: 3, Status: "queued", If: &UpdateCondition{Status: "in_progress", UpdatedAt: res[1].UpdatedAt + 1}},
+						{ID: 2, Status: "queued", If: &UpdateCondition{Status: "in_progress"}},
+						{ID: 100, Status: "queued", If: &UpdateCondition{Status: "in_progress"}},
+					},
+					Delete: []uint64{4},
+				}))
+
+				a.Equal([]uint64{0, 1, 5, 7}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Limit:    10,
+				}))
+				a.Equal([]uint64{2, 8}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"completed"},
+					Limit:    10,
+				}))
+				a.Equal([]uint64{3, 6, 9}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"in_progress"},
+					Limit:    10,
+				}))
+			},
+		},
+		"claim queued jobs": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				claimed, err := s.ClaimJobs(context.TODO(), &ClaimJobsInput{IDs: []uint64{1, 2, 5, 100}, Token: "a"})
+				a.Nil(err)
+				a.Equal([]uint64{1, 5}, claimed)
+
+				claimed, err = s.ClaimJobs(context.TODO(), &ClaimJobsInput{IDs: []uint64{1, 7}, Token: "b"})
+				a.Nil(err)
+				a.Equal([]uint64{7}, claimed)
+
+				a.Empty(getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Limit:    10,
+				}))
+
+				res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"in_progress"},
+					Limit:    10,
+				})
+				a.Nil(err)
+
+				tokens := make(map[uint64]string)
+				for _, j := range res {
+					tokens[j.ID] = j.ClaimToken
+				}
+				a.Equal(map[uint64]string{0: "", 1: "a", 3: "", 5: "a", 6: "", 7: "b", 9: ""}, tokens)
+			},
+		},
+		"release claimed jobs": {
+			run: func(t *testing.T, s Storage) {
+				a := assert.New(t)
+				_, err := s.ClaimJobs(context.TODO(), &ClaimJobsInput{IDs: []uint64{1, 5}, Token: "a"})
+				a.Nil(err)
+
+				a.Nil(s.ReleaseJobs(context.TODO(), &ReleaseJobsInput{IDs: []uint64{1, 3}, Token: "b"}))
+				a.Equal([]uint64{7}, getConformanceIDs(a, s, &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Limit:    10,
+				}))
+
+				a.Nil(s.ReleaseJobs(context.TODO(), &ReleaseJobsInput{IDs: []uint64{1, 5}, Token: "a"}))
+
+				res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+					Host:     "ec2",
+					Statuses: []string{"queued"},
+					Limit:    10,
+				})
+				a.Nil(err)
+				a.Equal([]uint64{1, 5, 7}, getIDs(res))
+				for _, j := range res {
+					a.Empty(j.ClaimToken)
+				}
+			},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			tc.run(t, setup(t, getTestJobs(testJobsNum)))
+		})
+	}
+}
+
+func getConformanceIDs(a *assert.Assertions, s Storage, input *GetJobsInput) []uint64 {
+	res, err := s.GetJobs(context.TODO(), input)
+	a.Nil(err)
+
+	return getIDs(res)
+}
+
+func getIDs(jobs []Job) []uint64 {
+	ids := make([]uint64, 0)
+	for _, j := range jobs {
+		ids = append(ids, j.ID)
+	}
+
+	return ids
+}
@@ -5,6 +5,9 @@ import (
 	"fmt"
 )
 
+// ErrJobNotFound fails an update of a job which doesn't exist, no job of the update is changed.
+var ErrJobNotFound = errors.New("job not found")
+
 type InvalidJobContentError struct {
 	Type string
 	Err  error
@@ -18,3 +21,32 @@ func IsInvalidJobContentError(err error) bool {
 	var e *InvalidJobContentError
 	return errors.As(err, &e)
 }
+
+type CorruptJob struct {
+	ID   uint64
+	Type string
+}
+
+// CorruptJobsError reports the items GetJobs skipped and quarantined because their content can't be
+// decoded, the healthy jobs are returned along with it.
+type CorruptJobsError struct {
+	Jobs []CorruptJob
+	// QuarantineErr is set when the corrupt items couldn't be quarantined, they are skipped again by
+	// the next call.
+	QuarantineErr error
+}
+
+func (e *CorruptJobsError) Error() string {
+	msg := fmt.Sprintf(`%v corrupt jobs`, len(e.Jobs))
+	if e.QuarantineErr != nil {
+		msg += fmt.Sprintf(`, failed to quarantine: %v`, e.QuarantineErr.Error())
+	}
+
+	return msg
+}
+
+func AsCorruptJobsError(err error) (*CorruptJobsError, bool) {
+	var e *CorruptJobsError
+	ok := errors.As(err, &e)
+	return e, ok
+}
@@ -2,6 +2,7 @@ package storage
 
 import (
 	"errors"
+	"fmt"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -41,3 +42,41 @@ func TestIsInvalidJobContentError(t *testing.T) {
 		})
 	}
 }
+
+func TestCorruptJobsError_Error(t *testing.T) {
+	cases := map[string]struct {
+		err      *CorruptJobsError
+		expected string
+	}{
+		"corrupt jobs": {
+			err:      &CorruptJobsError{Jobs: []CorruptJob{{ID: 1, Type: InvalidGZIPType}}},
+			expected: "1 corrupt jobs",
+		},
+		"failed to quarantine": {
+			err: &CorruptJobsError{
+				Jobs:          []CorruptJob{{ID: 1, Type: InvalidGZIPType}, {ID: 2, Type: InvalidJSONType}},
+				QuarantineErr: errors.New("new error"),
+			},
+			expected: "2 corrupt jobs, failed to quarantine: new error",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			a.Equal(tc.expected, tc.err.Error())
+		})
+	}
+}
+
+func TestAsCorruptJobsError(t *testing.T) {
+	a := assert.New(t)
+	err := &CorruptJobsError{Jobs: []CorruptJob{{ID: 1, Type: InvalidGZIPType}}}
+
+	e, ok := AsCorruptJobsError(fmt.Errorf("wrapped: %w", err))
+	a.True(ok)
+	a.Equal(err, e)
+
+	_, ok = AsCorruptJobsError(errors.New("new error"))
+	a.False(ok)
+}
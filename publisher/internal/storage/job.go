@@ -22,11 +22,23 @@ type JobContent struct {
 }
 
 type Job struct {
-	ID      uint64
-	Host    string
-	OS      string
-	Status  string
-	Content JobContent
+	ID     uint64
+	Host   string
+	OS     string
+	Status string
+	// CreatedAt is when the producer stored the job, in milliseconds since the Unix epoch.
+	CreatedAt int64
+	// UpdatedAt is when the publisher last changed the status, in milliseconds since the Unix epoch,
+	// 0 if the status is set by the producer.
+	UpdatedAt int64
+	// ClaimToken is the token of the publish run which claimed the job, empty if the job was never
+	// claimed or was released.
+	ClaimToken string
+	// CompletedFrom is the status the producer completed the job from, queued if the workflow was
+	// cancelled before the job was claimed, empty if the job isn't completed or was completed before
+	// the producer recorded it.
+	CompletedFrom string
+	Content       JobContent
 }
 
 func (j *Job) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
@@ -36,29 +48,47 @@ func (j *Job) UnmarshalDynamoDBAttributeValue(av types.AttributeValue) error {
 	}
 
 	raw := new(struct {
-		ID      uint64
-		Host    string
-		OS      string
-		Status  string
-		Content []byte
+		ID            uint64
+		Host          string
+		OS            string
+		Status        string
+		CreatedAt     int64
+		UpdatedAt     int64
+		ClaimToken    string
+		CompletedFrom string
+		Content       []byte
 	})
 
 	_ = attributevalue.UnmarshalMap(m.Value, raw)
 
-	var content JobContent
-	r, zErr := gzip.NewReader(bytes.NewReader(raw.Content))
-	if zErr != nil {
-		return &InvalidJobContentError{Type: InvalidGZIPType, Err: zErr}
-	}
-
-	if err := json.NewDecoder(r).Decode(&content); err != nil {
-		return &InvalidJobContentError{Type: InvalidJSONType, Err: err}
+	content, err := decodeContent(raw.Content)
+	if err != nil {
+		return err
 	}
 
 	j.ID = raw.ID
 	j.Host = raw.Host
 	j.OS = raw.OS
 	j.Status = raw.Status
+	j.CreatedAt = raw.CreatedAt
+	j.UpdatedAt = raw.UpdatedAt
+	j.ClaimToken = raw.ClaimToken
+	j.CompletedFrom = raw.CompletedFrom
 	j.Content = content
 	return nil
 }
+
+// decodeContent decodes the gzip compressed JSON content the producer stores.
+func decodeContent(b []byte) (JobContent, error) {
+	var content JobContent
+	r, zErr := gzip.NewReader(bytes.NewReader(b))
+	if zErr != nil {
+		return content, &InvalidJobContentError{Type: InvalidGZIPType, Err: zErr}
+	}
+
+	if err := json.NewDecoder(r).Decode(&content); err != nil {
+		return content, &InvalidJobContentError{Type: InvalidJSONType, Err: err}
+	}
+
+	return content, nil
+}
@@ -32,10 +32,13 @@ func TestJob_UnmarshalDynamoDBAttributeValue(t *testing.T) {
 				}),
 			),
 			expected: &Job{
-				ID:     id,
-				Host:   host,
-				OS:     os,
-				Status: status,
+				ID:            id,
+				Host:          host,
+				OS:            os,
+				Status:        status,
+				CreatedAt:     testCreatedAt,
+				UpdatedAt:     testUpdatedAt,
+				CompletedFrom: "queued",
 				Content: JobContent{
 					ID:         id,
 					Owner:      "owner",
@@ -73,11 +76,14 @@ func TestJob_UnmarshalDynamoDBAttributeValue(t *testing.T) {
 				getCompressedStr(`{}`),
 			),
 			expected: &Job{
-				ID:      id,
-				Host:    host,
-				OS:      os,
-				Status:  status,
-				Content: JobContent{},
+				ID:            id,
+				Host:          host,
+				OS:            os,
+				Status:        status,
+				CreatedAt:     testCreatedAt,
+				UpdatedAt:     testUpdatedAt,
+				CompletedFrom: "queued",
+				Content:       JobContent{},
 			},
 		},
 		"invalid item": {
@@ -113,17 +119,23 @@ func getDynamoDBItem(
 	content []byte,
 ) types.AttributeValue {
 	av, _ := attributevalue.MarshalMap(struct {
-		ID      uint64
-		Host    string
-		OS      string
-		Status  string
-		Content []byte
+		ID            uint64
+		Host          string
+		OS            string
+		Status        string
+		CreatedAt     int64
+		UpdatedAt     int64
+		CompletedFrom string
+		Content       []byte
 	}{
-		ID:      id,
-		Host:    host,
-		OS:      os,
-		Status:  status,
-		Content: content,
+		ID:            id,
+		Host:          host,
+		OS:            os,
+		Status:        status,
+		CreatedAt:     testCreatedAt,
+		UpdatedAt:     testUpdatedAt,
+		CompletedFrom: "queued",
+		Content:       content,
 	})
 
 	return &types.AttributeValueMemberM{Value: av}
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+type memoryItem struct {
+	job Job
+	seq int64
+}
+
+// Memory is an in-memory Storage with the semantics of the Jobs table, the jobs of a host are
+// returned in creation order, the same order as the host index.
+type Memory struct {
+	sync.RWMutex
+	seq  int64
+	jobs map[uint64]*memoryItem
+	now  func() time.Time
+}
+
+func (m *Memory) GetJobs(_ context.Context, input *GetJobsInput) ([]Job, error) {
+	m.RLock()
+	defer m.RUnlock()
+
+	jobs := make([]Job, 0)
+	for _, i := range m.sorted() {
+		if int32(len(jobs)) >= input.Limit {
+			break
+		}
+
+		if input.After != nil && !m.isAfter(i, input.After) {
+			continue
+		}
+
+		j := &i.job
+		if j.Host != input.Host || !inSlice(j.Status, input.Statuses) || (input.OS != "" && j.OS != input.OS) {
+			continue
+		}
+
+		if hasLabels(j, input.Labels) {
+			jobs = append(jobs, *j)
+		}
+	}
+
+	return jobs, nil
+}
+
+// UpdateJobs applies the update in one transaction, it fails without changes if a job to update
+// doesn't exist, except for the conditional updates which skip the jobs that don't match.
+func (m *Memory) UpdateJobs(_ context.Context, input *UpdateJobsInput) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, u := range input.Update {
+		if _, ok := m.jobs[u.ID]; !ok && u.If == nil {
+			return fmt.Errorf("%w: %v", ErrJobNotFound, u.ID)
+		}
+	}
+
+	now := m.now().UnixMilli()
+	for _, u := range input.Update {
+		i, ok := m.jobs[u.ID]
+		if u.If != nil && (!ok || i.job.Status != u.If.Status || i.job.UpdatedAt != u.If.UpdatedAt) {
+			continue
+		}
+
+		m.jobs[u.ID].job.Status = u.Status
+		m.jobs[u.ID].job.UpdatedAt = now
+	}
+
+	for _, id := range input.Delete {
+		delete(m.jobs, id)
+	}
+
+	return nil
+}
+
+func (m *Memory) ClaimJobs(_ context.Context, input *ClaimJobsInput) ([]uint64, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	claimed := make([]uint64, 0)
+	for _, id := range input.IDs {
+		i, ok := m.jobs[id]
+		if !ok || i.job.Status != queuedStatus {
+			continue
+		}
+
+		i.job.Status = inProgressStatus
+		i.job.UpdatedAt = m.now().UnixMilli()
+		i.job.ClaimToken = input.Token
+		claimed = append(claimed, id)
+	}
+
+	return claimed, nil
+}
+
+func (m *Memory) ReleaseJobs(_ context.Context, input *ReleaseJobsInput) error {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, id := range input.IDs {
+		i, ok := m.jobs[id]
+		if !ok || i.job.Status != inProgressStatus || i.job.ClaimToken != input.Token {
+			continue
+		}
+
+		i.job.Status = queuedStatus
+		i.job.UpdatedAt = m.now().UnixMilli()
+		i.job.ClaimToken = ""
+	}
+
+	return nil
+}
+
+// Put stores the jobs as the producer does, a stored job is replaced and keeps its position.
+func (m *Memory) Put(jobs ...Job) {
+	m.Lock()
+	defer m.Unlock()
+
+	for _, j := range jobs {
+		if i, ok := m.jobs[j.ID]; ok {
+			i.job = j
+			i.job.ClaimToken = ""
+			continue
+		}
+
+		m.seq++
+		m.jobs[j.ID] = &memoryItem{job: j, seq: m.seq}
+	}
+}
+
+// Complete completes the job as the producer does, recording the status it was first completed from.
+func (m *Memory) Complete(id uint64) error {
+	m.Lock()
+	defer m.Unlock()
+
+	i, ok := m.jobs[id]
+	if !ok {
+		return fmt.Errorf("%w: %v", ErrJobNotFound, id)
+	}
+
+	if i.job.CompletedFrom == "" {
+		i.job.CompletedFrom = i.job.Status
+	}
+
+	i.job.Status = completedStatus
+	i.job.UpdatedAt = m.now().UnixMilli()
+
+	return nil
+}
+
+// Get returns the stored job.
+func (m *Memory) Get(id uint64) (Job, bool) {
+	m.RLock()
+	defer m.RUnlock()
+
+	i, ok := m.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+
+	return i.job, true
+}
+
+// Jobs returns a snapshot of all stored jobs in creation order.
+func (m *Memory) Jobs() []Job {
+	m.RLock()
+	defer m.RUnlock()
+
+	jobs := make([]Job, 0)
+	for _, i := range m.sorted() {
+		jobs = append(jobs, i.job)
+	}
+
+	return jobs
+}
+
+// isAfter compares the index order of the item and the job, a job which no longer exists is
+// ordered by its creation time.
+func (m *Memory) isAfter(i *memoryItem, after *Job) bool {
+	if i.job.CreatedAt != after.CreatedAt {
+		return i.job.CreatedAt > after.CreatedAt
+	}
+
+	a, ok := m.jobs[after.ID]
+	return ok && i.seq > a.seq
+}
+
+func (m *Memory) sorted() []*memoryItem {
+	items := make([]*memoryItem, 0, len(m.jobs))
+	for _, i := range m.jobs {
+		items = append(items, i)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].job.CreatedAt != items[j].job.CreatedAt {
+			return items[i].job.CreatedAt < items[j].job.CreatedAt
+		}
+
+		return items[i].seq < items[j].seq
+	})
+
+	return items
+}
+
+func inSlice(key string, s []string) bool {
+	for _, i := range s {
+		if key == i {
+			return true
+		}
+	}
+
+	return false
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		jobs: make(map[uint64]*memoryItem),
+		now:  time.Now,
+	}
+}
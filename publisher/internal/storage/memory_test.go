@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemory_Conformance(t *testing.T) {
+	testConformance(t, func(t *testing.T, jobs []Job) Storage {
+		m := NewMemory()
+		m.Put(jobs...)
+
+		return m
+	})
+}
+
+func TestMemory_Put(t *testing.T) {
+	a := assert.New(t)
+	jobs := getTestJobs(3)
+	m := NewMemory()
+	m.Put(jobs...)
+
+	updated := jobs[1]
+	updated.Status = "completed"
+	m.Put(updated)
+
+	a.Equal([]Job{jobs[0], updated, jobs[2]}, m.Jobs())
+
+	j, ok := m.Get(1)
+	a.True(ok)
+	a.Equal(updated, j)
+
+	_, ok = m.Get(100)
+	a.False(ok)
+}
+
+func TestMemory_Complete(t *testing.T) {
+	a := assert.New(t)
+	jobs := getTestJobs(3)
+	m := NewMemory()
+	m.Put(jobs...)
+	m.now = func() time.Time { return time.UnixMilli(testUpdatedAt) }
+
+	a.Nil(m.Complete(1))
+
+	j, _ := m.Get(1)
+	a.Equal("completed", j.Status)
+	a.Equal(jobs[1].Status, j.CompletedFrom)
+	a.Equal(testUpdatedAt, j.UpdatedAt)
+
+	a.Nil(m.Complete(1))
+	j, _ = m.Get(1)
+	a.Equal(jobs[1].Status, j.CompletedFrom)
+
+	err := m.Complete(100)
+	a.True(errors.Is(err, ErrJobNotFound))
+	a.Equal("job not found: 100", err.Error())
+}
+
+func TestMemory_UpdateJobsNotFound(t *testing.T) {
+	a := assert.New(t)
+	m := NewMemory()
+	m.Put(getTestJobs(3)...)
+
+	err := m.UpdateJobs(context.TODO(), &UpdateJobsInput{
+		Update: []UpdateJob{{ID: 1, Status: "completed"}, {ID: 100, Status: "completed"}},
+	})
+
+	a.True(errors.Is(err, ErrJobNotFound))
+	a.Equal("job not found: 100", err.Error())
+	a.Equal(getTestJobs(3), m.Jobs())
+}
@@ -0,0 +1,397 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// sqlSchema mirrors the Jobs table, the host index orders the jobs of a host by creation time. The
+// content column type depends on the dialect, PostgreSQL has no BLOB and SQLite no BYTEA.
+const sqlSchema = `
+CREATE TABLE IF NOT EXISTS %[1]v (
+	id BIGINT PRIMARY KEY,
+	host TEXT NOT NULL,
+	os TEXT NOT NULL,
+	status TEXT NOT NULL,
+	created_at BIGINT NOT NULL,
+	updated_at BIGINT NOT NULL DEFAULT 0,
+	claim_token TEXT NOT NULL DEFAULT '',
+	completed_from TEXT NOT NULL DEFAULT '',
+	quarantine_reason TEXT NOT NULL DEFAULT '',
+	content %[2]v NOT NULL
+);
+CREATE INDEX IF NOT EXISTS %[1]v_host_index ON %[1]v (host, created_at, id);
+`
+
+type sqlStorage struct {
+	db       *sql.DB
+	table    string
+	postgres bool
+	now      func() time.Time
+}
+
+type SQLOption func(s *sqlStorage)
+
+// WithPostgres uses PostgreSQL $n placeholders instead of ?, and a BYTEA content column.
+func WithPostgres() SQLOption {
+	return func(s *sqlStorage) {
+		s.postgres = true
+	}
+}
+
+// CreateSQLTable creates the jobs table and its host index, the producer inserts the jobs with their
+// gzip compressed JSON content. It takes the options of NewSQL to pick the dialect.
+func CreateSQLTable(ctx context.Context, db *sql.DB, table string, options ...SQLOption) error {
+	s := new(sqlStorage)
+	for _, o := range options {
+		o(s)
+	}
+
+	contentType := "BLOB"
+	if s.postgres {
+		contentType = "BYTEA"
+	}
+
+	for _, stmt := range strings.Split(fmt.Sprintf(sqlSchema, table, contentType), ";") {
+		if strings.TrimSpace(stmt) == "" {
+			continue
+		}
+
+		if _, err := db.ExecContext(ctx, stmt); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// GetJobs pages through the host index like the DynamoDB storage, as labels are matched and
+// corrupt rows are skipped after each page is read.
+func (s *sqlStorage) GetJobs(ctx context.Context, input *GetJobsInput) (jobs []Job, err error) {
+	ctx, span := tracer.Start(ctx, "storage.GetJobs", trace.WithAttributes(
+		attribute.String("host", input.Host),
+		attribute.StringSlice("statuses", input.Statuses),
+		attribute.String("os", input.OS),
+		attribute.StringSlice("labels", input.Labels),
+		attribute.Int("limit", int(input.Limit)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	where := []string{"host = ?"}
+	args := []interface{}{input.Host}
+
+	placeholders := make([]string, 0)
+	for _, status := range input.Statuses {
+		placeholders = append(placeholders, "?")
+		args = append(args, status)
+	}
+	where = append(where, fmt.Sprintf("status IN (%v)", strings.Join(placeholders, ",")))
+
+	if input.OS != "" {
+		where = append(where, "os = ?")
+		args = append(args, input.OS)
+	}
+
+	jobs = make([]Job, 0)
+	corrupt := make([]CorruptJob, 0)
+	size := int(getPageSize(input.Limit))
+	var last *sqlCursor
+	if input.After != nil {
+		last = &sqlCursor{createdAt: input.After.CreatedAt, id: int64(input.After.ID)}
+	}
+
+	for len(jobs) < int(input.Limit) {
+		query := fmt.Sprintf(
+			"SELECT id, host, os, status, created_at, updated_at, claim_token, completed_from, content FROM %v WHERE %v",
+			s.table,
+			strings.Join(where, " AND "),
+		)
+		pageArgs := append([]interface{}{}, args...)
+		if last != nil {
+			query += " AND (created_at > ? OR (created_at = ? AND id > ?))"
+			pageArgs = append(pageArgs, last.createdAt, last.createdAt, last.id)
+		}
+
+		query += " ORDER BY created_at, id LIMIT ?"
+		pageArgs = append(pageArgs, size)
+
+		page, qErr := s.query(ctx, query, pageArgs...)
+		if qErr != nil {
+			return nil, qErr
+		}
+
+		corrupt = append(corrupt, page.corrupt...)
+		for i := range page.jobs {
+			if hasLabels(&page.jobs[i], input.Labels) {
+				jobs = append(jobs, page.jobs[i])
+			}
+		}
+
+		// the index is exhausted.
+		if page.rows < size {
+			break
+		}
+
+		last = page.last
+	}
+
+	if len(jobs) > int(input.Limit) {
+		jobs = jobs[:input.Limit]
+	}
+
+	span.SetAttributes(attribute.Int("corrupt", len(corrupt)))
+
+	if len(corrupt) != 0 {
+		return jobs, &CorruptJobsError{Jobs: corrupt, QuarantineErr: s.quarantine(ctx, corrupt)}
+	}
+
+	return jobs, nil
+}
+
+type sqlCursor struct {
+	createdAt int64
+	id        int64
+}
+
+type sqlPage struct {
+	jobs    []Job
+	corrupt []CorruptJob
+	rows    int
+	last    *sqlCursor
+}
+
+func (s *sqlStorage) query(ctx context.Context, query string, args ...interface{}) (*sqlPage, error) {
+	rows, err := s.db.QueryContext(ctx, s.rebind(query), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() { _ = rows.Close() }()
+
+	page := &sqlPage{jobs: make([]Job, 0), corrupt: make([]CorruptJob, 0)}
+	for rows.Next() {
+		var (
+			j       Job
+			id      int64
+			content []byte
+		)
+
+		if err := rows.Scan(&id, &j.Host, &j.OS, &j.Status, &j.CreatedAt, &j.UpdatedAt, &j.ClaimToken, &j.CompletedFrom, &content); err != nil {
+			return nil, err
+		}
+
+		j.ID = uint64(id)
+		page.rows++
+		page.last = &sqlCursor{createdAt: j.CreatedAt, id: id}
+
+		c, cErr := decodeContent(content)
+		var e *InvalidJobContentError
+		if errors.As(cErr, &e) {
+			page.corrupt = append(page.corrupt, CorruptJob{ID: j.ID, Type: e.Type})
+			continue
+		}
+
+		j.Content = c
+		page.jobs = append(page.jobs, j)
+	}
+
+	return page, rows.Err()
+}
+
+func (s *sqlStorage) quarantine(ctx context.Context, jobs []CorruptJob) error {
+	now := s.now().UnixMilli()
+	for _, j := range jobs {
+		if _, err := s.db.ExecContext(
+			ctx,
+			s.rebind(fmt.Sprintf("UPDATE %v SET status = ?, quarantine_reason = ?, updated_at = ? WHERE id = ?", s.table)),
+			QuarantinedStatus, j.Type, now, int64(j.ID),
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// UpdateJobs applies the update in one transaction, it fails without changes if a job to update
+// doesn't exist, except for the conditional updates which skip the jobs that don't match.
+func (s *sqlStorage) UpdateJobs(ctx context.Context, input *UpdateJobsInput) (err error) {
+	ctx, span := tracer.Start(ctx, "storage.UpdateJobs", trace.WithAttributes(
+		attribute.Int("updated", len(input.Update)),
+		attribute.Int("deleted", len(input.Delete)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		if err != nil {
+			_ = tx.Rollback()
+		}
+	}()
+
+	now := s.now().UnixMilli()
+	for _, u := range input.Update {
+		if u.If != nil {
+			if _, err = tx.ExecContext(
+				ctx,
+				s.rebind(fmt.Sprintf(
+					"UPDATE %v SET status = ?, updated_at = ? WHERE id = ? AND status = ? AND updated_at = ?",
+					s.table,
+				)),
+				u.Status, now, int64(u.ID), u.If.Status, u.If.UpdatedAt,
+			); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		res, uErr := tx.ExecContext(
+			ctx,
+			s.rebind(fmt.Sprintf("UPDATE %v SET status = ?, updated_at = ? WHERE id = ?", s.table)),
+			u.Status, now, int64(u.ID),
+		)
+
+		if err = getAffectedError(res, uErr, u.ID); err != nil {
+			return err
+		}
+	}
+
+	for _, id := range input.Delete {
+		if _, err = tx.ExecContext(
+			ctx,
+			s.rebind(fmt.Sprintf("DELETE FROM %v WHERE id = ?", s.table)),
+			int64(id),
+		); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (s *sqlStorage) ClaimJobs(ctx context.Context, input *ClaimJobsInput) (claimed []uint64, err error) {
+	ctx, span := tracer.Start(ctx, "storage.ClaimJobs", trace.WithAttributes(
+		attribute.Int("jobs", len(input.IDs)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("claimed", len(claimed)))
+		tracing.End(span, err)
+	}()
+
+	now := s.now().UnixMilli()
+	claimed = make([]uint64, 0)
+	for _, id := range input.IDs {
+		res, uErr := s.db.ExecContext(
+			ctx,
+			s.rebind(fmt.Sprintf(
+				"UPDATE %v SET status = ?, claim_token = ?, updated_at = ? WHERE id = ? AND status = ?",
+				s.table,
+			)),
+			inProgressStatus, input.Token, now, int64(id), queuedStatus,
+		)
+
+		aErr := getAffectedError(res, uErr, id)
+		if errors.Is(aErr, ErrJobNotFound) {
+			continue
+		}
+
+		if aErr != nil {
+			return claimed, aErr
+		}
+
+		claimed = append(claimed, id)
+	}
+
+	return claimed, nil
+}
+
+func (s *sqlStorage) ReleaseJobs(ctx context.Context, input *ReleaseJobsInput) (err error) {
+	ctx, span := tracer.Start(ctx, "storage.ReleaseJobs", trace.WithAttributes(
+		attribute.Int("jobs", len(input.IDs)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	now := s.now().UnixMilli()
+	for _, id := range input.IDs {
+		if _, err = s.db.ExecContext(
+			ctx,
+			s.rebind(fmt.Sprintf(
+				"UPDATE %v SET status = ?, claim_token = '', updated_at = ? WHERE id = ? AND status = ? AND claim_token = ?",
+				s.table,
+			)),
+			queuedStatus, now, int64(id), inProgressStatus, input.Token,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// rebind replaces ? placeholders with $n for PostgreSQL.
+func (s *sqlStorage) rebind(query string) string {
+	if !s.postgres {
+		return query
+	}
+
+	b := new(strings.Builder)
+	n := 0
+	for _, r := range query {
+		if r != '?' {
+			b.WriteRune(r)
+			continue
+		}
+
+		n++
+		b.WriteString("$" + strconv.Itoa(n))
+	}
+
+	return b.String()
+}
+
+func getAffectedError(res sql.Result, err error, id uint64) error {
+	if err != nil {
+		return err
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return fmt.Errorf("%w: %v", ErrJobNotFound, id)
+	}
+
+	return nil
+}
+
+// NewSQL stores the jobs in a SQL table created by CreateSQLTable, with the same semantics as the
+// DynamoDB storage.
+func NewSQL(db *sql.DB, table string, options ...SQLOption) Storage {
+	s := &sqlStorage{
+		db:    db,
+		table: table,
+		now:   time.Now,
+	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
+}
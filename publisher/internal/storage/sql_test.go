@@ -0,0 +1,130 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	_ "modernc.org/sqlite"
+)
+
+const sqlTestTable = "jobs"
+
+func TestSQL_Conformance(t *testing.T) {
+	testConformance(t, func(t *testing.T, jobs []Job) Storage {
+		db := getSQLTestDB(t)
+		putSQLTestJobs(t, db, jobs)
+
+		return NewSQL(db, sqlTestTable)
+	})
+}
+
+func TestSQL_GetJobsCorrupt(t *testing.T) {
+	a := assert.New(t)
+	db := getSQLTestDB(t)
+	jobs := getTestJobs(testJobsNum)
+	putSQLTestJobs(t, db, jobs)
+
+	_, err := db.Exec("UPDATE jobs SET content = ? WHERE id IN (1, 7)", []byte("invalid"))
+	a.Nil(err)
+
+	s := NewSQL(db, sqlTestTable)
+	s.(*sqlStorage).now = func() time.Time { return time.UnixMilli(testUpdatedAt) }
+
+	res, err := s.GetJobs(context.TODO(), &GetJobsInput{
+		Host:     "ec2",
+		Statuses: []string{"queued"},
+		Limit:    1,
+	})
+
+	a.Equal([]Job{jobs[5]}, res)
+	a.Equal(&CorruptJobsError{Jobs: []CorruptJob{{ID: 1, Type: InvalidGZIPType}, {ID: 7, Type: InvalidGZIPType}}}, err)
+
+	var (
+		status string
+		reason string
+		at     int64
+	)
+	a.Nil(db.QueryRow("SELECT status, quarantine_reason, updated_at FROM jobs WHERE id = 1").Scan(&status, &reason, &at))
+	a.Equal(QuarantinedStatus, status)
+	a.Equal(InvalidGZIPType, reason)
+	a.Equal(testUpdatedAt, at)
+}
+
+func TestSQL_UpdateJobsNotFound(t *testing.T) {
+	a := assert.New(t)
+	db := getSQLTestDB(t)
+	putSQLTestJobs(t, db, getTestJobs(3))
+
+	err := NewSQL(db, sqlTestTable).UpdateJobs(context.TODO(), &UpdateJobsInput{
+		Update: []UpdateJob{{ID: 1, Status: "completed"}, {ID: 100, Status: "completed"}},
+	})
+
+	a.True(errors.Is(err, ErrJobNotFound))
+	a.Equal("job not found: 100", err.Error())
+}
+
+func TestSQL_Rebind(t *testing.T) {
+	cases := map[string]struct {
+		options  []SQLOption
+		expected string
+	}{
+		"sqlite": {
+			expected: "UPDATE jobs SET status = ? WHERE id = ? AND status = ?",
+		},
+		"postgres": {
+			options:  []SQLOption{WithPostgres()},
+			expected: "UPDATE jobs SET status = $1 WHERE id = $2 AND status = $3",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			s := NewSQL(nil, sqlTestTable, tc.options...).(*sqlStorage)
+
+			a.Equal(tc.expected, s.rebind("UPDATE jobs SET status = ? WHERE id = ? AND status = ?"))
+		})
+	}
+}
+
+func TestSQL_CreateSQLTable(t *testing.T) {
+	a := assert.New(t)
+	db := getSQLTestDB(t)
+
+	var contentType string
+	a.Nil(db.QueryRow("SELECT type FROM pragma_table_info('jobs') WHERE name = 'content'").Scan(&contentType))
+	a.Equal("BLOB", contentType)
+}
+
+func getSQLTestDB(t *testing.T) *sql.DB {
+	db, err := sql.Open("sqlite", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// each connection opens its own in-memory database.
+	db.SetMaxOpenConns(1)
+	t.Cleanup(func() { _ = db.Close() })
+
+	if err := CreateSQLTable(context.TODO(), db, sqlTestTable); err != nil {
+		t.Fatal(err)
+	}
+
+	return db
+}
+
+func putSQLTestJobs(t *testing.T, db *sql.DB, jobs []Job) {
+	for _, j := range jobs {
+		if _, err := db.Exec(
+			fmt.Sprintf("INSERT INTO %v (id, host, os, status, created_at, content) VALUES (?, ?, ?, ?, ?, ?)", sqlTestTable),
+			int64(j.ID), j.Host, j.OS, j.Status, j.CreatedAt, getCompressedContent(j.Content),
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
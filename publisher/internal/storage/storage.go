@@ -2,25 +2,69 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
 	"strings"
+	"time"
 
+	"github.com/CameronXie/aws-github-actions-runner/telemetry/tracing"
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/feature/dynamodb/attributevalue"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+const (
+	// DefaultMaxReadCapacity is the read capacity units cap of a single GetJobs call.
+	DefaultMaxReadCapacity = 100
+
+	// MaxTransactItems is the item limit of a DynamoDB transaction.
+	MaxTransactItems = 100
+
+	queuedStatus     = "queued"
+	inProgressStatus = "in_progress"
+	completedStatus  = "completed"
+
+	// QuarantinedStatus is set on items whose content can't be decoded, so they no longer block the
+	// jobs of their host.
+	QuarantinedStatus = "quarantined"
+)
+
+var tracer = otel.Tracer("github.com/CameronXie/aws-github-actions-runner/publisher/internal/storage")
+
+// minPageSize keeps the pages of a GetJobs call large, when most items of the index are filtered out,
+// pages sized by the jobs still missing would read a handful of items per request.
+var minPageSize int32 = 100
+
 type GetJobsInput struct {
 	Host     string
 	Statuses []string
-	Limit    int32
+	// OS only returns the jobs of the OS when it's set.
+	OS string
+	// Labels only returns the jobs which have all the labels. The job content is compressed, so
+	// labels are matched after each page is read, and the read capacity of skipped jobs is consumed.
+	Labels []string
+	Limit  int32
+	// After only returns the jobs after the job in index order, so a caller can page past the jobs
+	// it has read.
+	After *Job
 }
 
 type UpdateJob struct {
 	ID     uint64
 	Status string
+	// If skips the update, instead of failing it, when the job no longer matches the condition.
+	If *UpdateCondition
+}
+
+// UpdateCondition matches a job which still has the status and the update time it was read with.
+type UpdateCondition struct {
+	Status    string
+	UpdatedAt int64
 }
 
 type UpdateJobsInput struct {
@@ -28,18 +72,77 @@ type UpdateJobsInput struct {
 	Delete []uint64
 }
 
+type ClaimJobsInput struct {
+	IDs []uint64
+	// Token identifies the publisher invocation which claimed the jobs.
+	Token string
+}
+
+type ReleaseJobsInput struct {
+	IDs   []uint64
+	Token string
+}
+
 type Storage interface {
 	GetJobs(ctx context.Context, input *GetJobsInput) ([]Job, error)
+	// UpdateJobs updates the status of jobs and deletes jobs. The DynamoDB storage applies at most
+	// MaxTransactItems items atomically, a larger update may be partially applied when it fails.
+	// Conditional updates are applied on their own, and the jobs which don't match are skipped.
 	UpdateJobs(ctx context.Context, input *UpdateJobsInput) error
+	// ClaimJobs moves queued jobs to in_progress with the claim token, and returns the IDs of the
+	// claimed jobs. Jobs which are no longer queued, e.g. claimed by another invocation, are skipped.
+	ClaimJobs(ctx context.Context, input *ClaimJobsInput) ([]uint64, error)
+	// ReleaseJobs moves jobs still claimed with the token back to queued.
+	ReleaseJobs(ctx context.Context, input *ReleaseJobsInput) error
+}
+
+// DynamoDBAPIClient is the subset of the DynamoDB client used by the storage.
+type DynamoDBAPIClient interface {
+	dynamodb.QueryAPIClient
+	UpdateItem(
+		ctx context.Context,
+		params *dynamodb.UpdateItemInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.UpdateItemOutput, error)
+	TransactWriteItems(
+		ctx context.Context,
+		params *dynamodb.TransactWriteItemsInput,
+		optFns ...func(*dynamodb.Options),
+	) (*dynamodb.TransactWriteItemsOutput, error)
 }
 
 type storage struct {
-	client    *dynamodb.Client
-	table     string
-	hostIndex string
+	client          DynamoDBAPIClient
+	table           string
+	hostIndex       string
+	maxReadCapacity float64
+	now             func() time.Time
 }
 
-func (s *storage) GetJobs(ctx context.Context, input *GetJobsInput) ([]Job, error) {
+type Option func(s *storage)
+
+// WithMaxReadCapacity caps the read capacity units a single GetJobs call consumes while paging, the
+// call returns the jobs collected so far once the cap is reached.
+func WithMaxReadCapacity(units float64) Option {
+	return func(s *storage) {
+		s.maxReadCapacity = units
+	}
+}
+
+func (s *storage) GetJobs(ctx context.Context, input *GetJobsInput) (jobs []Job, err error) {
+	ctx, span := tracer.Start(ctx, "storage.GetJobs", trace.WithAttributes(
+		attribute.String("host", input.Host),
+		attribute.StringSlice("statuses", input.Statuses),
+		attribute.String("os", input.OS),
+		attribute.StringSlice("labels", input.Labels),
+		attribute.Int("limit", int(input.Limit)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	if input.Limit <= 0 {
+		return make([]Job, 0), nil
+	}
+
 	keys := make([]string, 0)
 	values := map[string]types.AttributeValue{
 		":h": &types.AttributeValueMemberS{Value: input.Host},
@@ -53,36 +156,158 @@ func (s *storage) GetJobs(ctx context.Context, input *GetJobsInput) ([]Job, erro
 		keys = append(keys, key)
 	}
 
-	o, err := s.client.Query(ctx, &dynamodb.QueryInput{
-		TableName:              aws.String(s.table),
-		IndexName:              aws.String(s.hostIndex),
-		Limit:                  aws.Int32(input.Limit),
-		KeyConditionExpression: aws.String("#h = :h"),
-		FilterExpression:       aws.String(fmt.Sprintf("#s IN (%v)", strings.Join(keys, ","))),
-		ProjectionExpression:   aws.String("ID,OS,Content,#s,#h"),
-		ExpressionAttributeNames: map[string]string{
-			"#h": "Host",
-			"#s": "Status",
-		},
-		ExpressionAttributeValues: values,
-	})
+	filter := fmt.Sprintf("#s IN (%v)", strings.Join(keys, ","))
+	if input.OS != "" {
+		filter += " AND OS = :os"
+		values[":os"] = &types.AttributeValueMemberS{Value: input.OS}
+	}
 
-	if err != nil {
-		return nil, err
+	// DynamoDB applies Limit before FilterExpression, so the query pages until it collects the
+	// requested number of matching jobs, exhausts the index or consumes the read capacity cap.
+	// Pages have a fixed size, and the jobs beyond the limit are dropped.
+	jobs = make([]Job, 0)
+	corrupt := make([]CorruptJob, 0)
+	pages, consumed := 0, 0.0
+	startKey := getStartKey(input.After)
+
+	for {
+		o, qErr := s.client.Query(ctx, &dynamodb.QueryInput{
+			TableName:              aws.String(s.table),
+			IndexName:              aws.String(s.hostIndex),
+			Limit:                  aws.Int32(getPageSize(input.Limit)),
+			ExclusiveStartKey:      startKey,
+			ReturnConsumedCapacity: types.ReturnConsumedCapacityTotal,
+			KeyConditionExpression: aws.String("#h = :h"),
+			FilterExpression:       aws.String(filter),
+			ProjectionExpression:   aws.String("ID,OS,Content,CreatedAt,UpdatedAt,ClaimToken,CompletedFrom,#s,#h"),
+			ExpressionAttributeNames: map[string]string{
+				"#h": "Host",
+				"#s": "Status",
+			},
+			ExpressionAttributeValues: values,
+		})
+
+		if qErr != nil {
+			return nil, qErr
+		}
+
+		for _, item := range o.Items {
+			j := new(Job)
+			uErr := attributevalue.UnmarshalMap(item, j)
+			var e *InvalidJobContentError
+			if errors.As(uErr, &e) {
+				c := CorruptJob{Type: e.Type}
+				_ = attributevalue.Unmarshal(item["ID"], &c.ID)
+				corrupt = append(corrupt, c)
+				continue
+			}
+
+			if uErr != nil {
+				return nil, uErr
+			}
+
+			if hasLabels(j, input.Labels) {
+				jobs = append(jobs, *j)
+			}
+		}
+
+		pages++
+		if o.ConsumedCapacity != nil {
+			consumed += aws.ToFloat64(o.ConsumedCapacity.CapacityUnits)
+		}
+
+		startKey = o.LastEvaluatedKey
+		if len(jobs) >= int(input.Limit) || len(startKey) == 0 || consumed >= s.maxReadCapacity {
+			break
+		}
 	}
 
-	jobs := make([]Job, 0)
-	if err := attributevalue.UnmarshalListOfMaps(o.Items, &jobs); err != nil {
-		return nil, err
+	if len(jobs) > int(input.Limit) {
+		jobs = jobs[:input.Limit]
+	}
+
+	span.SetAttributes(
+		attribute.Int("pages", pages),
+		attribute.Float64("consumed_capacity", consumed),
+		attribute.Int("corrupt", len(corrupt)),
+	)
+
+	if len(corrupt) != 0 {
+		return jobs, &CorruptJobsError{Jobs: corrupt, QuarantineErr: s.quarantine(ctx, corrupt)}
 	}
 
 	return jobs, nil
 }
 
-func (s *storage) UpdateJobs(ctx context.Context, input *UpdateJobsInput) error {
-	u := make([]types.TransactWriteItem, 0)
+// getStartKey resumes the host index query after the job, an index key includes the table key.
+func getStartKey(after *Job) map[string]types.AttributeValue {
+	if after == nil {
+		return nil
+	}
+
+	return map[string]types.AttributeValue{
+		"ID":        &types.AttributeValueMemberN{Value: uint64ToString(after.ID)},
+		"Host":      &types.AttributeValueMemberS{Value: after.Host},
+		"CreatedAt": &types.AttributeValueMemberN{Value: strconv.FormatInt(after.CreatedAt, 10)},
+	}
+}
+
+func getPageSize(limit int32) int32 {
+	if limit < minPageSize {
+		return minPageSize
+	}
+
+	return limit
+}
+
+// quarantine moves corrupt items to the quarantined status with the error type as the reason.
+func (s *storage) quarantine(ctx context.Context, jobs []CorruptJob) error {
+	now := strconv.FormatInt(s.now().UnixMilli(), 10)
+	for _, j := range jobs {
+		_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName: aws.String(s.table),
+			Key: map[string]types.AttributeValue{
+				"ID": &types.AttributeValueMemberN{Value: uint64ToString(j.ID)},
+			},
+			UpdateExpression:    aws.String("SET #s = :s, QuarantineReason = :r, UpdatedAt = :now"),
+			ConditionExpression: aws.String("attribute_exists(ID)"),
+			ExpressionAttributeNames: map[string]string{
+				"#s": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":s":   &types.AttributeValueMemberS{Value: QuarantinedStatus},
+				":r":   &types.AttributeValueMemberS{Value: j.Type},
+				":now": &types.AttributeValueMemberN{Value: now},
+			},
+		})
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *storage) UpdateJobs(ctx context.Context, input *UpdateJobsInput) (err error) {
+	ctx, span := tracer.Start(ctx, "storage.UpdateJobs", trace.WithAttributes(
+		attribute.Int("updated", len(input.Update)),
+		attribute.Int("deleted", len(input.Delete)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	now := s.now().UnixMilli()
+	items := make([]types.TransactWriteItem, 0)
 	for _, v := range input.Update {
-		u = append(u, types.TransactWriteItem{
+		if v.If != nil {
+			if err = s.updateJobIf(ctx, v, now); err != nil {
+				return err
+			}
+
+			continue
+		}
+
+		items = append(items, types.TransactWriteItem{
 			Update: &types.Update{
 				TableName: aws.String(s.table),
 				Key: map[string]types.AttributeValue{
@@ -90,21 +315,21 @@ func (s *storage) UpdateJobs(ctx context.Context, input *UpdateJobsInput) error
 						Value: uint64ToString(v.ID),
 					},
 				},
-				UpdateExpression:    aws.String("SET #s = :s"),
+				UpdateExpression:    aws.String("SET #s = :s, UpdatedAt = :now"),
 				ConditionExpression: aws.String("attribute_exists(ID)"),
 				ExpressionAttributeNames: map[string]string{
 					"#s": "Status",
 				},
 				ExpressionAttributeValues: map[string]types.AttributeValue{
-					":s": &types.AttributeValueMemberS{Value: v.Status},
+					":s":   &types.AttributeValueMemberS{Value: v.Status},
+					":now": &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
 				},
 			},
 		})
 	}
 
-	d := make([]types.TransactWriteItem, 0)
 	for _, v := range input.Delete {
-		u = append(u, types.TransactWriteItem{
+		items = append(items, types.TransactWriteItem{
 			Delete: &types.Delete{
 				TableName: aws.String(s.table),
 				Key: map[string]types.AttributeValue{
@@ -116,22 +341,173 @@ func (s *storage) UpdateJobs(ctx context.Context, input *UpdateJobsInput) error
 		})
 	}
 
-	_, err := s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
-		TransactItems: append(u, d...),
+	// a transaction has at most MaxTransactItems items, so larger updates are split into several
+	// transactions. Each of them is applied atomically, but the update as a whole is not: when a
+	// transaction fails, the earlier ones stay applied. Status updates and deletes are idempotent,
+	// and the jobs left behind are read again by the next run.
+	for start := 0; start < len(items); start += MaxTransactItems {
+		end := start + MaxTransactItems
+		if end > len(items) {
+			end = len(items)
+		}
+
+		if _, err = s.client.TransactWriteItems(ctx, &dynamodb.TransactWriteItemsInput{
+			TransactItems: items[start:end],
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateJobIf applies a conditional update on its own, so a job which no longer matches doesn't fail
+// the other updates. Jobs stored before UpdatedAt was recorded match an UpdatedAt of 0.
+func (s *storage) updateJobIf(ctx context.Context, v UpdateJob, now int64) error {
+	condition := "#s = :if_status AND UpdatedAt = :if_updated_at"
+	if v.If.UpdatedAt == 0 {
+		condition = "#s = :if_status AND (attribute_not_exists(UpdatedAt) OR UpdatedAt = :if_updated_at)"
+	}
+
+	_, err := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(s.table),
+		Key:                 getKey(v.ID),
+		UpdateExpression:    aws.String("SET #s = :s, UpdatedAt = :now"),
+		ConditionExpression: aws.String(condition),
+		ExpressionAttributeNames: map[string]string{
+			"#s": "Status",
+		},
+		ExpressionAttributeValues: map[string]types.AttributeValue{
+			":s":             &types.AttributeValueMemberS{Value: v.Status},
+			":now":           &types.AttributeValueMemberN{Value: strconv.FormatInt(now, 10)},
+			":if_status":     &types.AttributeValueMemberS{Value: v.If.Status},
+			":if_updated_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(v.If.UpdatedAt, 10)},
+		},
 	})
 
+	var e *types.ConditionalCheckFailedException
+	if errors.As(err, &e) {
+		return nil
+	}
+
 	return err
 }
 
+func (s *storage) ClaimJobs(ctx context.Context, input *ClaimJobsInput) (claimed []uint64, err error) {
+	ctx, span := tracer.Start(ctx, "storage.ClaimJobs", trace.WithAttributes(
+		attribute.Int("jobs", len(input.IDs)),
+	))
+	defer func() {
+		span.SetAttributes(attribute.Int("claimed", len(claimed)))
+		tracing.End(span, err)
+	}()
+
+	now := strconv.FormatInt(s.now().UnixMilli(), 10)
+	claimed = make([]uint64, 0)
+	for _, id := range input.IDs {
+		// each job is claimed on its own, so a job claimed by another invocation doesn't fail the others.
+		_, uErr := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(s.table),
+			Key:                 getKey(id),
+			UpdateExpression:    aws.String("SET #s = :in_progress, ClaimToken = :token, UpdatedAt = :now"),
+			ConditionExpression: aws.String("#s = :queued"),
+			ExpressionAttributeNames: map[string]string{
+				"#s": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":in_progress": &types.AttributeValueMemberS{Value: inProgressStatus},
+				":queued":      &types.AttributeValueMemberS{Value: queuedStatus},
+				":token":       &types.AttributeValueMemberS{Value: input.Token},
+				":now":         &types.AttributeValueMemberN{Value: now},
+			},
+		})
+
+		var e *types.ConditionalCheckFailedException
+		if errors.As(uErr, &e) {
+			continue
+		}
+
+		if uErr != nil {
+			return claimed, uErr
+		}
+
+		claimed = append(claimed, id)
+	}
+
+	return claimed, nil
+}
+
+func (s *storage) ReleaseJobs(ctx context.Context, input *ReleaseJobsInput) (err error) {
+	ctx, span := tracer.Start(ctx, "storage.ReleaseJobs", trace.WithAttributes(
+		attribute.Int("jobs", len(input.IDs)),
+	))
+	defer func() { tracing.End(span, err) }()
+
+	now := strconv.FormatInt(s.now().UnixMilli(), 10)
+	for _, id := range input.IDs {
+		_, uErr := s.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+			TableName:           aws.String(s.table),
+			Key:                 getKey(id),
+			UpdateExpression:    aws.String("SET #s = :queued, UpdatedAt = :now REMOVE ClaimToken"),
+			ConditionExpression: aws.String("#s = :in_progress AND ClaimToken = :token"),
+			ExpressionAttributeNames: map[string]string{
+				"#s": "Status",
+			},
+			ExpressionAttributeValues: map[string]types.AttributeValue{
+				":in_progress": &types.AttributeValueMemberS{Value: inProgressStatus},
+				":queued":      &types.AttributeValueMemberS{Value: queuedStatus},
+				":token":       &types.AttributeValueMemberS{Value: input.Token},
+				":now":         &types.AttributeValueMemberN{Value: now},
+			},
+		})
+
+		// the job has moved on, e.g. its completed webhook has been received.
+		var e *types.ConditionalCheckFailedException
+		if errors.As(uErr, &e) {
+			continue
+		}
+
+		if uErr != nil {
+			return uErr
+		}
+	}
+
+	return nil
+}
+
+func getKey(id uint64) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		"ID": &types.AttributeValueMemberN{Value: uint64ToString(id)},
+	}
+}
+
+func hasLabels(j *Job, labels []string) bool {
+	for _, l := range labels {
+		if !inSlice(l, j.Content.Labels) {
+			return false
+		}
+	}
+
+	return true
+}
+
 func uint64ToString(n uint64) string {
 	base := 10
 	return strconv.FormatUint(n, base)
 }
 
-func New(client *dynamodb.Client, table, index string) Storage {
-	return &storage{
-		client:    client,
-		table:     table,
-		hostIndex: index,
+func New(client DynamoDBAPIClient, table, index string, options ...Option) Storage {
+	s := &storage{
+		client:          client,
+		table:           table,
+		hostIndex:       index,
+		maxReadCapacity: DefaultMaxReadCapacity,
+		now:             time.Now,
 	}
+
+	for _, o := range options {
+		o(s)
+	}
+
+	return s
 }
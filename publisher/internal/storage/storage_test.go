@@ -2,8 +2,10 @@ package storage
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"strconv"
+	"strings"
 	"testing"
 	"time"
 
@@ -12,7 +14,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
-	"github.com/aws/smithy-go"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/suite"
 )
 
@@ -21,6 +23,8 @@ const (
 	testTable              = "publisher-storage-test"
 	hostIndex              = "HostIndex"
 	testJobsNum            = 10
+	testCreatedAt          = int64(1640995200000)
+	testUpdatedAt          = int64(1640995260000)
 )
 
 type storageSuite struct {
@@ -47,10 +51,11 @@ func (s *storageSuite) TestStorage_GetJobs() {
 			// nolint: dupl
 			expected: []Job{
 				{
-					ID:     1,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "queued",
+					ID:        1,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "queued",
+					CreatedAt: testCreatedAt + 1,
 					Content: JobContent{
 						ID:         1,
 						Owner:      "owner-1",
@@ -59,10 +64,11 @@ func (s *storageSuite) TestStorage_GetJobs() {
 					},
 				},
 				{
-					ID:     2,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "completed",
+					ID:        2,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "completed",
+					CreatedAt: testCreatedAt + 2,
 					Content: JobContent{
 						ID:         2,
 						Owner:      "owner-2",
@@ -71,10 +77,11 @@ func (s *storageSuite) TestStorage_GetJobs() {
 					},
 				},
 				{
-					ID:     4,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "completed",
+					ID:        4,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "completed",
+					CreatedAt: testCreatedAt + 4,
 					Content: JobContent{
 						ID:         4,
 						Owner:      "owner-4",
@@ -82,15 +89,41 @@ func (s *storageSuite) TestStorage_GetJobs() {
 						Labels:     []string{"ec2", "ubuntu"},
 					},
 				},
+				{
+					ID:        5,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "queued",
+					CreatedAt: testCreatedAt + 5,
+					Content: JobContent{
+						ID:         5,
+						Owner:      "owner-5",
+						Repository: "repo-5",
+						Labels:     []string{"ec2", "ubuntu"},
+					},
+				},
+				{
+					ID:        7,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "queued",
+					CreatedAt: testCreatedAt + 7,
+					Content: JobContent{
+						ID:         7,
+						Owner:      "owner-7",
+						Repository: "repo-7",
+						Labels:     []string{"ec2", "ubuntu"},
+					},
+				},
 			},
 		},
-		"invalid input": {
+		"zero limit": {
 			getJobsInput: &GetJobsInput{
 				Host:     "ec2",
 				Statuses: []string{"queued", "completed"},
 				Limit:    0,
 			},
-			errType: new(smithy.OperationError),
+			expected: []Job{},
 		},
 	}
 
@@ -113,7 +146,8 @@ func (s *storageSuite) TestStorage_GetJobs() {
 }
 
 func (s *storageSuite) TestStorage_UpdateJobs() {
-	db := New(s.client, s.table, s.hostIndex)
+	db := New(s.client, s.table, s.hostIndex).(*storage)
+	db.now = func() time.Time { return time.UnixMilli(testUpdatedAt) }
 	cases := map[string]struct {
 		update   *UpdateJobsInput
 		expected []Job
@@ -130,10 +164,12 @@ func (s *storageSuite) TestStorage_UpdateJobs() {
 			// nolint: dupl
 			expected: []Job{
 				{
-					ID:     3,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "updated",
+					ID:        3,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "updated",
+					CreatedAt: testCreatedAt + 3,
+					UpdatedAt: testUpdatedAt,
 					Content: JobContent{
 						ID:         3,
 						Owner:      "owner-3",
@@ -142,10 +178,12 @@ func (s *storageSuite) TestStorage_UpdateJobs() {
 					},
 				},
 				{
-					ID:     4,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "updated",
+					ID:        4,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "updated",
+					CreatedAt: testCreatedAt + 4,
+					UpdatedAt: testUpdatedAt,
 					Content: JobContent{
 						ID:         4,
 						Owner:      "owner-4",
@@ -154,10 +192,11 @@ func (s *storageSuite) TestStorage_UpdateJobs() {
 					},
 				},
 				{
-					ID:     5,
-					Host:   "ec2",
-					OS:     "ubuntu",
-					Status: "queued",
+					ID:        5,
+					Host:      "ec2",
+					OS:        "ubuntu",
+					Status:    "queued",
+					CreatedAt: testCreatedAt + 5,
 					Content: JobContent{
 						ID:         5,
 						Owner:      "owner-5",
@@ -189,6 +228,16 @@ func (s *storageSuite) TestStorage_UpdateJobs() {
 	}
 }
 
+func (s *storageSuite) TestStorage_Conformance() {
+	testConformance(s.T(), func(t *testing.T, _ []Job) Storage {
+		// the suite jobs are the conformance jobs, they are put again to undo the previous case.
+		s.TearDownTest()
+		s.SetupTest()
+
+		return New(s.client, s.table, s.hostIndex)
+	})
+}
+
 func (s *storageSuite) SetupSuite() {
 	cfg, _ := config.LoadDefaultConfig(
 		context.TODO(),
@@ -286,7 +335,7 @@ func (s *storageSuite) setupTestTable() {
 					},
 				},
 				Projection: &types.Projection{
-					NonKeyAttributes: []string{"OS", "Content", "Status"},
+					NonKeyAttributes: []string{"OS", "Content", "Status", "UpdatedAt", "ClaimToken", "CompletedFrom"},
 					ProjectionType:   types.ProjectionTypeInclude,
 				},
 			},
@@ -322,10 +371,11 @@ func getTestJobs(num int) []Job {
 		}
 
 		jobs[i] = Job{
-			ID:     uint64(i),
-			Host:   "ec2",
-			OS:     "ubuntu",
-			Status: status,
+			ID:        uint64(i),
+			Host:      "ec2",
+			OS:        "ubuntu",
+			Status:    status,
+			CreatedAt: testCreatedAt + int64(i),
 			Content: JobContent{
 				ID:         uint64(i),
 				Owner:      fmt.Sprintf("owner-%v", i),
@@ -357,12 +407,436 @@ func getPutRequestFromJob(job *Job) *types.PutRequest {
 				Value: job.Status,
 			},
 			"CreatedAt": &types.AttributeValueMemberN{
-				Value: strconv.Itoa(int(time.Now().UnixMilli())),
+				Value: strconv.FormatInt(job.CreatedAt, 10),
 			},
 		},
 	}
 }
 
+func TestStorage_GetJobsPagination(t *testing.T) {
+	defer func(s int32) { minPageSize = s }(minPageSize)
+	minPageSize = 2
+
+	cases := map[string]struct {
+		statuses       []string
+		os             string
+		labels         []string
+		corrupt        bool
+		limit          int32
+		after          *Job
+		options        []Option
+		queryErr       error
+		updateErr      error
+		expectedIDs    []uint64
+		expectedLimits []int32
+		err            error
+	}{
+		"collect matching jobs across pages": {
+			statuses:       []string{"queued"},
+			limit:          3,
+			expectedIDs:    []uint64{1, 5, 7},
+			expectedLimits: []int32{3, 3, 3},
+		},
+		"drop jobs beyond the limit": {
+			statuses:       []string{"queued", "completed"},
+			limit:          3,
+			expectedIDs:    []uint64{1, 2, 4},
+			expectedLimits: []int32{3, 3},
+		},
+		"index exhausted": {
+			statuses:       []string{"completed"},
+			limit:          10,
+			expectedIDs:    []uint64{2, 4, 8},
+			expectedLimits: []int32{10},
+		},
+		"page after a job": {
+			statuses:       []string{"queued"},
+			limit:          3,
+			after:          &getTestJobs(testJobsNum)[1],
+			expectedIDs:    []uint64{5, 7},
+			expectedLimits: []int32{3, 3, 3},
+		},
+		"stop at read capacity cap": {
+			statuses:       []string{"queued"},
+			limit:          3,
+			options:        []Option{WithMaxReadCapacity(2)},
+			expectedIDs:    []uint64{1, 5},
+			expectedLimits: []int32{3, 3},
+		},
+		"filter by os": {
+			statuses:       []string{"queued"},
+			os:             "windows",
+			limit:          3,
+			expectedIDs:    []uint64{5, 7},
+			expectedLimits: []int32{3, 3, 3, 3},
+		},
+		"filter by labels": {
+			statuses:       []string{"queued"},
+			labels:         []string{"windows", "gpu"},
+			limit:          3,
+			expectedIDs:    []uint64{7},
+			expectedLimits: []int32{3, 3, 3, 3},
+		},
+		"quarantine corrupt jobs": {
+			statuses:       []string{"queued"},
+			corrupt:        true,
+			limit:          3,
+			expectedIDs:    []uint64{1, 7},
+			expectedLimits: []int32{3, 3, 3, 3},
+			err:            &CorruptJobsError{Jobs: []CorruptJob{{ID: 5, Type: InvalidGZIPType}}},
+		},
+		"failed to quarantine corrupt jobs": {
+			statuses:       []string{"queued"},
+			corrupt:        true,
+			limit:          3,
+			updateErr:      errors.New("update error"),
+			expectedIDs:    []uint64{1, 7},
+			expectedLimits: []int32{3, 3, 3, 3},
+			err: &CorruptJobsError{
+				Jobs:          []CorruptJob{{ID: 5, Type: InvalidGZIPType}},
+				QuarantineErr: errors.New("update error"),
+			},
+		},
+		"query error": {
+			statuses:       []string{"queued"},
+			limit:          3,
+			queryErr:       errors.New("query error"),
+			expectedLimits: []int32{3},
+			err:            errors.New("query error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &fakePaginatingClient{capacityPerItem: 0.5, err: tc.queryErr, updateErr: tc.updateErr}
+			for _, j := range getTestJobs(testJobsNum) {
+				switch j.ID {
+				case 5:
+					j.OS = "windows"
+					j.Content.Labels = []string{"ec2", "windows"}
+				case 7:
+					j.OS = "windows"
+					j.Content.Labels = []string{"ec2", "windows", "gpu"}
+				}
+
+				item := getPutRequestFromJob(&j).Item
+				if tc.corrupt && j.ID == 5 {
+					item["Content"] = &types.AttributeValueMemberB{Value: []byte("corrupt")}
+				}
+
+				client.items = append(client.items, item)
+			}
+
+			jobs, err := New(client, "table", "index", tc.options...).GetJobs(context.TODO(), &GetJobsInput{
+				Host:     "ec2",
+				Statuses: tc.statuses,
+				OS:       tc.os,
+				Labels:   tc.labels,
+				Limit:    tc.limit,
+				After:    tc.after,
+			})
+
+			a.Equal(tc.err, err)
+
+			limits := make([]int32, 0)
+			for _, i := range client.inputs {
+				limits = append(limits, aws.ToInt32(i.Limit))
+			}
+			a.Equal(tc.expectedLimits, limits)
+			a.Equal(getStartKey(tc.after), client.inputs[0].ExclusiveStartKey)
+
+			if _, ok := AsCorruptJobsError(err); ok {
+				a.Len(client.updates, 1)
+				a.Equal(aws.String("SET #s = :s, QuarantineReason = :r, UpdatedAt = :now"), client.updates[0].UpdateExpression)
+				a.Equal(
+					&types.AttributeValueMemberS{Value: QuarantinedStatus},
+					client.updates[0].ExpressionAttributeValues[":s"],
+				)
+			} else if tc.err != nil {
+				a.Nil(jobs)
+				return
+			}
+
+			ids := make([]uint64, 0)
+			for _, j := range jobs {
+				ids = append(ids, j.ID)
+			}
+			a.Equal(tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestStorage_ClaimJobs(t *testing.T) {
+	cases := map[string]struct {
+		errs     map[string]error
+		expected []uint64
+		err      error
+	}{
+		"claim queued jobs": {
+			expected: []uint64{1, 2, 3},
+		},
+		"skip jobs claimed by others": {
+			errs:     map[string]error{"2": &types.ConditionalCheckFailedException{}},
+			expected: []uint64{1, 3},
+		},
+		"failed to claim jobs": {
+			errs:     map[string]error{"2": errors.New("some error")},
+			expected: []uint64{1},
+			err:      errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &fakePaginatingClient{updateErrs: tc.errs}
+			db := New(client, "table", "index").(*storage)
+			db.now = func() time.Time { return time.UnixMilli(testUpdatedAt) }
+
+			claimed, err := db.ClaimJobs(context.TODO(), &ClaimJobsInput{IDs: []uint64{1, 2, 3}, Token: "token"})
+
+			a.Equal(tc.expected, claimed)
+			a.Equal(tc.err, err)
+			a.Equal(&dynamodb.UpdateItemInput{
+				TableName:           aws.String("table"),
+				Key:                 getKey(1),
+				UpdateExpression:    aws.String("SET #s = :in_progress, ClaimToken = :token, UpdatedAt = :now"),
+				ConditionExpression: aws.String("#s = :queued"),
+				ExpressionAttributeNames: map[string]string{
+					"#s": "Status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":in_progress": &types.AttributeValueMemberS{Value: "in_progress"},
+					":queued":      &types.AttributeValueMemberS{Value: "queued"},
+					":token":       &types.AttributeValueMemberS{Value: "token"},
+					":now":         &types.AttributeValueMemberN{Value: strconv.FormatInt(testUpdatedAt, 10)},
+				},
+			}, client.updates[0])
+		})
+	}
+}
+
+func TestStorage_ReleaseJobs(t *testing.T) {
+	cases := map[string]struct {
+		errs            map[string]error
+		expectedUpdates int
+		err             error
+	}{
+		"release claimed jobs": {
+			expectedUpdates: 2,
+		},
+		"skip jobs which have moved on": {
+			errs:            map[string]error{"1": &types.ConditionalCheckFailedException{}},
+			expectedUpdates: 2,
+		},
+		"failed to release jobs": {
+			errs:            map[string]error{"1": errors.New("some error")},
+			expectedUpdates: 1,
+			err:             errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &fakePaginatingClient{updateErrs: tc.errs}
+
+			err := New(client, "table", "index").ReleaseJobs(context.TODO(), &ReleaseJobsInput{
+				IDs:   []uint64{1, 2},
+				Token: "token",
+			})
+
+			a.Equal(tc.err, err)
+			a.Len(client.updates, tc.expectedUpdates)
+			a.Equal(aws.String("SET #s = :queued, UpdatedAt = :now REMOVE ClaimToken"), client.updates[0].UpdateExpression)
+			a.Equal(aws.String("#s = :in_progress AND ClaimToken = :token"), client.updates[0].ConditionExpression)
+		})
+	}
+}
+
+func TestStorage_UpdateJobsChunks(t *testing.T) {
+	a := assert.New(t)
+	client := new(fakePaginatingClient)
+	input := &UpdateJobsInput{Update: make([]UpdateJob, 0), Delete: make([]uint64, 0)}
+	for i := uint64(0); i < 150; i++ {
+		input.Update = append(input.Update, UpdateJob{ID: i, Status: "queued"})
+	}
+	for i := uint64(150); i < 210; i++ {
+		input.Delete = append(input.Delete, i)
+	}
+
+	a.Nil(New(client, "table", "index").UpdateJobs(context.TODO(), input))
+
+	sizes := make([]int, 0)
+	for _, i := range client.transactions {
+		sizes = append(sizes, len(i.TransactItems))
+	}
+	a.Equal([]int{100, 100, 10}, sizes)
+}
+
+func TestStorage_UpdateJobsIf(t *testing.T) {
+	cases := map[string]struct {
+		errs              map[string]error
+		updatedAt         int64
+		expectedCondition string
+		err               error
+	}{
+		"update jobs which match": {
+			updatedAt:         testUpdatedAt,
+			expectedCondition: "#s = :if_status AND UpdatedAt = :if_updated_at",
+		},
+		"update jobs without update time": {
+			expectedCondition: "#s = :if_status AND (attribute_not_exists(UpdatedAt) OR UpdatedAt = :if_updated_at)",
+		},
+		"skip jobs which have moved on": {
+			errs:              map[string]error{"1": &types.ConditionalCheckFailedException{}},
+			updatedAt:         testUpdatedAt,
+			expectedCondition: "#s = :if_status AND UpdatedAt = :if_updated_at",
+		},
+		"failed to update jobs": {
+			errs:              map[string]error{"1": errors.New("some error")},
+			updatedAt:         testUpdatedAt,
+			expectedCondition: "#s = :if_status AND UpdatedAt = :if_updated_at",
+			err:               errors.New("some error"),
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			client := &fakePaginatingClient{updateErrs: tc.errs}
+			db := New(client, "table", "index").(*storage)
+			db.now = func() time.Time { return time.UnixMilli(testUpdatedAt + 1) }
+
+			err := db.UpdateJobs(context.TODO(), &UpdateJobsInput{
+				Update: []UpdateJob{
+					{ID: 1, Status: "queued", If: &UpdateCondition{Status: "in_progress", UpdatedAt: tc.updatedAt}},
+					{ID: 2, Status: "completed"},
+				},
+				Delete: []uint64{3},
+			})
+
+			a.Equal(tc.err, err)
+			a.Equal(&dynamodb.UpdateItemInput{
+				TableName:           aws.String("table"),
+				Key:                 getKey(1),
+				UpdateExpression:    aws.String("SET #s = :s, UpdatedAt = :now"),
+				ConditionExpression: aws.String(tc.expectedCondition),
+				ExpressionAttributeNames: map[string]string{
+					"#s": "Status",
+				},
+				ExpressionAttributeValues: map[string]types.AttributeValue{
+					":s":             &types.AttributeValueMemberS{Value: "queued"},
+					":now":           &types.AttributeValueMemberN{Value: strconv.FormatInt(testUpdatedAt+1, 10)},
+					":if_status":     &types.AttributeValueMemberS{Value: "in_progress"},
+					":if_updated_at": &types.AttributeValueMemberN{Value: strconv.FormatInt(tc.updatedAt, 10)},
+				},
+			}, client.updates[0])
+			if tc.err != nil {
+				a.Empty(client.transactions)
+				return
+			}
+
+			a.Len(client.transactions, 1)
+			a.Len(client.transactions[0].TransactItems, 2)
+		})
+	}
+}
+
+// fakePaginatingClient evaluates Limit items per page before filtering them by status, like DynamoDB.
+type fakePaginatingClient struct {
+	items           []map[string]types.AttributeValue
+	inputs          []*dynamodb.QueryInput
+	updates         []*dynamodb.UpdateItemInput
+	transactions    []*dynamodb.TransactWriteItemsInput
+	capacityPerItem float64
+	err             error
+	updateErr       error
+	updateErrs      map[string]error
+}
+
+func (f *fakePaginatingClient) Query(
+	_ context.Context,
+	params *dynamodb.QueryInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.QueryOutput, error) {
+	f.inputs = append(f.inputs, params)
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	start := 0
+	if params.ExclusiveStartKey != nil {
+		for i, item := range f.items {
+			if item["ID"].(*types.AttributeValueMemberN).Value ==
+				params.ExclusiveStartKey["ID"].(*types.AttributeValueMemberN).Value {
+				start = i + 1
+			}
+		}
+	}
+
+	end := start + int(aws.ToInt32(params.Limit))
+	if end > len(f.items) {
+		end = len(f.items)
+	}
+
+	statuses := make(map[string]bool)
+	for k, v := range params.ExpressionAttributeValues {
+		if strings.HasPrefix(k, ":s") {
+			statuses[v.(*types.AttributeValueMemberS).Value] = true
+		}
+	}
+
+	o := &dynamodb.QueryOutput{
+		Items: make([]map[string]types.AttributeValue, 0),
+		ConsumedCapacity: &types.ConsumedCapacity{
+			CapacityUnits: aws.Float64(f.capacityPerItem * float64(end-start)),
+		},
+	}
+
+	os, filterOS := params.ExpressionAttributeValues[":os"].(*types.AttributeValueMemberS)
+	for _, item := range f.items[start:end] {
+		if !statuses[item["Status"].(*types.AttributeValueMemberS).Value] {
+			continue
+		}
+
+		if filterOS && item["OS"].(*types.AttributeValueMemberS).Value != os.Value {
+			continue
+		}
+
+		o.Items = append(o.Items, item)
+	}
+
+	if end < len(f.items) {
+		o.LastEvaluatedKey = map[string]types.AttributeValue{"ID": f.items[end-1]["ID"]}
+	}
+
+	return o, nil
+}
+
+func (f *fakePaginatingClient) UpdateItem(
+	_ context.Context,
+	params *dynamodb.UpdateItemInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.UpdateItemOutput, error) {
+	f.updates = append(f.updates, params)
+	if err, ok := f.updateErrs[params.Key["ID"].(*types.AttributeValueMemberN).Value]; ok {
+		return nil, err
+	}
+
+	return new(dynamodb.UpdateItemOutput), f.updateErr
+}
+
+func (f *fakePaginatingClient) TransactWriteItems(
+	_ context.Context,
+	params *dynamodb.TransactWriteItemsInput,
+	_ ...func(*dynamodb.Options),
+) (*dynamodb.TransactWriteItemsOutput, error) {
+	f.transactions = append(f.transactions, params)
+	return new(dynamodb.TransactWriteItemsOutput), nil
+}
+
 func TestStorageSuite(t *testing.T) {
 	suite.Run(t, &storageSuite{
 		table:     testTable,
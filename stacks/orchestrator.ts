@@ -7,13 +7,28 @@ import { Queue } from 'aws-cdk-lib/aws-sqs';
 import { Construct } from 'constructs';
 import { SubscriptionFilter, Topic } from 'aws-cdk-lib/aws-sns';
 import { SqsSubscription } from 'aws-cdk-lib/aws-sns-subscriptions';
+import { Table } from 'aws-cdk-lib/aws-dynamodb';
 import * as sns from 'aws-cdk-lib/aws-sns';
 
+interface RunnerProfile {
+  label: string;
+  mode: RunnerMode;
+}
+
+interface WorkVolume {
+  storageClass: string;
+  size: string;
+}
+
 interface RunnerEKS {
   cluster: string;
   runnerNamespace: string;
   githubTokenSecret: string;
   githubTokenSecretKey: string;
+  runnerMode: RunnerMode;
+  // jobs with the label of a profile run in the profile mode instead of runnerMode.
+  runnerProfiles: RunnerProfile[];
+  workVolume: WorkVolume;
 }
 
 interface Container {
@@ -29,7 +44,10 @@ type SNSFilterPolicy = { [attribute: string]: sns.SubscriptionFilter };
 interface OrchestratorProps extends StackProps {
   application: string;
   githubToken: string;
+  githubAppID: string;
+  githubAppPrivateKey: string;
   jobsTopic: Topic;
+  breakerTable: Table;
   ubuntuLaunchTemplateID: string;
   cluster: RunnerEKS;
   ubuntuRunnerContainer: Container;
@@ -47,6 +65,11 @@ enum OS {
   Ubuntu = 'ubuntu',
 }
 
+export enum RunnerMode {
+  DinD = 'dind',
+  ContainerHooks = 'container-hooks',
+}
+
 enum Status {
   Queued = 'queued',
   Completed = 'completed',
@@ -65,6 +88,9 @@ export class Orchestrator extends Stack {
 
   private readonly lambdaMemory: number = 512;
 
+  // failed messages are redelivered with an exponential backoff before moving to the DLQ.
+  private readonly maxReceiveCount: number = 10;
+
   constructor(scope: Construct, id: string, props: OrchestratorProps) {
     super(scope, id, props);
 
@@ -77,6 +103,7 @@ export class Orchestrator extends Stack {
       SUBNET_ID: props.subnetID,
       GITHUB_TOKEN: props.githubToken,
       GITHUB_RUNNER_VERSION: props.runnerVersion,
+      BREAKER_TABLE: props.breakerTable.tableName,
     };
 
     const eksOrchestrator = this.createSQSLambdaSubscriber(
@@ -89,9 +116,19 @@ export class Orchestrator extends Stack {
       EKS_NAMESPACE: props.cluster.runnerNamespace,
       GITHUB_TOKEN_SECRET: props.cluster.githubTokenSecret,
       GITHUB_TOKEN_SECRET_TOKEN: props.cluster.githubTokenSecretKey,
+      // runner tokens are issued as the GitHub App, scoped to the repository of the job.
+      GITHUB_APP_ID: props.githubAppID,
+      GITHUB_APP_PRIVATE_KEY: props.githubAppPrivateKey,
       DIND_CONTAINER_IMAGE: props.dindContainer.image,
       DIND_CONTAINER_CPU: props.dindContainer.cpu,
       DIND_CONTAINER_MEMORY: props.dindContainer.memory,
+      RUNNER_MODE: props.cluster.runnerMode,
+      RUNNER_PROFILES: props.cluster.runnerProfiles
+        .map((p) => `${p.label}=${p.mode}`)
+        .join(','),
+      WORK_VOLUME_STORAGE_CLASS: props.cluster.workVolume.storageClass,
+      WORK_VOLUME_SIZE: props.cluster.workVolume.size,
+      BREAKER_TABLE: props.breakerTable.tableName,
     };
 
     // EC2 Ubuntu Launcher
@@ -99,7 +136,10 @@ export class Orchestrator extends Stack {
       new SqsSubscription(
         ec2Orchestrator(
           OrchestratorRole.Launcher,
-          this.getEC2LauncherPolicyStatements(),
+          [
+            ...this.getEC2LauncherPolicyStatements(),
+            this.getBreakerPolicyStatement(props.breakerTable),
+          ],
           this.lambdaMemory,
           join(
             __dirname,
@@ -132,7 +172,10 @@ export class Orchestrator extends Stack {
       new SqsSubscription(
         eksOrchestrator(
           OrchestratorRole.Launcher,
-          this.getEKSOrchestratorPolicyStatements(),
+          [
+            ...this.getEKSOrchestratorPolicyStatements(),
+            this.getBreakerPolicyStatement(props.breakerTable),
+          ],
           this.lambdaMemory,
           join(__dirname, '..', 'orchestrator', '_dist', 'launcher', 'eks'),
           Duration.minutes(1),
@@ -238,9 +281,18 @@ export class Orchestrator extends Stack {
         ? `${application}-${host}-${os}-${orchestratorRole}`.toLowerCase()
         : `${application}-${host}-${orchestratorRole}`.toLowerCase();
 
+      const deadLetterQueue = new Queue(this, `${idPrefix}DLQ`, {
+        queueName: `${name}-dlq`,
+        retentionPeriod: Duration.days(14),
+      });
+
       const queue = new Queue(this, `${idPrefix}SQS`, {
         queueName: name,
         visibilityTimeout: timeout,
+        deadLetterQueue: {
+          queue: deadLetterQueue,
+          maxReceiveCount: this.maxReceiveCount,
+        },
       });
 
       const lambda = new Function(this, `${idPrefix}Lambda`, {
@@ -250,9 +302,15 @@ export class Orchestrator extends Stack {
         memorySize,
         timeout,
         code: Code.fromAsset(codeFile),
-        environment: envs,
+        environment: {
+          ...envs,
+          DEAD_LETTER_QUEUE_URL: deadLetterQueue.queueUrl,
+        },
       });
 
+      queue.grant(lambda, 'sqs:ChangeMessageVisibility');
+      deadLetterQueue.grantSendMessages(lambda);
+
       lambda.role?.attachInlinePolicy(
         new Policy(this, `${idPrefix}Policy`, {
           statements: lambdaPolicyStatements,
@@ -330,4 +388,12 @@ export class Orchestrator extends Stack {
       }),
     ];
   }
+
+  getBreakerPolicyStatement(table: Table): PolicyStatement {
+    return new PolicyStatement({
+      actions: ['dynamodb:UpdateItem'],
+      effect: Effect.ALLOW,
+      resources: [table.tableArn],
+    });
+  }
 }
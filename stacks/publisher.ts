@@ -16,9 +16,17 @@ import {
 } from 'aws-cdk-lib/aws-lambda';
 import { LambdaRestApi, MethodLoggingLevel } from 'aws-cdk-lib/aws-apigateway';
 import { DynamoEventSource } from 'aws-cdk-lib/aws-lambda-event-sources';
+import { StringParameter } from 'aws-cdk-lib/aws-ssm';
 import { Topic } from 'aws-cdk-lib/aws-sns';
 import { LambdaSubscription } from 'aws-cdk-lib/aws-sns-subscriptions';
 
+export interface ConcurrencyLimit {
+  host: string;
+  os?: string;
+  labels?: string[];
+  limit: number;
+}
+
 interface PublisherProps extends StackProps {
   application: string;
   githubAppID: string;
@@ -27,6 +35,8 @@ interface PublisherProps extends StackProps {
   githubToken: string;
   ec2ConcurrencyLimit: number;
   eksConcurrencyLimit: number;
+  // concurrencyLimits limit runners per host, OS and labels, they replace the limits per host.
+  concurrencyLimits?: ConcurrencyLimit[];
   logLevel: string;
 }
 
@@ -43,6 +53,8 @@ export class Publisher extends Stack {
 
   jobsTopic: Topic;
 
+  breakerTable: Table;
+
   constructor(scope: Construct, id: string, props: PublisherProps) {
     super(scope, id, props);
 
@@ -59,6 +71,19 @@ export class Publisher extends Stack {
       this.jobsTableHostIndex
     );
 
+    this.breakerTable = this.createBreakerTable(props.application);
+
+    // limits can be changed at runtime, the publisher falls back to the limits of its environment.
+    const limitsParameter = new StringParameter(this, 'LimitsParameter', {
+      parameterName: `/${props.application}/concurrency-limits`,
+      stringValue: JSON.stringify(
+        props.concurrencyLimits ?? [
+          { host: 'ec2', limit: props.ec2ConcurrencyLimit },
+          { host: 'eks', limit: props.eksConcurrencyLimit },
+        ]
+      ),
+    });
+
     const producer = this.createProducer(
       props.application,
       props.githubAppID,
@@ -77,10 +102,13 @@ export class Publisher extends Stack {
       props.application,
       props.ec2ConcurrencyLimit,
       props.eksConcurrencyLimit,
+      props.concurrencyLimits,
       jobsTable.tableName,
       this.jobsTableHostIndex,
       publisherTopic.topicArn,
-      this.jobsTopic.topicArn
+      this.jobsTopic.topicArn,
+      this.breakerTable.tableName,
+      limitsParameter.parameterName
     );
 
     new LambdaRestApi(this, 'PublisherAPIGateway', {
@@ -107,6 +135,18 @@ export class Publisher extends Stack {
     publisherTopic.addSubscription(new LambdaSubscription(publisher));
     this.jobsTopic.grantPublish(publisher);
     jobsTable.grantReadWriteData(publisher);
+    this.breakerTable.grantReadWriteData(publisher);
+    limitsParameter.grantRead(publisher);
+  }
+
+  // orchestrator launchers record consecutive launch failures per RunnerType.
+  createBreakerTable(application: string): Table {
+    return new Table(this, 'BreakerTable', {
+      tableName: `${application}-breakers`,
+      partitionKey: { name: 'RunnerType', type: AttributeType.STRING },
+      billingMode: BillingMode.PAY_PER_REQUEST,
+      removalPolicy: RemovalPolicy.DESTROY,
+    });
   }
 
   createJobsTable(application: string, index: string): Table {
@@ -123,7 +163,8 @@ export class Publisher extends Stack {
       partitionKey: { name: 'Host', type: AttributeType.STRING },
       sortKey: { name: 'CreatedAt', type: AttributeType.NUMBER },
       projectionType: ProjectionType.INCLUDE,
-      nonKeyAttributes: ['OS', 'Content', 'Status'],
+      // the projection can't be changed in place, see Cancelled Jobs in the README.
+      nonKeyAttributes: ['OS', 'Content', 'Status', 'UpdatedAt', 'ClaimToken', 'CompletedFrom'],
     });
 
     return table;
@@ -174,10 +215,13 @@ export class Publisher extends Stack {
     application: string,
     ec2Limits: number,
     eksLimits: number,
+    limits: ConcurrencyLimit[] | undefined,
     table: string,
     index: string,
     publisherTopic: string,
-    jobsTopic: string
+    jobsTopic: string,
+    breakerTable: string,
+    limitsParameter: string
     // eslint-disable-next-line @typescript-eslint/ban-types
   ): Function {
     return new Function(this, 'PublisherLambda', {
@@ -195,6 +239,9 @@ export class Publisher extends Stack {
         JOBS_TABLE_HOST_INDEX: index,
         PUBLISHER_TOPIC: publisherTopic,
         JOBS_TOPIC: jobsTopic,
+        BREAKER_TABLE: breakerTable,
+        LIMITS_PARAMETER: limitsParameter,
+        ...(limits && { CONCURRENCY_LIMITS: JSON.stringify(limits) }),
       },
     });
   }
@@ -0,0 +1,117 @@
+package metrics
+
+import (
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DefaultNamespace is the CloudWatch namespace of all runner metrics.
+const DefaultNamespace = "GitHubActionsRunner"
+
+type Unit string
+
+const (
+	Count        Unit = "Count"
+	Milliseconds Unit = "Milliseconds"
+)
+
+type Dimensions map[string]string
+
+type Metric struct {
+	Name  string
+	Value float64
+	Unit  Unit
+}
+
+// Recorder records metrics sharing the same dimensions.
+type Recorder interface {
+	Put(dimensions Dimensions, metrics ...Metric)
+}
+
+type emfRecorder struct {
+	mu        sync.Mutex
+	writer    io.Writer
+	namespace string
+	now       func() time.Time
+}
+
+type emfMetadata struct {
+	Timestamp         int64                 `json:"Timestamp"`
+	CloudWatchMetrics []emfMetricsDirective `json:"CloudWatchMetrics"`
+}
+
+type emfMetricsDirective struct {
+	Namespace  string                `json:"Namespace"`
+	Dimensions [][]string            `json:"Dimensions"`
+	Metrics    []emfMetricDefinition `json:"Metrics"`
+}
+
+type emfMetricDefinition struct {
+	Name string `json:"Name"`
+	Unit Unit   `json:"Unit"`
+}
+
+// Put writes one CloudWatch Embedded Metric Format line, CloudWatch Logs extracts the metrics
+// from the Lambda log stream.
+func (r *emfRecorder) Put(dimensions Dimensions, metrics ...Metric) {
+	if len(metrics) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(dimensions))
+	for k := range dimensions {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	definitions := make([]emfMetricDefinition, 0, len(metrics))
+	doc := make(map[string]interface{}, len(dimensions)+len(metrics)+1)
+	for k, v := range dimensions {
+		doc[k] = v
+	}
+
+	for _, m := range metrics {
+		definitions = append(definitions, emfMetricDefinition{Name: m.Name, Unit: m.Unit})
+		doc[m.Name] = m.Value
+	}
+
+	doc["_aws"] = emfMetadata{
+		Timestamp: r.now().UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfMetricsDirective{
+			{
+				Namespace:  r.namespace,
+				Dimensions: [][]string{keys},
+				Metrics:    definitions,
+			},
+		},
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	_, _ = r.writer.Write(append(b, '\n'))
+}
+
+func New(w io.Writer, namespace string) Recorder {
+	return &emfRecorder{
+		writer:    w,
+		namespace: namespace,
+		now:       time.Now,
+	}
+}
+
+type nopRecorder struct{}
+
+func (nopRecorder) Put(Dimensions, ...Metric) {}
+
+// NewNop returns a Recorder which discards all metrics.
+func NewNop() Recorder {
+	return nopRecorder{}
+}
@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmfRecorder_Put(t *testing.T) {
+	cases := map[string]struct {
+		dimensions Dimensions
+		metrics    []Metric
+		expected   string
+	}{
+		"metrics with dimensions": {
+			dimensions: Dimensions{"OS": "ubuntu", "Host": "ec2"},
+			metrics: []Metric{
+				{Name: "QueuedJobs", Value: 2, Unit: Count},
+				{Name: "Latency", Value: 1.5, Unit: Milliseconds},
+			},
+			expected: `{"Host":"ec2","Latency":1.5,"OS":"ubuntu","QueuedJobs":2,` +
+				`"_aws":{"Timestamp":1640995200000,"CloudWatchMetrics":[{"Namespace":"test","Dimensions":[["Host","OS"]],` +
+				`"Metrics":[{"Name":"QueuedJobs","Unit":"Count"},{"Name":"Latency","Unit":"Milliseconds"}]}]}}` + "\n",
+		},
+		"metrics without dimensions": {
+			metrics: []Metric{
+				{Name: "Notified", Value: 1, Unit: Count},
+			},
+			expected: `{"Notified":1,` +
+				`"_aws":{"Timestamp":1640995200000,"CloudWatchMetrics":[{"Namespace":"test","Dimensions":[[]],` +
+				`"Metrics":[{"Name":"Notified","Unit":"Count"}]}]}}` + "\n",
+		},
+		"no metrics": {
+			dimensions: Dimensions{"Host": "ec2"},
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			buf := new(bytes.Buffer)
+			r := New(buf, "test").(*emfRecorder)
+			r.now = func() time.Time {
+				return time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC)
+			}
+
+			r.Put(tc.dimensions, tc.metrics...)
+
+			a.Equal(tc.expected, buf.String())
+		})
+	}
+}
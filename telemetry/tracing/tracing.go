@@ -0,0 +1,78 @@
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// ExporterEnv selects the span exporter, tracing is disabled when it's empty.
+	ExporterEnv    = "OTEL_TRACES_EXPORTER"
+	OTLPExporter   = "otlp"
+	StdoutExporter = "stdout"
+)
+
+type Shutdown func(ctx context.Context) error
+
+// Setup registers the global tracer provider and the W3C trace context propagator. Spans are
+// exported synchronously, a Lambda may be frozen before a batch is flushed.
+func Setup(ctx context.Context, service, exporter string, w io.Writer) (Shutdown, error) {
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	exp, err := newExporter(ctx, exporter, w)
+	if err != nil || exp == nil {
+		return func(context.Context) error { return nil }, err
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exp),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL,
+			semconv.ServiceNameKey.String(service),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return tp.Shutdown, nil
+}
+
+// SetupFromEnv configures the exporter from OTEL_TRACES_EXPORTER, the OTLP exporter reads the
+// standard OTEL_EXPORTER_OTLP_* variables.
+func SetupFromEnv(ctx context.Context, service string) (Shutdown, error) {
+	return Setup(ctx, service, os.Getenv(ExporterEnv), os.Stdout)
+}
+
+func newExporter(ctx context.Context, exporter string, w io.Writer) (sdktrace.SpanExporter, error) {
+	switch exporter {
+	case "", "none":
+		return nil, nil
+	case OTLPExporter:
+		return otlptracehttp.New(ctx)
+	case StdoutExporter:
+		return stdouttrace.New(stdouttrace.WithWriter(w))
+	default:
+		return nil, fmt.Errorf("unsupported traces exporter: %v", exporter)
+	}
+}
+
+// End records the error on the span before ending it.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+
+	span.End()
+}
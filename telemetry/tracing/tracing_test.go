@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestSetup(t *testing.T) {
+	cases := map[string]struct {
+		exporter string
+		expected string
+		errMsg   string
+	}{
+		"tracing disabled": {},
+		"stdout exporter": {
+			exporter: StdoutExporter,
+			expected: `"Name":"test-span"`,
+		},
+		"unsupported exporter": {
+			exporter: "zipkin",
+			errMsg:   "unsupported traces exporter: zipkin",
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			buf := new(bytes.Buffer)
+
+			shutdown, err := Setup(context.TODO(), "test", tc.exporter, buf)
+			if tc.errMsg != "" {
+				a.EqualError(err, tc.errMsg)
+				return
+			}
+
+			a.Nil(err)
+			_, span := otel.Tracer("test").Start(context.TODO(), "test-span")
+			span.End()
+			a.Nil(shutdown(context.TODO()))
+
+			if tc.expected == "" {
+				a.Empty(buf.String())
+				return
+			}
+
+			a.Contains(buf.String(), tc.expected)
+			a.Contains(buf.String(), `{"Key":"service.name","Value":{"Type":"STRING","Value":"test"}}`)
+		})
+	}
+}
+
+func TestEnd(t *testing.T) {
+	cases := map[string]struct {
+		err          error
+		expectedCode codes.Code
+		events       int
+	}{
+		"span without error": {
+			expectedCode: codes.Unset,
+		},
+		"span with error": {
+			err:          errors.New("some error"),
+			expectedCode: codes.Error,
+			events:       1,
+		},
+	}
+
+	for n, tc := range cases {
+		t.Run(n, func(t *testing.T) {
+			a := assert.New(t)
+			recorder := tracetest.NewSpanRecorder()
+			_, span := sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)).
+				Tracer("test").
+				Start(context.TODO(), "test-span")
+
+			End(span, tc.err)
+
+			ended := recorder.Ended()
+			a.Len(ended, 1)
+			a.Equal(tc.expectedCode, ended[0].Status().Code)
+			a.Len(ended[0].Events(), tc.events)
+		})
+	}
+}